@@ -0,0 +1,87 @@
+package main
+
+import "fmt"
+
+// pageAnomalies checks one fetched page, before any filtering: aggregate
+// tradeIds must be contiguous (starting at wantFirst and ending at wantLast
+// when those are >= 0), timestamps must not decrease and price and quantity
+// must be positive decimals. It returns one message per kind of anomaly
+// found.
+func pageAnomalies(trades []AggTrade, wantFirst, wantLast int64) []string {
+	var found []string
+	if len(trades) == 0 {
+		return nil
+	}
+	if wantFirst >= 0 && trades[0].TradeId != wantFirst {
+		found = append(found, fmt.Sprintf("gap: page starts at tradeId %d, want %d", trades[0].TradeId, wantFirst))
+	}
+	if last := trades[len(trades)-1].TradeId; wantLast >= 0 && last != wantLast {
+		found = append(found, fmt.Sprintf("gap: page ends at tradeId %d, want %d", last, wantLast))
+	}
+
+	gaps, backwards, bad, nonPositive := 0, 0, 0, 0
+	var firstGap, firstBackward, firstBad, firstNonPositive string
+	for i, trade := range trades {
+		for _, v := range []struct{ name, value string }{{"price", trade.Price}, {"quantity", trade.Quantity}} {
+			n, _, err := parseDecimal(v.value)
+			if err != nil {
+				bad++
+				if firstBad == "" {
+					firstBad = fmt.Sprintf("tradeId %d %s %q", trade.TradeId, v.name, v.value)
+				}
+				break
+			}
+			if n.Sign() <= 0 {
+				nonPositive++
+				if firstNonPositive == "" {
+					firstNonPositive = fmt.Sprintf("tradeId %d %s %q", trade.TradeId, v.name, v.value)
+				}
+				break
+			}
+		}
+		if i == 0 {
+			continue
+		}
+		prev := trades[i-1]
+		if trade.TradeId != prev.TradeId+1 {
+			gaps++
+			if firstGap == "" {
+				firstGap = fmt.Sprintf("%d -> %d", prev.TradeId, trade.TradeId)
+			}
+		}
+		if trade.Timestamp < prev.Timestamp {
+			backwards++
+			if firstBackward == "" {
+				firstBackward = fmt.Sprintf("tradeId %d at %d after %d", trade.TradeId, trade.Timestamp, prev.Timestamp)
+			}
+		}
+	}
+	if gaps > 0 {
+		found = append(found, fmt.Sprintf("gap: %d non-contiguous tradeIds in page (first %s)", gaps, firstGap))
+	}
+	if backwards > 0 {
+		found = append(found, fmt.Sprintf("timestamp: %d trades earlier than the previous one (first %s)", backwards, firstBackward))
+	}
+	if bad > 0 {
+		found = append(found, fmt.Sprintf("parse: %d trades with a malformed decimal (first %s)", bad, firstBad))
+	}
+	if nonPositive > 0 {
+		found = append(found, fmt.Sprintf("value: %d trades with a zero or negative price or quantity (first %s)", nonPositive, firstNonPositive))
+	}
+	return found
+}
+
+// checkAnomalies logs a page's anomalies and, with -strict, returns an
+// error that stops the symbol.
+func checkAnomalies(symbol string, anomalies []string) error {
+	for _, a := range anomalies {
+		fmt.Printf("Anomaly in %s: %s\n", symbol, a)
+	}
+	progress.anomalies(symbol, len(anomalies))
+	if len(anomalies) == 0 || !cfg.Strict {
+		return nil
+	}
+	err := fmt.Errorf("-strict: %d anomalies in page", len(anomalies))
+	fmt.Printf("Stopping %s: %v\n", symbol, err)
+	return err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zeroPricePage is a crafted aggTrades payload whose middle trade has a zero
+// price.
+const zeroPricePage = `[
+	{"a":0,"p":"42000.01000000","q":"0.50000000","f":0,"l":0,"T":1699920000000,"m":true,"M":true},
+	{"a":1,"p":"0.00000000","q":"0.50000000","f":1,"l":1,"T":1699920060000,"m":false,"M":true},
+	{"a":2,"p":"42000.02000000","q":"1.00000000","f":2,"l":2,"T":1699920120000,"m":true,"M":true}
+]`
+
+func TestPageAnomalies(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		wantFirst int64
+		want      []string // 메시지 앞부분, 순서대로
+	}{
+		{"clean", `[{"a":5,"p":"1.5","q":"2","T":1},{"a":6,"p":"0.00000001","q":"0.1","T":1}]`, -1, nil},
+		{"zero price", zeroPricePage, -1, []string{"value: 1 trades"}},
+		{"zero quantity", `[{"a":0,"p":"1","q":"0.00000000","T":1}]`, -1, []string{"value: 1 trades"}},
+		{"negative price", `[{"a":0,"p":"-1.00000000","q":"1","T":1}]`, -1, []string{"value: 1 trades"}},
+		{"zero price and quantity count once", `[{"a":0,"p":"0.00000000","q":"0.00000000","T":1},{"a":1,"p":"0","q":"1","T":1}]`, -1, []string{"value: 2 trades"}},
+		{"malformed", `[{"a":0,"p":"1e5","q":"1","T":1},{"a":1,"p":"1","q":"","T":1}]`, -1, []string{"parse: 2 trades"}},
+		{"gap and backwards", `[{"a":0,"p":"1","q":"1","T":5},{"a":2,"p":"1","q":"1","T":4}]`, -1, []string{"gap: 1 non-contiguous", "timestamp: 1 trades"}},
+		{"wrong first id", `[{"a":3,"p":"1","q":"1","T":1}]`, 0, []string{"gap: page starts at tradeId 3, want 0"}},
+		{"empty", `[]`, -1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trades []AggTrade
+			if err := json.Unmarshal([]byte(tt.payload), &trades); err != nil {
+				t.Fatal(err)
+			}
+			got := pageAnomalies(trades, tt.wantFirst, -1)
+			if len(got) != len(tt.want) {
+				t.Fatalf("anomalies %q, want %q", got, tt.want)
+			}
+			for i, prefix := range tt.want {
+				if !strings.HasPrefix(got[i], prefix) {
+					t.Errorf("anomaly %d = %q, want prefix %q", i, got[i], prefix)
+				}
+			}
+		})
+	}
+}
+
+// TestZeroPriceStrict collects zeroPricePage: without -strict it is logged,
+// counted and written, with -strict the symbol stops before writing it.
+func TestZeroPriceStrict(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.Location, cfg.Format = time.UTC, "csv"
+	defer func(strict bool) { cfg.Strict = strict }(cfg.Strict)
+	tests := []struct {
+		strict  bool
+		wantErr bool
+		wantIds []int64
+	}{
+		{false, false, []int64{0, 1, 2}},
+		{true, true, nil},
+	}
+	for _, tt := range tests {
+		name := "lenient"
+		if tt.strict {
+			name = "strict"
+		}
+		t.Run(name, func(t *testing.T) {
+			cfg.Strict = tt.strict
+			writeDateFiles(t, nil)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("fromId") == "0" {
+					w.Write([]byte(zeroPricePage))
+					return
+				}
+				w.Write([]byte(`[]`))
+			}))
+			defer srv.Close()
+			defer func(old string) { apiURL = old }(apiURL)
+			apiURL = srv.URL + "/api/v3/aggTrades"
+
+			symbol := "BTCUSDT"
+			progress.mu.Lock()
+			before := progress.symbol(symbol).anomaly
+			progress.mu.Unlock()
+			c := NewCollector(noLimit{})
+			c.RegisterSink(newCSVSink())
+			err := c.collectPages(context.Background(), symbol, 0, time.Time{}, nil, nil, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			progress.mu.Lock()
+			anomalies := progress.symbol(symbol).anomaly - before
+			progress.mu.Unlock()
+			if anomalies != 1 {
+				t.Errorf("%d anomalies counted, want 1", anomalies)
+			}
+			path := symbolPath(symbol, "2023-11-14.csv")
+			if tt.wantIds == nil {
+				if _, err := os.Stat(path); err == nil {
+					t.Errorf("-strict wrote %s", path)
+				}
+				return
+			}
+			if ids := fileIds(t, path); !slices.Equal(ids, tt.wantIds) {
+				t.Errorf("wrote ids %v, want %v", ids, tt.wantIds)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Binance error codes referenced by the collector.
+// https://developers.binance.com/docs/binance-spot-api-docs/errors
+const (
+	codeDisconnected    = -1001
+	codeTooManyRequests = -1003
+	codeIllegalChars    = -1100
+	codeMandatoryParam  = -1102
+	codeInvalidSymbol   = -1121
+)
+
+// APIError is returned for non-200 responses. Code and Msg come from the
+// Binance error body ({"code":-1121,"msg":"Invalid symbol."}); Code is 0
+// when the body is not in that shape.
+type APIError struct {
+	StatusCode int
+	Code       int
+	Msg        string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("API error: status code %d, code %d: %s", e.StatusCode, e.Code, e.Msg)
+	}
+	return fmt.Sprintf("API error: status code %d, body: %s", e.StatusCode, e.Msg)
+}
+
+// Retryable reports whether the same request may succeed later: rate limits,
+// IP bans (418) and server-side failures.
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusTeapot ||
+		e.StatusCode >= 500 || e.Code == codeTooManyRequests || e.Code == codeDisconnected
+}
+
+// retryStatuses is the -retry-status set; nil retries every API error
+// except an invalid symbol.
+var retryStatuses map[int]bool
+
+// parseRetryStatus parses -retry-status, a comma-separated list of HTTP
+// status codes.
+func parseRetryStatus(list string) (map[int]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	statuses := make(map[int]bool)
+	for _, s := range strings.Split(list, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid -retry-status entry %q: want HTTP status codes like 429,503", s)
+		}
+		if code == http.StatusOK {
+			return nil, fmt.Errorf("invalid -retry-status entry %q: 200 is not an error", s)
+		}
+		statuses[code] = true
+	}
+	return statuses, nil
+}
+
+// shouldRetry reports whether a failed fetch is retried. Network errors
+// always are; API errors are unless the symbol is invalid or, with
+// -retry-status, their status is not listed.
+func shouldRetry(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	if apiErr.Code == codeInvalidSymbol {
+		return false
+	}
+	return retryStatuses == nil || retryStatuses[apiErr.StatusCode]
+}
+
+func parseAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Msg: string(body)}
+	var payload struct {
+		Code *int   `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Code != nil {
+		apiErr.Code, apiErr.Msg = *payload.Code, payload.Msg
+	}
+	return apiErr
+}
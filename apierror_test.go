@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseAPIError(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		code      int
+		msg       string
+		retryable bool
+		retry     bool // shouldRetry without -retry-status
+	}{
+		{"invalid symbol", 400, `{"code":-1121,"msg":"Invalid symbol."}`, codeInvalidSymbol, "Invalid symbol.", false, false},
+		{"illegal characters", 400, `{"code":-1100,"msg":"Illegal characters found in parameter 'fromId'."}`, codeIllegalChars, "Illegal characters found in parameter 'fromId'.", false, true},
+		{"mandatory parameter", 400, `{"code":-1102,"msg":"Mandatory parameter 'symbol' was not sent."}`, codeMandatoryParam, "Mandatory parameter 'symbol' was not sent.", false, true},
+		{"too many requests", 429, `{"code":-1003,"msg":"Too much request weight used."}`, codeTooManyRequests, "Too much request weight used.", true, true},
+		{"ip ban", 418, `{"code":-1003,"msg":"Way too much request weight used; IP banned."}`, codeTooManyRequests, "Way too much request weight used; IP banned.", true, true},
+		{"disconnected", 400, `{"code":-1001,"msg":"Internal error; unable to process your request."}`, codeDisconnected, "Internal error; unable to process your request.", true, true},
+		{"server error with html", 502, `<html>Bad Gateway</html>`, 0, `<html>Bad Gateway</html>`, true, true},
+		{"json without a code", 503, `{"msg":"busy"}`, 0, `{"msg":"busy"}`, true, true},
+		{"empty body", 500, ``, 0, ``, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseAPIError(tt.status, []byte(tt.body))
+			if err.StatusCode != tt.status || err.Code != tt.code || err.Msg != tt.msg {
+				t.Errorf("got {%d %d %q}, want {%d %d %q}", err.StatusCode, err.Code, err.Msg, tt.status, tt.code, tt.msg)
+			}
+			if got := err.Retryable(); got != tt.retryable {
+				t.Errorf("Retryable() = %v, want %v", got, tt.retryable)
+			}
+			if got := shouldRetry(fmt.Errorf("fetching: %w", err)); got != tt.retry {
+				t.Errorf("shouldRetry = %v, want %v", got, tt.retry)
+			}
+		})
+	}
+}
+
+func TestShouldRetryStatuses(t *testing.T) {
+	saved := retryStatuses
+	defer func() { retryStatuses = saved }()
+	var err error
+	if retryStatuses, err = parseRetryStatus("429, 503"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{parseAPIError(429, []byte(`{"code":-1003,"msg":"slow down"}`)), true},
+		{parseAPIError(503, nil), true},
+		{parseAPIError(500, nil), false},
+		{parseAPIError(400, []byte(`{"code":-1121,"msg":"Invalid symbol."}`)), false},
+		{fmt.Errorf("dial tcp: connection refused"), true},
+	}
+	for _, tt := range tests {
+		if got := shouldRetry(tt.err); got != tt.want {
+			t.Errorf("shouldRetry(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"abc", "99", "200", "429,600"} {
+		if _, err := parseRetryStatus(bad); err == nil {
+			t.Errorf("parseRetryStatus(%q) accepted", bad)
+		}
+	}
+}
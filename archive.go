@@ -0,0 +1,158 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tarArchive is one symbol's -archive file for this run. Finished date files
+// are added whole, so every entry's size is known from the file on disk, and
+// the loose file is removed once its entry has been synced.
+type tarArchive struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer // nil for -archive=tar
+	tw   *tar.Writer
+}
+
+func archiveExt(method string) string {
+	if method == "tar" {
+		return ".tar"
+	}
+	return ".tar.gz"
+}
+
+// openArchive creates <out>/<symbol>.tar.gz, or <symbol>-2.tar.gz and so on
+// when earlier runs left archives behind; a tar file cannot be reopened for
+// appending once it has been closed.
+func openArchive(symbol string) (*tarArchive, error) {
+	ext := archiveExt(cfg.Archive)
+	path := filepath.Join(cfg.OutDir, symbol+ext)
+	for n := 2; ; n++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, cfg.FileMode.Perm())
+		if err == nil {
+			a := &tarArchive{path: path, file: f}
+			var w io.Writer = f
+			if cfg.Archive == "tar.gz" {
+				a.gz = gzip.NewWriter(f)
+				w = a.gz
+			}
+			a.tw = tar.NewWriter(w)
+			fmt.Printf("Archiving finished %s files into %s\n", symbol, path)
+			return a, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		path = filepath.Join(cfg.OutDir, symbol+"-"+strconv.Itoa(n)+ext)
+	}
+}
+
+// archivePaths returns the -archive files earlier runs left for the symbol:
+// <symbol>.tar.gz, <symbol>-2.tar.gz, ... and their -archive=tar forms.
+func archivePaths(symbol string) ([]string, error) {
+	entries, err := os.ReadDir(cfg.OutDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		for _, ext := range []string{".tar", ".tar.gz"} {
+			base, ok := strings.CutSuffix(name, ext)
+			if !ok {
+				continue
+			}
+			if n, ok := strings.CutPrefix(base, symbol+"-"); ok {
+				if _, err := strconv.Atoi(n); err != nil {
+					continue
+				}
+			} else if base != symbol {
+				continue
+			}
+			paths = append(paths, filepath.Join(cfg.OutDir, name))
+		}
+	}
+	return paths, nil
+}
+
+// add appends the file at path as <symbol>/<name> and removes it. Entries are
+// flushed and synced first, so after a crash the archive still holds every
+// removed file (only the tar and gzip trailers are missing).
+func (a *tarArchive) add(symbol, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Name:    symbol + "/" + filepath.Base(path),
+		Mode:    int64(cfg.FileMode.Perm()),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(a.tw, in); err != nil {
+		return err
+	}
+	if err := a.tw.Flush(); err != nil {
+		return err
+	}
+	if a.gz != nil {
+		if err := a.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+func (a *tarArchive) close() error {
+	err := a.tw.Close()
+	if a.gz != nil {
+		err = errors.Join(err, a.gz.Close())
+	}
+	return errors.Join(err, a.file.Close())
+}
+
+// archiveDay moves a finished date's files into the symbol's archive. A file
+// that cannot be added stays where it is, and since the failed entry may be
+// half written, that archive is closed and the next day starts a new one.
+func (s *fileSink) archiveDay(symbol, date string) {
+	f := s.files(symbol)
+	if f.archive == nil {
+		a, err := openArchive(symbol)
+		if err != nil {
+			fmt.Printf("Error creating archive for %s, keeping date files: %v\n", symbol, err)
+			return
+		}
+		f.archive = a
+	}
+	for _, path := range datePartPaths(cfg.OutDir, symbol, date, s.ext) {
+		if err := f.archive.add(symbol, path); err != nil {
+			fmt.Printf("Error archiving %s into %s, keeping the file: %v\n", path, f.archive.path, err)
+			f.archive.close()
+			f.archive = nil
+			return
+		}
+	}
+}
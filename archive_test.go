@@ -0,0 +1,122 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// archivedIds returns every tradeId in the symbol's archives and loose date
+// files, sorted, with duplicates kept.
+func archivedIds(t *testing.T, symbol string) []int64 {
+	t.Helper()
+	var ids []int64
+	readCSV := func(name string, r io.Reader) {
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, record := range records[1:] {
+			id, err := strconv.ParseInt(record[0], 10, 64)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			ids = append(ids, id)
+		}
+	}
+	archives, err := archivePaths(symbol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range archives {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(zr)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			readCSV(hdr.Name, tr)
+		}
+		f.Close()
+	}
+	loose, _ := filepath.Glob(filepath.Join(symbolDir(symbol), "*.csv"))
+	for _, path := range loose {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readCSV(path, f)
+		f.Close()
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestArchiveRerunWritesNoDuplicates(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	writeDateFiles(t, nil)
+	cfg.Location, cfg.Format, cfg.Archive, cfg.AlignDays = time.UTC, "csv", "tar.gz", true
+	cfg.DirMode, cfg.OnExisting = 0o755, ""
+	s := serveWindows(t, windowBase, minutes(3000)...) // 03-10, 03-11 전체와 03-12 일부
+
+	run := func() {
+		t.Helper()
+		c := NewCollector(noLimit{})
+		c.RegisterSink(newCSVSink())
+		if err := c.processSymbol(context.Background(), "BTCUSDT"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		end      time.Time
+		wantIds  int
+		archives int
+	}{
+		{"two whole days, all archived", windowBase.Add(48 * time.Hour), 2880, 1},
+		{"the same window again", windowBase.Add(48 * time.Hour), 2880, 1},
+		{"up to the latest trade", time.Time{}, 3000, 1}, // 03-12는 아직 열린 날짜
+	}
+	for _, tt := range tests {
+		cfg.EndTime.Time = tt.end
+		cfg.StartTime.Time = time.Time{}
+		s.requests = 0
+		run()
+		ids := archivedIds(t, "BTCUSDT")
+		if !slices.Equal(ids, idsBetween(0, int64(tt.wantIds))) {
+			t.Errorf("%s: %d rows on disk, want ids 0-%d once each", tt.name, len(ids), tt.wantIds-1)
+		}
+		if archives, _ := archivePaths("BTCUSDT"); len(archives) != tt.archives {
+			t.Errorf("%s: %d archives %v, want %d", tt.name, len(archives), archives, tt.archives)
+		}
+	}
+
+	cfg.OnExisting = "overwrite"
+	cfg.EndTime.Time = windowBase.Add(24 * time.Hour)
+	run()
+	if ids := archivedIds(t, "BTCUSDT"); !slices.Equal(ids, idsBetween(0, 1440)) {
+		t.Errorf("-on-existing=overwrite left %d rows, want ids 0-1439", len(ids))
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// avroCompression is the block codec of -format=avro files. Every page is
+// one block, so deflate has up to 1000 rows to work with.
+const avroCompression = goavro.CompressionDeflateLabel
+
+// avroSchema is the record schema for the current flags: the JSON field
+// names, with quoteQty only when -quote-qty is set. Decimals stay strings,
+// as the API returns them, so no precision is lost.
+func avroSchema() string {
+	type field struct {
+		Name string `json:"name"`
+		Type any    `json:"type"`
+		Doc  string `json:"doc,omitempty"`
+	}
+	fields := []field{
+		{Name: "tradeId", Type: "long", Doc: "aggregate tradeId"},
+		{Name: "price", Type: "string", Doc: "decimal string as returned by the API"},
+		{Name: "quantity", Type: "string", Doc: "decimal string as returned by the API"},
+		{Name: "timestamp", Type: map[string]string{"type": "long", "logicalType": "timestamp-millis"}},
+		{Name: "isBuyerMaker", Type: "boolean"},
+	}
+	if cfg.QuoteQty {
+		fields = append(fields, field{Name: "quoteQty", Type: "string", Doc: "price*quantity, derived"})
+	}
+	schema, _ := json.Marshal(map[string]any{
+		"type":      "record",
+		"name":      "AggTrade",
+		"namespace": "binance",
+		"fields":    fields,
+	})
+	return string(schema)
+}
+
+var (
+	avroCodecOnce sync.Once
+	avroCodec     *goavro.Codec
+	avroCodecErr  error
+)
+
+func avroTradeCodec() (*goavro.Codec, error) {
+	avroCodecOnce.Do(func() {
+		avroCodec, avroCodecErr = goavro.NewCodec(avroSchema())
+	})
+	return avroCodec, avroCodecErr
+}
+
+func avroRecord(trade AggTrade) map[string]any {
+	jt := toJSONTrade(trade)
+	record := map[string]any{
+		"tradeId":      jt.TradeId,
+		"price":        jt.Price,
+		"quantity":     jt.Quantity,
+		"timestamp":    time.UnixMilli(trade.Timestamp),
+		"isBuyerMaker": jt.IsBuyerMaker,
+	}
+	if cfg.QuoteQty {
+		record["quoteQty"] = jt.QuoteQty
+	}
+	return record
+}
+
+// saveToAvro appends trades to an Avro object container file as one block.
+// A new file starts with a header holding the schema. For an existing file
+// only the header is read, to check the schema and get the sync marker;
+// goavro's own append mode would scan every block of the file on each page.
+// No trades write nothing, since readers reject a block of zero records.
+func saveToAvro(filePath string, trades []AggTrade) error {
+	if len(trades) == 0 {
+		return nil
+	}
+	codec, err := avroTradeCodec()
+	if err != nil {
+		return err
+	}
+	return appendFile(filePath, func(file *os.File, isNewFile bool) error {
+		config := goavro.OCFConfig{W: new(bytes.Buffer), Codec: codec, CompressionName: avroCompression}
+		if !isNewFile {
+			header, err := readAvroHeader(filePath, codec)
+			if err != nil {
+				return err
+			}
+			config.CompressionName, config.SyncMarker = header.compression, header.sync
+		}
+		buf := config.W.(*bytes.Buffer)
+		w, err := goavro.NewOCFWriter(config)
+		if err != nil {
+			return err
+		}
+		if !isNewFile {
+			buf.Reset() // 헤더는 이미 파일에 있음
+		}
+		records := make([]any, len(trades))
+		for i, trade := range trades {
+			records[i] = avroRecord(trade)
+		}
+		if err := w.Append(records); err != nil {
+			return err
+		}
+		_, err = file.Write(buf.Bytes())
+		return err
+	})
+}
+
+type avroHeader struct {
+	compression string
+	sync        [16]byte
+}
+
+// avroMetadataCodec decodes the header's metadata, an Avro map of bytes.
+var avroMetadataCodec, _ = goavro.NewCodec(`{"type":"map","values":"bytes"}`)
+
+// readAvroHeader reads the header of an existing -format=avro file and
+// checks that it was written with the same schema as codec.
+func readAvroHeader(path string, codec *goavro.Codec) (avroHeader, error) {
+	var header avroHeader
+	f, err := os.Open(path)
+	if err != nil {
+		return header, err
+	}
+	defer f.Close()
+	buf := make([]byte, 64*1024)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return header, err
+	}
+	buf = buf[:n]
+	if !bytes.HasPrefix(buf, []byte("Obj\x01")) {
+		return header, fmt.Errorf("%s is not an Avro object container file", path)
+	}
+	native, rest, err := avroMetadataCodec.NativeFromBinary(buf[4:])
+	if err != nil || len(rest) < len(header.sync) {
+		return header, fmt.Errorf("%s: unreadable Avro header: %v", path, err)
+	}
+	metadata := native.(map[string]any)
+	schema, _ := metadata["avro.schema"].([]byte)
+	existing, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		return header, fmt.Errorf("%s: invalid schema in Avro header: %w", path, err)
+	}
+	if existing.CanonicalSchema() != codec.CanonicalSchema() {
+		return header, fmt.Errorf("%s was written with a different schema (was -quote-qty changed?)", path)
+	}
+	header.compression = goavro.CompressionNullLabel
+	if c, ok := metadata["avro.codec"].([]byte); ok {
+		header.compression = string(c)
+	}
+	copy(header.sync[:], rest)
+	return header, nil
+}
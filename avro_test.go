@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+func TestAvroRoundTrip(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	if cfg.QuoteQty {
+		t.Skip("the codec is built once for -quote-qty off")
+	}
+	cfg.FileMode = 0o644
+	base := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC).UnixMilli()
+	pages := [][]AggTrade{
+		{
+			{TradeId: 3_000_000_000, Price: "42000.01000000", Quantity: "0.00100000", Timestamp: base, IsMaker: true},
+			{TradeId: 3_000_000_001, Price: "42000.02000000", Quantity: "1.50000000", Timestamp: base + 1, IsMaker: false},
+		},
+		{
+			{TradeId: 3_000_000_002, Price: "0.00000001", Quantity: "99999999.00000000", Timestamp: base + 2, IsMaker: true},
+		},
+		{}, // 빈 페이지는 블록을 쓰지 않음
+	}
+	path := filepath.Join(t.TempDir(), "2024-03-10.avro")
+	var want []AggTrade
+	for _, page := range pages {
+		if err := saveToAvro(path, page); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, page...)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := goavro.NewOCFReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, codec := r.Codec().CanonicalSchema(), mustAvroCodec(t).CanonicalSchema(); got != codec {
+		t.Errorf("embedded schema %s, want %s", got, codec)
+	}
+	var got []map[string]any
+	for r.Scan() {
+		record, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, record.(map[string]any))
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d records, want %d", len(got), len(want))
+	}
+	for i, trade := range want {
+		record := got[i]
+		if record["tradeId"] != trade.TradeId || record["price"] != trade.Price || record["quantity"] != trade.Quantity ||
+			record["isBuyerMaker"] != trade.IsMaker || !record["timestamp"].(time.Time).Equal(time.UnixMilli(trade.Timestamp)) {
+			t.Errorf("record %d = %v, want %+v", i, record, trade)
+		}
+	}
+}
+
+func mustAvroCodec(t *testing.T) *goavro.Codec {
+	t.Helper()
+	codec, err := avroTradeCodec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codec
+}
+
+func TestAvroAppendChecksHeader(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.FileMode = 0o644
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"not avro", "tradeId,price\n1,2\n"},
+		{"other schema", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".avro")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				other, err := goavro.NewCodec(`{"type":"record","name":"Other","fields":[{"name":"x","type":"long"}]}`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f, err := os.Create(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: f, Codec: other})
+				if err == nil {
+					err = w.Append([]any{map[string]any{"x": int64(1)}})
+				}
+				f.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, _ := os.ReadFile(path)
+			if err := saveToAvro(path, []AggTrade{{TradeId: 1, Price: "1", Quantity: "1"}}); err == nil {
+				t.Error("appending to the file succeeded")
+			}
+			if after, _ := os.ReadFile(path); string(after) != string(before) {
+				t.Error("the file changed after a failed append")
+			}
+		})
+	}
+}
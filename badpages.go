@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// errBadPage marks a response that arrived with status 200 but could not be
+// decoded; unlike network or server errors it may fail the same way on every
+// retry.
+var errBadPage = errors.New("malformed page")
+
+// badPages counts consecutive malformed responses for one symbol's current
+// page; with -skip-bad-pages the page is given up after that many.
+type badPages struct {
+	symbol string
+	count  int
+}
+
+// failed records a fetch error and reports whether the page should now be
+// skipped.
+func (b *badPages) failed(err error) bool {
+	if !errors.Is(err, errBadPage) {
+		b.count = 0
+		return false
+	}
+	b.count++
+	return cfg.SkipBadPages > 0 && !cfg.Strict && b.count >= cfg.SkipBadPages
+}
+
+func (b *badPages) ok() {
+	b.count = 0
+}
+
+// skip logs the ids [fromId, toId] to <symbol>/failed_ranges.log, one
+// "fromId-toId<TAB>time<TAB>error" line per page, for a later pass to retry.
+func (b *badPages) skip(fromId, toId int64, err error) {
+	b.count = 0
+	fmt.Printf("Skipping ids %d-%d of %s after %d malformed responses: %v\n", fromId, toId, b.symbol, cfg.SkipBadPages, err)
+	path := symbolPath(b.symbol, "failed_ranges.log")
+	f, ferr := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, cfg.FileMode.Perm())
+	if ferr == nil {
+		_, ferr = fmt.Fprintf(f, "%d-%d\t%s\t%v\n", fromId, toId, time.Now().UTC().Format(time.RFC3339), err)
+		if cerr := f.Close(); ferr == nil {
+			ferr = cerr
+		}
+	}
+	if ferr != nil {
+		fmt.Printf("Error recording skipped range in %s: %v\n", path, ferr)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchPage builds a 1000-trade page starting at startMs, one trade per
+// millisecond, with realistic price and quantity strings.
+func benchPage(startMs int64) []AggTrade {
+	trades := make([]AggTrade, limitPerReq)
+	for i := range trades {
+		id := int64(3_000_000_000 + i)
+		trades[i] = AggTrade{
+			TradeId:   id,
+			Price:     fmt.Sprintf("42%03d.%02d000000", i%1000, i%100),
+			Quantity:  fmt.Sprintf("0.%08d", 1000+i*37),
+			FirstId:   id * 2,
+			LastId:    id*2 + 1,
+			Timestamp: startMs + int64(i),
+			IsMaker:   i%2 == 0,
+			IsBest:    true,
+		}
+	}
+	return trades
+}
+
+var (
+	midday   = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+	boundary = time.Date(2024, 1, 1, 23, 59, 59, 500, time.UTC).UnixMilli()
+)
+
+// benchOut points -out at a temporary directory for one benchmark.
+func benchOut(b *testing.B) string {
+	b.Helper()
+	saved, savedLoc, savedMode := cfg.OutDir, cfg.Location, cfg.FileMode
+	cfg.OutDir, cfg.Location, cfg.FileMode = b.TempDir(), time.UTC, 0o644
+	b.Cleanup(func() { cfg.OutDir, cfg.Location, cfg.FileMode = saved, savedLoc, savedMode })
+	return cfg.OutDir
+}
+
+func BenchmarkGroupTradesByDate(b *testing.B) {
+	benchOut(b)
+	for _, bm := range []struct {
+		name string
+		page []AggTrade
+	}{
+		{"1000", benchPage(midday)},
+		{"1000-day-boundary", benchPage(boundary)},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				groupTradesByDate(bm.page)
+			}
+		})
+	}
+}
+
+func BenchmarkTradeDate(b *testing.B) {
+	benchOut(b)
+	page := benchPage(boundary)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, trade := range page {
+			tradeDate(trade)
+		}
+	}
+}
+
+func BenchmarkSaveToCSV(b *testing.B) {
+	path := filepath.Join(benchOut(b), "one.csv")
+	page := benchPage(midday)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := saveToCSV(path, csvRecords(page)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSaveToCSVBuffer is BenchmarkSaveToCSV with -write-buffer-bytes
+// set, for comparison with the default buffer.
+func BenchmarkSaveToCSVBuffer(b *testing.B) {
+	dir := benchOut(b)
+	page := benchPage(midday)
+	saved := cfg.WriteBufferBytes
+	defer func() { cfg.WriteBufferBytes = saved }()
+	for _, bm := range []struct {
+		name string
+		size byteSize
+	}{
+		{"64KB", 64 << 10},
+		{"1MB", 1 << 20},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			cfg.WriteBufferBytes = bm.size
+			path := filepath.Join(dir, bm.name+".csv")
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := saveToCSV(path, csvRecords(page)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSavePage(b *testing.B) {
+	dir := benchOut(b)
+	page := benchPage(boundary)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for date, trades := range groupTradesByDate(page) {
+			if err := saveToCSV(filepath.Join(dir, date+".csv"), csvRecords(trades)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkFileSinkParallel writes pages through one CSV sink from many
+// goroutines, each owning its own symbol, as a run with many symbols does.
+func BenchmarkFileSinkParallel(b *testing.B) {
+	benchOut(b)
+	const symbols = 64
+	sink := newCSVSink()
+	grouped := groupTradesByDate(benchPage(midday))
+	for i := 0; i < symbols; i++ {
+		if err := os.MkdirAll(symbolDir(fmt.Sprintf("SYM%d", i)), 0o755); err != nil {
+			b.Fatal(err)
+		}
+	}
+	var next atomic.Int32
+	b.ReportAllocs()
+	b.SetParallelism(max(symbols/runtime.GOMAXPROCS(0), 1))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		symbol := fmt.Sprintf("SYM%d", int(next.Add(1)-1)%symbols)
+		for pb.Next() {
+			if _, err := sink.writePage(symbol, grouped); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
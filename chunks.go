@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// chunkFileName is the name of the n-th -trades-per-file chunk.
+func chunkFileName(n int, ext string) string {
+	return fmt.Sprintf("part-%05d%s", n, ext)
+}
+
+func parseChunkFileName(symbol, name, ext string) (int, bool) {
+	if cfg.Flatten {
+		var ok bool
+		if name, ok = strings.CutPrefix(name, symbol+"_"); !ok {
+			return 0, false
+		}
+	}
+	name, ok := strings.CutSuffix(name, ext)
+	if !ok {
+		return 0, false
+	}
+	numStr, ok := strings.CutPrefix(name, "part-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(numStr)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// listChunkPaths returns a symbol's chunk files in chunk order.
+func listChunkPaths(root, symbol, ext string) ([]string, error) {
+	entries, err := os.ReadDir(symbolDirIn(root, symbol))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nums []int
+	for _, entry := range entries {
+		if n, ok := parseChunkFileName(symbol, entry.Name(), ext); ok && !entry.IsDir() {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	paths := make([]string, len(nums))
+	for i, n := range nums {
+		paths[i] = symbolPathIn(root, symbol, chunkFileName(n, ext))
+	}
+	return paths, nil
+}
+
+// chunkState is where a symbol's next trades go with -trades-per-file.
+type chunkState struct {
+	part     int   // 마지막 청크 번호 (0: 아직 없음)
+	rows     int64 // 마지막 청크의 행 수
+	finished int   // 이 번호까지의 청크는 압축 대상으로 넘김
+}
+
+func loadChunkState(symbol, ext string) (*chunkState, error) {
+	limit := int64(cfg.TradesPerFile)
+	st := &chunkState{}
+	// 압축된 청크는 끝난 것으로 보고 그 다음 번호부터 씀
+	for _, cext := range []string{".gz", ".zst"} {
+		compressed, err := listChunkPaths(cfg.OutDir, symbol, ext+cext)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range compressed {
+			if n, _ := parseChunkFileName(symbol, filepath.Base(path), ext+cext); n > st.part {
+				st.part, st.rows = n, limit
+			}
+		}
+	}
+
+	paths, err := listChunkPaths(cfg.OutDir, symbol, ext)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) > 0 {
+		last := paths[len(paths)-1]
+		if n, _ := parseChunkFileName(symbol, filepath.Base(last), ext); n > st.part {
+			rows, err := countRows(last, ext)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", last, err)
+			}
+			st.part, st.rows = n, rows
+		}
+	}
+	// 이전 실행에서 끝난 청크는 다시 압축하지 않음
+	st.finished = st.part - 1
+	if st.rows >= limit {
+		st.finished = st.part
+	}
+	return st, nil
+}
+
+// countRows counts the trades in a chunk: its lines, minus the CSV header.
+// Only csv and jsonl keep one trade per line, so newSink rejects the other
+// formats with -trades-per-file.
+func countRows(path, ext string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var lines int64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if ext == ".csv" && lines > 0 {
+		lines--
+	}
+	return lines, nil
+}
+
+// writeChunks appends a page to the symbol's chunk files, starting a new
+// chunk every -trades-per-file trades regardless of date. Like writePage it
+// is all-or-nothing and returns an undo for a later failing sink.
+func (s *fileSink) writeChunks(symbol string, grouped map[string][]AggTrade) (func(), error) {
+	st, err := s.chunk(symbol)
+	if err != nil {
+		return nil, err
+	}
+	limit := int64(cfg.TradesPerFile)
+
+	// 앞선 페이지에서 가득 찬 청크는 이제 바뀌지 않음
+	active := st.part
+	if st.part == 0 || st.rows >= limit {
+		active++
+	}
+	for ; st.finished < active-1; st.finished++ {
+		compressFinishedDay(symbolPath(symbol, chunkFileName(st.finished+1, s.ext)))
+	}
+
+	saved := *st
+	var marks []fileMark
+	var paths []string
+	var pieces [][]AggTrade
+	for _, date := range sortedDates(grouped) {
+		trades := grouped[date]
+		for len(trades) > 0 {
+			if st.part == 0 || st.rows >= limit {
+				st.part, st.rows = st.part+1, 0
+			}
+			n := min(int64(len(trades)), limit-st.rows)
+			path := symbolPath(symbol, chunkFileName(st.part, s.ext))
+			if len(paths) == 0 || paths[len(paths)-1] != path {
+				marks = append(marks, markFile(path))
+			}
+			if err := s.appendTrades(path, trades[:n]); err != nil {
+				rollbackFiles(marks)
+				*st = saved
+				return nil, fmt.Errorf("saving %s: %w", path, err)
+			}
+			paths = append(paths, path)
+			pieces = append(pieces, trades[:n])
+			st.rows += n
+			trades = trades[n:]
+		}
+	}
+
+	m := s.manifest(symbol)
+	before := m.snapshot(paths)
+	for i, path := range paths {
+		m.record(path, tradeDate(pieces[i][0]), pieces[i])
+	}
+	if err := m.saveIfDue(); err != nil {
+		fmt.Printf("Error saving manifest for %s: %v\n", symbol, err)
+	}
+	return func() {
+		rollbackFiles(marks)
+		*st = saved
+		m.restore(before)
+	}, nil
+}
+
+func (s *fileSink) chunk(symbol string) (*chunkState, error) {
+	f := s.files(symbol)
+	if f.chunk == nil {
+		st, err := loadChunkState(symbol, s.ext)
+		if err != nil {
+			return nil, err
+		}
+		f.chunk = st
+	}
+	return f.chunk, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChunkResumePerFormat(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	for _, format := range []string{"csv", "jsonl"} {
+		t.Run(format, func(t *testing.T) {
+			writeDateFiles(t, nil)
+			cfg.Location, cfg.Format, cfg.TradesPerFile = time.UTC, format, 1000
+			cfg.FinalCompression, cfg.CSVCRLF = "none", format == "csv" // CRLF도 한 줄로 셈
+			write := func(from, to int64) {
+				t.Helper()
+				sink, err := newSink(format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var trades []AggTrade
+				for id := from; id < to; id++ {
+					trades = append(trades, testTrade(id))
+				}
+				if err := sink.Write("BTCUSDT", "2023-11-14", trades); err != nil {
+					t.Fatal(err)
+				}
+				if err := sink.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			write(0, 1500)
+			write(1500, 2200) // 새 실행: 마지막 청크의 행 수를 파일에서 다시 셈
+
+			ext := "." + format
+			paths, err := listChunkPaths(cfg.OutDir, "BTCUSDT", ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []int64{1000, 1000, 200}
+			if len(paths) != len(want) {
+				t.Fatalf("chunks %v, want %d", paths, len(want))
+			}
+			for i, path := range paths {
+				if name := filepath.Base(path); name != chunkFileName(i+1, ext) {
+					t.Errorf("chunk %d is %s", i+1, name)
+				}
+				if rows, err := countRows(path, ext); err != nil || rows != want[i] {
+					t.Errorf("%s holds %d rows (%v), want %d", filepath.Base(path), rows, err, want[i])
+				}
+			}
+			if format == "csv" {
+				var ids []int64
+				for _, path := range paths {
+					ids = append(ids, fileIds(t, path)...)
+				}
+				if !slices.Equal(ids, idsBetween(0, 2200)) {
+					t.Errorf("chunks hold %d ids, want 0-2199 once each", len(ids))
+				}
+			}
+		})
+	}
+}
+
+func TestChunksRejectFormatsWithoutLines(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.TradesPerFile, cfg.TimestampFormat, cfg.Pretty = 1000, "millis", false
+	for _, format := range []string{"json", "avro"} {
+		if _, err := newSink(format); err == nil || err.Error() != fmt.Sprintf("-trades-per-file counts lines on resume and does not support -format=%s", format) {
+			t.Errorf("newSink(%s) = %v, want the -trades-per-file error", format, err)
+		}
+	}
+}
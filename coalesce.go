@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pendingRows are a symbol's pages held back by -min-write-rows, with the
+// checkpoint callbacks of each page, until enough rows are buffered to write
+// them in one go.
+type pendingRows struct {
+	mu     sync.Mutex
+	trades []AggTrade
+	afters []func()
+}
+
+// coalesce buffers a page under -min-write-rows. ok is false while the page
+// is held. Otherwise the held pages and their callbacks are taken out of the
+// buffer and returned, to be written in front of this page: once
+// -min-write-rows rows are buffered, when the page moves on to another date
+// (so a finished day is not held back) and for a nil page, which is how the
+// end of a symbol flushes.
+func (c *Collector) coalesce(symbol string, trades []AggTrade, after func()) (held []AggTrade, afters []func(), ok bool) {
+	v, _ := c.pending.LoadOrStore(symbol, new(pendingRows))
+	p := v.(*pendingRows)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	due := trades == nil || len(p.trades)+len(trades) >= cfg.MinWriteRows
+	if !due && len(p.trades) > 0 && len(trades) > 0 && tradeDate(p.trades[len(p.trades)-1]) != tradeDate(trades[len(trades)-1]) {
+		due = true // 날짜가 바뀜
+	}
+	if !due {
+		p.trades = append(p.trades, trades...)
+		p.afters = append(p.afters, after)
+		return nil, nil, false
+	}
+	held, afters = p.trades, p.afters
+	p.trades, p.afters = nil, nil
+	return held, afters, true
+}
+
+// unflush puts the held part of a failed write back in front of the buffer;
+// the page that triggered it is retried by its caller.
+func (c *Collector) unflush(symbol string, trades []AggTrade, afters []func()) {
+	v, _ := c.pending.LoadOrStore(symbol, new(pendingRows))
+	p := v.(*pendingRows)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trades = append(trades[:len(trades):len(trades)], p.trades...)
+	p.afters = append(afters[:len(afters):len(afters)], p.afters...)
+}
+
+// flushed writes whatever -min-write-rows still holds for the symbol when
+// its collection ends, however it ended, and returns err or the error of
+// the final write.
+func (c *Collector) flushed(symbol string, err error) error {
+	if cfg.MinWriteRows <= 0 {
+		return err
+	}
+	for failures := 0; ; {
+		ferr := c.persist(symbol, nil, func() {})
+		if ferr == nil {
+			return err
+		}
+		if ferr = saveFailed(&failures, ferr); ferr != nil {
+			fmt.Printf("Error writing the buffered rows of %s; a later run fetches them again: %v\n", symbol, ferr)
+			if err == nil {
+				err = ferr
+			}
+			return err
+		}
+		fmt.Printf("Error writing the buffered rows of %s, retrying: %v\n", symbol, ferr)
+		time.Sleep(5 * time.Second)
+	}
+}
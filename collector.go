@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Collector fetches trades for a set of symbols, sharing one Limiter, and
+// hands every page to the registered sinks.
+type Collector struct {
+	limiter     Limiter
+	sinks       []Sink
+	symbolSinks map[string][]Sink // per-symbol format; replaces sinks for the symbol
+	writers     *writerPool       // nil: pages are written by the symbol's own goroutine
+	turns       *roundRobin       // -scheduler=round-robin; nil: jobs take limiter tokens as they come
+	status      *statusWatcher    // -status-check; nil: statuses are not checked
+
+	intervals []string       // -interval: collect these klines instead of aggTrades
+	snapshots []snapshotKind // -snapshots: polled alongside while Run lasts
+
+	symbolLocks sync.Map // symbol -> *sync.Mutex; -full-history windows share a symbol's sink state
+	pending     sync.Map // symbol -> *pendingRows; -min-write-rows
+}
+
+func NewCollector(limiter Limiter) *Collector {
+	return &Collector{limiter: limiter}
+}
+
+// RegisterSink adds a sink. Sinks are written in registration order and must
+// be registered before Run.
+func (c *Collector) RegisterSink(s Sink) {
+	c.sinks = append(c.sinks, s)
+}
+
+// RegisterSymbolSink adds a sink for one symbol only. A symbol with sinks of
+// its own is not written to the RegisterSink ones.
+func (c *Collector) RegisterSymbolSink(symbol string, s Sink) {
+	if c.symbolSinks == nil {
+		c.symbolSinks = make(map[string][]Sink)
+	}
+	c.symbolSinks[symbol] = append(c.symbolSinks[symbol], s)
+}
+
+// sinksFor returns the sinks symbol is written to.
+func (c *Collector) sinksFor(symbol string) []Sink {
+	if sinks, ok := c.symbolSinks[symbol]; ok {
+		return sinks
+	}
+	return c.sinks
+}
+
+// CollectKlines makes Run collect klines for each of the given intervals
+// instead of aggTrades. Kline files are written directly, not through sinks.
+func (c *Collector) CollectKlines(intervals []string) {
+	c.intervals = intervals
+}
+
+// CollectSnapshots makes Run also take snapshots of these kinds for its
+// symbols every -snapshot-interval until the collection ends.
+func (c *Collector) CollectSnapshots(kinds []snapshotKind) {
+	c.snapshots = kinds
+}
+
+// SymbolResult is how one symbol's collection ended: Err is nil when it ran
+// to completion, errNoTrades when the symbol has never traded, a
+// *haltedError when it caught up but no longer trades (-status-check) and
+// errAborted when ctx was canceled first.
+type SymbolResult struct {
+	Symbol string
+	Err    error
+}
+
+var (
+	errAborted  = errors.New("aborted")
+	errNoTrades = errors.New("no trades")
+)
+
+// noTrades ends the collection of a symbol whose first page came back empty.
+// The directory created for it is removed again, so a broad -quote scan does
+// not leave one per never-traded symbol.
+func noTrades(symbol string) error {
+	fmt.Printf("%s has no trades. Finished.\n", symbol)
+	if !cfg.Flatten {
+		os.Remove(symbolDir(symbol)) // 비어 있을 때만 지워짐
+	}
+	return errNoTrades
+}
+
+// Run collects every symbol in its own goroutine until each finishes or ctx
+// is canceled, and returns their outcomes in completion order.
+func (c *Collector) Run(ctx context.Context, symbols []string) []SymbolResult {
+	if cfg.WriteConcurrency > 0 {
+		c.writers = newWriterPool(ctx, c, cfg.WriteConcurrency)
+		defer c.writers.close()
+	}
+
+	type job struct {
+		name string
+		run  func() error
+	}
+	var jobs []job
+	for _, symbol := range symbols {
+		if len(c.intervals) > 0 {
+			for _, interval := range c.intervals {
+				jobs = append(jobs, job{symbol + " " + interval, func() error { return c.processKlines(ctx, symbol, interval) }})
+			}
+			continue
+		}
+		if cfg.FullHistory {
+			jobs = append(jobs, job{symbol, func() error { return c.processFullHistory(ctx, symbol) }})
+		} else if cfg.NewestFirst {
+			jobs = append(jobs, job{symbol, func() error { return c.flushed(symbol, c.processSymbolNewestFirst(ctx, symbol)) }})
+		} else {
+			jobs = append(jobs, job{symbol, func() error { return c.processSymbol(ctx, symbol) }})
+		}
+	}
+
+	if cfg.StatusCheck > 0 && len(c.intervals) == 0 {
+		c.status = newStatusWatcher(c.limiter)
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		defer stopWatch()
+		go c.status.run(watchCtx, symbols, cfg.StatusCheck)
+	}
+	if len(c.snapshots) > 0 {
+		snapCtx, stopSnapshots := context.WithCancel(ctx)
+		snapDone := make(chan struct{})
+		defer func() {
+			stopSnapshots()
+			<-snapDone // 쓰는 중인 스냅샷은 마침
+		}()
+		go func() {
+			defer close(snapDone)
+			c.runSnapshots(snapCtx, symbols, c.snapshots, cfg.SnapshotInterval)
+		}()
+	}
+	if cfg.Scheduler == "round-robin" {
+		c.turns = newRoundRobin()
+		for _, j := range jobs {
+			c.turns.join(j.name)
+		}
+	}
+
+	results := make(chan SymbolResult, len(jobs))
+	for _, j := range jobs {
+		go func() {
+			err := runIsolated(j.name, j.run)
+			if c.writers != nil {
+				if werr := c.writers.wait(j.name); err == nil && werr != nil {
+					fmt.Printf("Stopping %s: %v\n", j.name, werr)
+					err = werr
+				}
+			}
+			if c.turns != nil {
+				c.turns.leave(j.name)
+			}
+			results <- SymbolResult{Symbol: j.name, Err: err}
+		}()
+	}
+	outcomes := make([]SymbolResult, 0, len(jobs))
+	for range jobs {
+		outcomes = append(outcomes, <-results)
+	}
+	return outcomes
+}
+
+// panicError is a symbol's result after its goroutine panicked.
+type panicError struct {
+	value any
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// runIsolated runs one symbol's job, turning a panic into its error so the
+// other symbols keep running.
+func runIsolated(name string, run func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			fmt.Printf("Panic while collecting %s: %v\n%s", name, v, debug.Stack())
+			err = &panicError{v}
+		}
+	}()
+	return run()
+}
+
+// sleepCtx sleeps for d or until ctx is canceled.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// pageDelay waits -page-delay after a successful fetch, on top of the rate
+// limiter.
+func pageDelay(ctx context.Context) {
+	if cfg.PageDelay > 0 {
+		sleepCtx(ctx, cfg.PageDelay)
+	}
+}
+
+func (c *Collector) Close() error {
+	sinks := slices.Clone(c.sinks)
+	for _, symbolSinks := range c.symbolSinks {
+		for _, s := range symbolSinks {
+			if !slices.Contains(sinks, s) { // 같은 형식의 심볼들이 공유
+				sinks = append(sinks, s)
+			}
+		}
+	}
+	var errs []error
+	for _, s := range sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// persist writes a page and then runs after, which advances the symbol's
+// checkpoints. With -min-write-rows small pages are held and written
+// together later, each after still running once its page is written. With
+// -write-concurrency the page is queued for the symbol's writer instead and
+// persist returns at once; after runs when the writer has stored it. If the
+// writer gave up on an earlier page, persist returns that error (wrapping
+// errPageLost) and the page is not queued.
+func (c *Collector) persist(symbol string, trades []AggTrade, after func()) error {
+	var held []AggTrade
+	var heldAfters []func()
+	if cfg.MinWriteRows > 0 {
+		var ok bool
+		if held, heldAfters, ok = c.coalesce(symbol, trades, after); !ok {
+			return nil // 다음 페이지와 함께 씀
+		}
+		if len(held) > 0 {
+			trades = slices.Concat(held, trades)
+			afters := append(slices.Clone(heldAfters), after)
+			after = func() {
+				for _, f := range afters {
+					f()
+				}
+			}
+		}
+	}
+	if c.writers != nil {
+		return c.writers.enqueue(writeJob{symbol: symbol, trades: trades, after: after})
+	}
+	mu, _ := c.symbolLocks.LoadOrStore(symbol, new(sync.Mutex))
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	if err := c.savePage(symbol, trades); err != nil {
+		if len(held) > 0 {
+			c.unflush(symbol, held, heldAfters)
+		}
+		return err
+	}
+	after()
+	return nil
+}
+
+// saveFailed counts a failed save of a symbol's page in failures and returns
+// the error to stop the symbol with once it is not worth retrying: the page
+// failed -max-stuck times in a row with an error that is not transient, such
+// as permission denied or a file name too long for one date. Nothing of the
+// page has been kept and the checkpoints are still before it, so a later run
+// saves it again; nothing is dropped. A page a writer gave up on
+// (errPageLost) stops the symbol at once.
+func saveFailed(failures *int, err error) error {
+	if errors.Is(err, errPageLost) {
+		return err
+	}
+	*failures++
+	if isTransientFileErr(err) || *failures < cfg.MaxStuck {
+		return nil
+	}
+	return fmt.Errorf("page could not be saved in %d attempts: %w", *failures, err)
+}
+
+// savePage writes one page to every sink. If a sink fails, sinks that
+// already took the page are undone where they support it, so the retried
+// page is not duplicated.
+func (c *Collector) savePage(symbol string, trades []AggTrade) error {
+	grouped := groupTradesByDate(trades)
+	applyPrecision(symbol, grouped)
+	var undos []func()
+	for _, s := range c.sinksFor(symbol) {
+		undo, err := writePage(s, symbol, grouped)
+		if err != nil {
+			for i := len(undos) - 1; i >= 0; i-- {
+				undos[i]()
+			}
+			return err
+		}
+		if undo != nil {
+			undos = append(undos, undo)
+		}
+	}
+	kept := 0
+	for _, group := range grouped {
+		kept += len(group)
+	}
+	if kept < len(trades) {
+		progress.dateFiltered(symbol, len(trades)-kept)
+	}
+	return nil
+}
+
+func writePage(s Sink, symbol string, grouped map[string][]AggTrade) (func(), error) {
+	if pw, ok := s.(pageWriter); ok {
+		return pw.writePage(symbol, grouped)
+	}
+	for _, date := range sortedDates(grouped) {
+		if err := s.Write(symbol, date, grouped[date]); err != nil {
+			return nil, fmt.Errorf("writing %s %s: %w", symbol, date, err)
+		}
+	}
+	return nil, nil
+}
+
+func (c *Collector) finishDay(symbol, date string) {
+	for _, s := range c.sinksFor(symbol) {
+		if f, ok := s.(dayFinisher); ok {
+			f.finishDay(symbol, date)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestNoTradesEver runs a symbol that has never traded, whose aggTrades
+// are empty for every query, in each collection mode.
+func TestNoTradesEver(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	defer func(old string) { apiURL = old }(apiURL)
+	apiURL = srv.URL + "/api/v3/aggTrades"
+
+	tests := []struct {
+		name                     string
+		newestFirst, fullHistory bool
+	}{
+		{"forward", false, false},
+		{"newest-first", true, false},
+		{"full-history", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.OutDir, cfg.FileMode, cfg.DirMode = t.TempDir(), 0o644, 0o755
+			cfg.Location, cfg.Format, cfg.Flatten = time.UTC, "csv", false
+			cfg.NewestFirst, cfg.FullHistory = tt.newestFirst, tt.fullHistory
+			c := NewCollector(noLimit{})
+			c.RegisterSink(newCSVSink())
+			results := c.Run(context.Background(), []string{"NEVERTRADED"})
+			if len(results) != 1 || results[0].Err != errNoTrades {
+				t.Fatalf("results %+v, want errNoTrades", results)
+			}
+			if _, err := os.Stat(symbolDir("NEVERTRADED")); !os.IsNotExist(err) {
+				t.Errorf("%s was left behind (stat: %v)", symbolDir("NEVERTRADED"), err)
+			}
+			if code := exitCode(context.Background(), results); code != exitComplete {
+				t.Errorf("exit code %d, want %d", code, exitComplete)
+			}
+
+			path := filepath.Join(t.TempDir(), "stats.json")
+			if err := writeStatsFile(context.Background(), path, time.Now(), results, exitComplete); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stats runStats
+			if err := json.Unmarshal(data, &stats); err != nil {
+				t.Fatal(err)
+			}
+			if len(stats.Symbols) != 1 || stats.Symbols[0].Status != "empty" {
+				t.Errorf("stats symbols %+v, want NEVERTRADED empty", stats.Symbols)
+			}
+		})
+	}
+}
+
+// TestNoTradesKeepsOtherFiles checks that only an empty directory is
+// removed.
+func TestNoTradesKeepsOtherFiles(t *testing.T) {
+	writeDateFiles(t, map[string][]string{"notes.txt": nil})
+	if err := noTrades("BTCUSDT"); err != errNoTrades {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := os.Stat(symbolPath("BTCUSDT", "notes.txt")); err != nil {
+		t.Error(err)
+	}
+}
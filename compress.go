@@ -0,0 +1,151 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// background tracks work started after a day file is finalized; main waits
+// for it before exiting.
+var background sync.WaitGroup
+
+// dayTracker notices when a symbol's date files are complete: once a page has
+// moved on to another date, every earlier date it touched is finished.
+type dayTracker struct {
+	current string
+}
+
+// observe takes the dates of one page in write order and returns the dates
+// that can no longer receive trades.
+func (t *dayTracker) observe(dates []string) []string {
+	if len(dates) == 0 {
+		return nil
+	}
+	last := dates[len(dates)-1]
+	var finished []string
+	seen := map[string]bool{last: true}
+	for _, date := range append([]string{t.current}, dates...) {
+		if date != "" && !seen[date] {
+			seen[date] = true
+			finished = append(finished, date)
+		}
+	}
+	t.current = last
+	return finished
+}
+
+// tradeDates returns the distinct dates of trades in the order they appear.
+func tradeDates(trades []AggTrade) []string {
+	var dates []string
+	var cache dateCache
+	for _, trade := range trades {
+		date := cache.date(trade)
+		if len(dates) == 0 || dates[len(dates)-1] != date {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+func compressFinishedDay(path string) {
+	if cfg.FinalCompression == "" || cfg.FinalCompression == "none" {
+		return
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		if err := compressFile(path, cfg.FinalCompression); err != nil {
+			fmt.Printf("Error compressing %s: %v\n", path, err)
+		}
+	}()
+}
+
+// compressedSuffixes are the names a date file can have after
+// -final-compression, as suffixes of the plain name; "" is the plain file.
+var compressedSuffixes = []string{"", ".gz", ".zst"}
+
+// decompressReader reads a file whose name ends in suffix: through gzip for
+// ".gz", zstd for ".zst", and as is otherwise. done releases the decoder.
+func decompressReader(r io.Reader, suffix string) (_ io.Reader, done func(), err error) {
+	switch suffix {
+	case ".gz":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, func() { zr.Close() }, nil
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	}
+	return r, func() {}, nil
+}
+
+func compressionExt(method string) string {
+	switch method {
+	case "zstd":
+		return ".zst"
+	case "gzip":
+		return ".gz"
+	}
+	return ""
+}
+
+func compressFile(path, method string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dst := path + compressionExt(method)
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, cfg.FileMode.Perm())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	var enc io.WriteCloser
+	switch method {
+	case "zstd":
+		enc, err = zstd.NewWriter(out, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	case "gzip":
+		enc, err = gzip.NewWriterLevel(out, gzip.BestCompression)
+	default:
+		err = fmt.Errorf("unknown compression %q", method)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := io.Copy(enc, in); err != nil {
+		enc.Close()
+		out.Close()
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	fmt.Printf("Compressed %s -> %s\n", path, dst)
+	if cfg.RemoveOriginal {
+		in.Close()
+		return os.Remove(path)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	QuoteQty     bool
+	Symbols      string
+	Quote        string
+	Exclude      string
+	SymbolsRegex string
+	NewestFirst  bool
+	OutDir       string
+	MinFree      byteSize
+
+	FinalCompression   string
+	RemoveOriginal     bool
+	RangeIndex         bool
+	Flatten            bool
+	Update             bool
+	LockWait           bool
+	SlowThreshold      time.Duration
+	StartTime          timeFlag
+	EndTime            timeFlag
+	CountOnly          bool
+	FileMode           modeFlag
+	DirMode            modeFlag
+	Format             string
+	MaxStuck           int
+	Debug              bool
+	MaxFileSize        byteSize
+	WriteConcurrency   int
+	ConfigFile         string
+	Rate               int
+	Timezone           string
+	Location           *time.Location
+	SkipComplete       bool
+	LocalAddr          string
+	IPVersion          string
+	SymbolsFile        string
+	NormalizeSymbols   bool
+	TradesPerFile      int
+	BOM                bool
+	SharedLimiter      string
+	Pretty             bool
+	Interval           string
+	Strict             bool
+	Deadline           time.Duration
+	AlignDays          bool
+	MinFreeInodes      uint64
+	JSONFields         string
+	Head               int
+	DNS                string
+	CACert             string
+	InsecureSkipVerify bool
+	ProgressJSON       string
+	PageDelay          time.Duration
+	FullHistory        bool
+	Concurrency        int
+	RetryStatus        string
+	Archive            string
+	Sort               bool
+	RowChecksum        bool
+	TimestampFormat    string
+	SkipBadPages       int
+	BaseURL            string
+	ThroughputReport   bool
+	RecordResponses    string
+	Replay             string
+	MaxPages           int
+	Weights            string
+	WeightLimit        int
+	Heartbeat          time.Duration
+	CSVQuote           string
+	CSVCRLF            bool
+	MinDate            string
+	MaxDate            string
+	DeadLetterMax      byteSize
+	MaxIdleConns       int
+	MaxConnsPerHost    int
+	IdleConnTimeout    time.Duration
+	StatsFile          string
+	Exchange           string
+	DailySummary       bool
+	WriteBufferBytes   byteSize
+	Scheduler          string
+	FifoDir            string
+	FifoNoReader       string
+	StatusCheck        time.Duration
+	FixedPrecision     bool
+	WeightHeader       string
+	ResumeAll          bool
+	AlignLimiter       bool
+	SinceTradeId       string
+	OnExisting         string
+	MinWriteRows       int
+	Source             string
+	VisionURL          string
+	MaxErrorRate       float64
+	MaxSymbolErrorRate float64
+	ErrorRateWindow    int
+	Snapshots          string
+	SnapshotInterval   time.Duration
+	StopWithin         time.Duration
+	DiscardFields      string
+}
+
+var cfg Config
+
+func registerFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&cfg.FixedPrecision, "fixed-precision", false, "write prices and quantities with the decimals of each symbol's tick and lot size (from exchangeInfo)")
+	fs.BoolVar(&cfg.QuoteQty, "quote-qty", false, "append a quoteQty column computed as price*quantity (derived; aggTrades does not return it)")
+	fs.StringVar(&cfg.Symbols, "symbols", "USDCUSDT", "comma-separated symbols to collect")
+	fs.StringVar(&cfg.Quote, "quote", "", "collect every TRADING symbol with this quote asset (uses exchangeInfo)")
+	fs.StringVar(&cfg.Exclude, "exclude", "", "comma-separated symbols to skip")
+	fs.StringVar(&cfg.SymbolsRegex, "symbols-regex", "", "collect every TRADING symbol whose name matches this Go regexp (uses exchangeInfo)")
+	fs.BoolVar(&cfg.NewestFirst, "newest-first", false, "collect backward from the latest trade, writing newest trades first")
+	fs.StringVar(&cfg.OutDir, "out", ".", "output directory; each symbol gets a subdirectory")
+	fs.Var(&cfg.MinFree, "min-free", "stop writing when free space on the -out volume drops below this (e.g. 10GB); 0 disables")
+	fs.StringVar(&cfg.FinalCompression, "final-compression", "none", "recompress each finished date file: none, gzip (level 9) or zstd")
+	fs.BoolVar(&cfg.RemoveOriginal, "remove-original", false, "delete the uncompressed date file after -final-compression succeeds")
+	fs.BoolVar(&cfg.RangeIndex, "range-index", false, "keep <symbol>/ranges.json of written tradeId ranges and skip them on later runs")
+	fs.StringVar(&cfg.FifoDir, "fifo-dir", "", "stream each symbol's trades as CSV to <dir>/<symbol>.fifo (a named pipe) instead of writing date files")
+	fs.StringVar(&cfg.FifoNoReader, "fifo-no-reader", "block", "with -fifo-dir, what to do with pages while a FIFO has no reader: block or drop")
+	fs.BoolVar(&cfg.Flatten, "flatten", false, "write <out>/<symbol>_<date>.csv instead of a directory per symbol")
+	fs.BoolVar(&cfg.ResumeAll, "resume-all", false, "collect every symbol that already has CSV files in -out, continuing each like -update")
+	fs.BoolVar(&cfg.Update, "update", false, "continue each symbol from the last tradeId already on disk")
+	fs.StringVar(&cfg.OnExisting, "on-existing", "", "what to do with a symbol that already has files in -out: append, resume (like -update), fail or overwrite; default resume when its files hold a checkpoint (the highest tradeId, or the lowest with -newest-first), else fail")
+	fs.StringVar(&cfg.SinceTradeId, "since-trade-id", "", "start every symbol at this fromId, or SYMBOL=fromId for one (comma-separated, e.g. 1000,ETHUSDT=5000); wins over -update")
+	fs.BoolVar(&cfg.LockWait, "lock-wait", false, "wait for another collector using -out to exit instead of failing")
+	fs.DurationVar(&cfg.StatusCheck, "status-check", 0, "check exchangeInfo for halted or delisted symbols this often, and when a symbol catches up; 0 disables")
+	fs.DurationVar(&cfg.Heartbeat, "heartbeat", 0, "log a summary of what every running symbol is doing (fetching, waiting on rate limit, ...) this often; 0 disables")
+	fs.DurationVar(&cfg.SlowThreshold, "slow-threshold", 2*time.Second, "warn about aggTrades requests slower than this; 0 disables")
+	fs.Var(&cfg.StartTime, "start-time", "start of the time range (RFC3339, YYYY-MM-DD or unix millis, UTC)")
+	fs.Var(&cfg.EndTime, "end-time", "end of the time range, exclusive (default: now)")
+	fs.DurationVar(&cfg.StopWithin, "stop-within", 0, "finish a symbol once a page ends within this long of now (e.g. 5s) instead of at an empty page; 0 disables")
+	fs.BoolVar(&cfg.CountOnly, "count-only", false, "print the number of trades in [-start-time, -end-time) per symbol without downloading them")
+	fs.StringVar(&cfg.Format, "format", "csv", "output format: csv, jsonl, json or avro")
+	fs.IntVar(&cfg.MaxPages, "max-pages", 0, "stop each symbol after this many successful aggTrades page fetches, e.g. for smoke tests (0 = unlimited)")
+	fs.IntVar(&cfg.MaxStuck, "max-stuck", 3, "stop a symbol when fromId fails to advance, or a page fails to save with a permanent error, this many consecutive times")
+	fs.BoolVar(&cfg.Debug, "debug", false, "log debug details such as compressed and decoded response sizes")
+	fs.Var(&cfg.MaxFileSize, "max-file-size", "start <date>.part2.csv, part3, ... once a date file reaches this size (e.g. 256MB); 0 disables")
+	fs.IntVar(&cfg.WriteConcurrency, "write-concurrency", 0, "persist pages on this many writer goroutines so fetching continues during slow writes; 0 writes inline")
+	fs.Var(&cfg.WriteBufferBytes, "write-buffer-bytes", "buffer size for writes to date files, e.g. 1MB (default 4KB)")
+	fs.IntVar(&cfg.MinWriteRows, "min-write-rows", 0, "hold back a symbol's pages until this many rows can be written at once (flushed early when the date changes and when the symbol ends); 0 writes every page")
+	fs.StringVar(&cfg.ConfigFile, "config", "", "YAML file with settings keyed by flag name; command-line flags override it")
+	fs.IntVar(&cfg.Rate, "rate", maxReqPerMin, "maximum aggTrades requests per minute")
+	fs.IntVar(&cfg.WeightLimit, "weight-limit", 0, "request weight allowed per minute, replacing -rate (default: -rate times the aggTrades weight)")
+	fs.StringVar(&cfg.WeightHeader, "weight-header", "", "response header with the weight used this minute, logged with -debug and checked by preflight (default: the -exchange's, X-MBX-USED-WEIGHT-1M)")
+	fs.StringVar(&cfg.Weights, "weights", "", "override request weights: endpoint=weight or endpoint:maxLimit=weight, comma-separated (e.g. aggTrades=2)")
+	fs.StringVar(&cfg.Timezone, "tz", "UTC", "IANA time zone used to split trades into date files")
+	fs.BoolVar(&cfg.SkipComplete, "skip-complete", false, "skip dates the manifest marks complete instead of re-fetching them")
+	fs.StringVar(&cfg.LocalAddr, "local-addr", "", "source IP address for outgoing API connections")
+	fs.StringVar(&cfg.IPVersion, "ip-version", "", "force IPv4 (4) or IPv6 (6) for API connections")
+	fs.StringVar(&cfg.DNS, "dns", "", "DNS server (IP[:port]) for API host lookups, falling back to the system resolver (default: system resolver)")
+	fs.IntVar(&cfg.MaxIdleConns, "max-idle-conns", 32, "idle keep-alive connections to keep open to the API host; 0 keeps none")
+	fs.IntVar(&cfg.MaxConnsPerHost, "max-conns-per-host", 0, "cap on connections to the API host, including in-flight requests (0 = no cap)")
+	fs.DurationVar(&cfg.IdleConnTimeout, "idle-conn-timeout", 90*time.Second, "close keep-alive connections idle for longer than this (0 = never)")
+	fs.StringVar(&cfg.CACert, "ca-cert", "", "PEM file of extra CA certificates to trust for API connections, e.g. a corporate proxy's CA")
+	fs.BoolVar(&cfg.FullHistory, "full-history", false, "collect each symbol's whole history from its first trade as daily windows")
+	fs.IntVar(&cfg.Concurrency, "concurrency", 1, "with -full-history, collect this many days of a symbol at once")
+	fs.StringVar(&cfg.RecordResponses, "record-responses", "", "save the raw body of every forward aggTrades page to <dir>/<symbol>/<fromId>.json for -replay")
+	fs.StringVar(&cfg.Replay, "replay", "", "read forward aggTrades pages from a -record-responses directory instead of the API")
+	fs.StringVar(&cfg.StatsFile, "stats-file", "", "write a JSON report of the run (per-symbol counts, dates, errors, bytes, durations, exit status) to this file at exit")
+	fs.BoolVar(&cfg.ThroughputReport, "throughput-report", false, "print requests, MB received and rows written per minute (average and peak) at exit")
+	fs.StringVar(&cfg.Exchange, "exchange", "global", "exchange to collect from: global (api.binance.com) or us (api.binance.us, with its own weights and limits)")
+	fs.StringVar(&cfg.Source, "source", "api", "where forward collection reads past days from: api, or vision (the data.binance.vision daily and monthly dumps, then the API for days not published yet)")
+	fs.StringVar(&cfg.VisionURL, "vision-url", defaultVisionURL, "base URL of the -source=vision dumps")
+	fs.StringVar(&cfg.BaseURL, "base-url", "", "REST API base, e.g. a mirror (https://host) or a full aggTrades URL (http://localhost:8080/mock/aggTrades) used verbatim")
+	fs.IntVar(&cfg.SkipBadPages, "skip-bad-pages", 0, "skip a page after this many consecutive malformed responses, logging its ids to <symbol>/failed_ranges.log (0 = retry forever; ignored with -strict)")
+	fs.StringVar(&cfg.TimestampFormat, "timestamp-format", "millis", "timestamp column format: millis, seconds, iso8601 (RFC3339 in -tz) or unix-nanos")
+	fs.BoolVar(&cfg.RowChecksum, "row-checksum", false, "append a checksum column (CRC-32 of the row's other fields) to CSV rows")
+	fs.StringVar(&cfg.DiscardFields, "discard-fields", "", "leave these comma-separated columns (e.g. tradeId,isBuyerMaker) out of CSV headers and rows")
+	fs.BoolVar(&cfg.Sort, "sort", false, "rewrite each finished date file in tradeId order (holds the whole file in memory)")
+	fs.StringVar(&cfg.Archive, "archive", "", "move finished date files into one archive per symbol: tar.gz or tar")
+	fs.StringVar(&cfg.RetryStatus, "retry-status", "", "comma-separated HTTP statuses to retry (e.g. 429,418,500,502,503,504); other API errors stop the symbol (default: retry all but an invalid symbol)")
+	fs.StringVar(&cfg.Scheduler, "scheduler", "per-symbol", "how symbols share the rate limit: per-symbol (each takes tokens as it can) or round-robin (one page per symbol in turn)")
+	fs.DurationVar(&cfg.PageDelay, "page-delay", 0, "extra pause after each successful page fetch, on top of the rate limit (0 = none)")
+	fs.StringVar(&cfg.ProgressJSON, "progress-json", "", "emit one JSON object per stored page to stderr or this file/named pipe")
+	fs.BoolVar(&cfg.InsecureSkipVerify, "insecure-skip-verify", false, "UNSAFE: do not verify the API's TLS certificate (prefer -ca-cert)")
+	fs.StringVar(&cfg.SymbolsFile, "symbols-file", "", "file listing symbols to collect, one per line (replaces -symbols)")
+	fs.BoolVar(&cfg.NormalizeSymbols, "normalize-symbols", true, "trim and uppercase symbol names before use")
+	fs.IntVar(&cfg.TradesPerFile, "trades-per-file", 0, "write part-00001.csv, part-00002.csv, ... of N trades each instead of date files")
+	fs.StringVar(&cfg.CSVQuote, "csv-quote", "minimal", "CSV quoting: minimal (only fields that need it), all (every field) or none (fail on a field that needs quoting)")
+	fs.BoolVar(&cfg.CSVCRLF, "csv-crlf", false, "end CSV lines with \\r\\n instead of \\n")
+	fs.BoolVar(&cfg.BOM, "bom", false, "start new CSV files with a UTF-8 byte-order mark (for Excel)")
+	fs.BoolVar(&cfg.AlignLimiter, "align-limiter", false, "start the limiter's first window at the server's minute, counting the weight already used by this IP (one /api/v3/time request)")
+	fs.StringVar(&cfg.SharedLimiter, "shared-limiter", "", "share the -rate budget with other processes: file:///path or redis://host:port/key")
+	fs.BoolVar(&cfg.Pretty, "pretty", false, "indent the elements of -format=json files")
+	fs.StringVar(&cfg.Interval, "interval", "", "collect klines for these comma-separated intervals (e.g. 1m,5m,1h) instead of aggTrades")
+	fs.StringVar(&cfg.Snapshots, "snapshots", "", "also poll these comma-separated tickers (bookTicker, 24hr) for the collected symbols while collecting")
+	fs.DurationVar(&cfg.SnapshotInterval, "snapshot-interval", time.Minute, "how often -snapshots are taken")
+	fs.BoolVar(&cfg.Strict, "strict", false, "stop a symbol and exit 1 on any data anomaly (tradeId gap, decreasing timestamp, malformed decimal)")
+	fs.Float64Var(&cfg.MaxErrorRate, "max-error-rate", 0, "abort the run (exit 3) once more than this fraction of the last -error-rate-window aggTrades fetches failed, e.g. 0.1; 0 disables")
+	fs.Float64Var(&cfg.MaxSymbolErrorRate, "max-symbol-error-rate", 0, "stop a symbol (as failed) once more than this fraction of its last -error-rate-window fetches failed; 0 disables")
+	fs.IntVar(&cfg.ErrorRateWindow, "error-rate-window", 100, "number of recent fetches -max-error-rate and -max-symbol-error-rate are judged over, and the minimum before they apply")
+	fs.DurationVar(&cfg.Deadline, "deadline", 0, "stop collecting after this long and exit 3 (0 = no limit)")
+	fs.StringVar(&cfg.MinDate, "min-date", "", "drop fetched trades dated (in -tz) before this YYYY-MM-DD instead of writing them")
+	fs.StringVar(&cfg.MaxDate, "max-date", "", "drop fetched trades dated (in -tz) after this YYYY-MM-DD instead of writing them")
+	fs.BoolVar(&cfg.AlignDays, "align-days", false, "widen -start-time/-end-time to midnight (in -tz) so edge date files hold whole days")
+	fs.Uint64Var(&cfg.MinFreeInodes, "min-free-inodes", 0, "stop writing when the -out volume has fewer free inodes than this")
+	fs.BoolVar(&cfg.DailySummary, "daily-summary", false, "add a row per finished date (trades, first/last/min/max price, volume, quote volume) to <symbol>/index.csv")
+	fs.StringVar(&cfg.JSONFields, "json-fields", "", "rename JSON output keys: field=key,... (e.g. tradeId=trade_id,price=exec_price)")
+	fs.IntVar(&cfg.Head, "head", 0, "print the first N trades of each symbol (at -start-time, or the latest) and exit without writing")
+	cfg.DeadLetterMax = 64 << 20
+	fs.Var(&cfg.DeadLetterMax, "dead-letter-max", "total size of <symbol>/dead_letter files keeping malformed API responses (0 = keep none)")
+	cfg.Location = time.UTC
+	cfg.FileMode, cfg.DirMode = 0644, 0755
+	fs.Var(&cfg.FileMode, "file-mode", "permissions for created files, in octal (further limited by the umask)")
+	fs.Var(&cfg.DirMode, "dir-mode", "permissions for created directories, in octal (further limited by the umask)")
+}
+
+// modeFlag is an os.FileMode flag.Value written in octal, e.g. 0640.
+type modeFlag os.FileMode
+
+func (m *modeFlag) String() string {
+	return fmt.Sprintf("%#o", uint32(*m))
+}
+
+func (m *modeFlag) Set(s string) error {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0777 {
+		return fmt.Errorf("invalid mode %q (want octal permission bits like 0644)", s)
+	}
+	*m = modeFlag(v)
+	return nil
+}
+
+func (m modeFlag) Perm() os.FileMode {
+	return os.FileMode(m).Perm()
+}
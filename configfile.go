@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the -config file. Keys are the flag names; a flag given on
+// the command line overrides the file.
+type fileConfig struct {
+	Symbols          []string          `yaml:"symbols"`
+	SymbolsFile      string            `yaml:"symbols-file"`
+	NormalizeSymbols *bool             `yaml:"normalize-symbols"`
+	Quote            string            `yaml:"quote"`
+	Exclude          []string          `yaml:"exclude"`
+	SymbolsRegex     string            `yaml:"symbols-regex"`
+	Format           string            `yaml:"format"`
+	Rate             int               `yaml:"rate"`
+	Timezone         string            `yaml:"tz"`
+	Out              string            `yaml:"out"`
+	Flatten          *bool             `yaml:"flatten"`
+	QuoteQty         *bool             `yaml:"quote-qty"`
+	StartTime        string            `yaml:"start-time"`
+	EndTime          string            `yaml:"end-time"`
+	MaxFileSize      string            `yaml:"max-file-size"`
+	FinalCompression string            `yaml:"final-compression"`
+	RemoveOriginal   *bool             `yaml:"remove-original"`
+	FileMode         string            `yaml:"file-mode"`
+	DirMode          string            `yaml:"dir-mode"`
+	RangeIndex       *bool             `yaml:"range-index"`
+	WriteConcurrency int               `yaml:"write-concurrency"`
+	MinFree          string            `yaml:"min-free"`
+	JSONFields       map[string]string `yaml:"json-fields"`
+	Weights          map[string]string `yaml:"weights"`
+	WeightLimit      int               `yaml:"weight-limit"`
+
+	PerSymbol map[string]symbolConfig `yaml:"per-symbol"` // 플래그 없음, 심볼별 덮어쓰기
+}
+
+// parseArgs parses the command line and then fills every flag that was not
+// given explicitly from the -config file, if any.
+func parseArgs(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cfg.ConfigFile == "" {
+		return nil
+	}
+	return applyConfigFile(fs, cfg.ConfigFile)
+}
+
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var fc fileConfig
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	v := reflect.ValueOf(fc)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("yaml")
+		if fs.Lookup(name) == nil {
+			continue // per-symbol
+		}
+		value, ok := configValue(v.Field(i))
+		if !ok || explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+	}
+	if err := setSymbolConfigs(fc.PerSymbol); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// configValue renders a set fileConfig field in flag syntax.
+func configValue(field reflect.Value) (string, bool) {
+	switch field.Kind() {
+	case reflect.Pointer:
+		if field.IsNil() {
+			return "", false
+		}
+		return fmt.Sprint(field.Elem().Interface()), true
+	case reflect.Map:
+		if field.Len() == 0 {
+			return "", false
+		}
+		var pairs []string
+		for k, v := range field.Interface().(map[string]string) {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ","), true
+	case reflect.Slice:
+		if field.Len() == 0 {
+			return "", false
+		}
+		return strings.Join(field.Interface().([]string), ","), true
+	default:
+		if field.IsZero() {
+			return "", false
+		}
+		return fmt.Sprint(field.Interface()), true
+	}
+}
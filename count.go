@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const maxWindow = time.Hour // aggTrades rejects startTime/endTime spans of an hour or more
+
+func fetchLatestTrade(symbol string, rl Limiter) (*AggTrade, error) {
+	rl.Wait(aggTradesWeight(1))
+	trades, err := fetchAggTrades(symbol, url.Values{"limit": {"1"}})
+	if err != nil || len(trades) == 0 {
+		return nil, err
+	}
+	return &trades[len(trades)-1], nil
+}
+
+// firstTradeAtOrAfter returns the first trade with a timestamp >= from, or
+// nil when there is none up to latest. One startTime window covers the hour
+// after from; past it, the fromId where trades reach from is binary-searched
+// as earliestTrade does, so a quiet stretch of any length costs about
+// log2(latest.TradeId) requests instead of one per hour.
+func firstTradeAtOrAfter(symbol string, from time.Time, latest *AggTrade, rl Limiter) (*AggTrade, error) {
+	if latest == nil || latest.Timestamp < from.UnixMilli() {
+		return nil, nil
+	}
+	end := from.Add(maxWindow)
+	if latestEnd := time.UnixMilli(latest.Timestamp + 1); latestEnd.Before(end) {
+		end = latestEnd
+	}
+	trades, err := fetchTradesBetween(symbol, from, end, 1, rl)
+	if err != nil || len(trades) > 0 {
+		return firstOf(trades), err
+	}
+	return searchEarliest(latest, func(id int64) (*AggTrade, error) {
+		trade, err := tradeAtId(symbol, id, rl)
+		if err != nil || trade == nil || trade.Timestamp < from.UnixMilli() {
+			return nil, err
+		}
+		return trade, nil
+	})
+}
+
+// firstTradeBetween returns the first trade in [from, to), or nil if there is
+// none.
+func firstTradeBetween(symbol string, from, to time.Time, latest *AggTrade, rl Limiter) (*AggTrade, error) {
+	first, err := firstTradeAtOrAfter(symbol, from, latest, rl)
+	if err != nil || first == nil || first.Timestamp >= to.UnixMilli() {
+		return nil, err
+	}
+	return first, nil
+}
+
+// tradeAtId returns the first trade at or after fromId id, or nil if there is
+// none.
+func tradeAtId(symbol string, id int64, rl Limiter) (*AggTrade, error) {
+	rl.Wait(aggTradesWeight(1))
+	trades, err := fetchAggTrades(symbol, url.Values{"fromId": {strconv.FormatInt(id, 10)}, "limit": {"1"}})
+	return firstOf(trades), err
+}
+
+func firstOf(trades []AggTrade) *AggTrade {
+	if len(trades) == 0 {
+		return nil
+	}
+	return &trades[0]
+}
+
+// fetchTradesBetween returns the first limit trades in [from, to), as one
+// startTime/endTime request would if aggTrades accepted any span. Longer
+// spans are split into consecutive windows shorter than maxWindow, each
+// waiting on rl: a window that returns fewer trades than still wanted is
+// exhausted, so the next one continues right after it without a gap.
+func fetchTradesBetween(symbol string, from, to time.Time, limit int, rl Limiter) ([]AggTrade, error) {
+	var trades []AggTrade
+	for start := from; start.Before(to) && len(trades) < limit; start = start.Add(maxWindow) {
+		want := limit - len(trades)
+		params := url.Values{
+			"startTime": {strconv.FormatInt(start.UnixMilli(), 10)},
+			"endTime":   {strconv.FormatInt(min(start.Add(maxWindow).UnixMilli(), to.UnixMilli())-1, 10)},
+			"limit":     {strconv.Itoa(want)},
+		}
+		rl.Wait(aggTradesWeight(want))
+		page, err := fetchAggTrades(symbol, params)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, page...)
+		if len(page) >= want {
+			break
+		}
+	}
+	return trades, nil
+}
+
+type tradeCount struct {
+	FirstId, LastId       int64 // aggregate trade ids
+	FirstRawId, LastRawId int64 // underlying trade ids (f/l fields)
+	AggTrades, RawTrades  int64
+	FirstTime             time.Time
+}
+
+// countTrades counts the trades in [start, end) from the ids of the first
+// trade at or after start and the first trade at or after end, without
+// downloading the range itself.
+func countTrades(symbol string, start, end time.Time, rl Limiter) (tradeCount, error) {
+	var c tradeCount
+	latest, err := fetchLatestTrade(symbol, rl)
+	if err != nil {
+		return c, err
+	}
+	first, err := firstTradeAtOrAfter(symbol, start, latest, rl)
+	if err != nil || first == nil || first.Timestamp >= end.UnixMilli() {
+		return c, err // 구간 안에 거래 없음
+	}
+
+	lastId, lastRawId := latest.TradeId, latest.LastId
+	if latest.Timestamp >= end.UnixMilli() {
+		after, err := firstTradeAtOrAfter(symbol, end, latest, rl)
+		if err != nil {
+			return c, err
+		}
+		lastId, lastRawId = after.TradeId-1, after.FirstId-1
+	}
+
+	c.FirstId, c.LastId = first.TradeId, lastId
+	c.FirstRawId, c.LastRawId = first.FirstId, lastRawId
+	c.AggTrades = lastId - first.TradeId + 1
+	c.RawTrades = lastRawId - first.FirstId + 1
+	c.FirstTime = time.UnixMilli(first.Timestamp).UTC()
+	return c, nil
+}
+
+func runCountOnly(symbols []string, rl Limiter) {
+	start, end := cfg.StartTime.Time, cfg.EndTime.Time
+	if end.IsZero() {
+		end = time.Now().UTC()
+	}
+	fmt.Printf("Counting trades in [%s, %s)\n", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	for _, symbol := range symbols {
+		c, err := countTrades(symbol, start, end, rl)
+		if err != nil {
+			fmt.Printf("%s: error: %v\n", symbol, err)
+			continue
+		}
+		if c.AggTrades == 0 {
+			fmt.Printf("%s: 0 trades\n", symbol)
+			continue
+		}
+		fmt.Printf("%s: %d aggTrades (ids %d-%d), %d trades (ids %d-%d), first at %s\n",
+			symbol, c.AggTrades, c.FirstId, c.LastId, c.RawTrades, c.FirstRawId, c.LastRawId, c.FirstTime.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// windowServer is a fake aggTrades endpoint over trades, in id order, that
+// answers fromId and startTime/endTime requests and rejects spans of an hour
+// or more as Binance does. It records the windows and fromIds it was asked
+// for.
+type windowServer struct {
+	trades   []AggTrade
+	windows  [][2]int64 // startTime, endTime
+	fromIds  []int64
+	requests int
+}
+
+func (s *windowServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests++
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		limit = limitPerReq
+	}
+	page := []AggTrade{}
+	switch {
+	case q.Has("startTime"):
+		start, _ := strconv.ParseInt(q.Get("startTime"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("endTime"), 10, 64)
+		s.windows = append(s.windows, [2]int64{start, end})
+		if end-start >= time.Hour.Milliseconds() {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":-1127,"msg":"More than 1 hours between startTime and endTime."}`))
+			return
+		}
+		for _, t := range s.trades {
+			if t.Timestamp >= start && t.Timestamp <= end && len(page) < limit {
+				page = append(page, t)
+			}
+		}
+	case q.Has("fromId"):
+		from, _ := strconv.ParseInt(q.Get("fromId"), 10, 64)
+		s.fromIds = append(s.fromIds, from)
+		for _, t := range s.trades {
+			if t.TradeId >= from && len(page) < limit {
+				page = append(page, t)
+			}
+		}
+	default:
+		page = append(page, s.trades[max(len(s.trades)-limit, 0):]...)
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+// serveWindows starts a windowServer with one trade at each offset from
+// base, ids counting from 0, and points apiURL at it.
+func serveWindows(t *testing.T, base time.Time, offsets ...time.Duration) *windowServer {
+	t.Helper()
+	s := &windowServer{}
+	for i, d := range offsets {
+		s.trades = append(s.trades, AggTrade{TradeId: int64(i), FirstId: int64(i), LastId: int64(i), Timestamp: base.Add(d).UnixMilli()})
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	old := apiURL
+	apiURL = srv.URL + "/api/v3/aggTrades"
+	t.Cleanup(func() { apiURL = old })
+	return s
+}
+
+var windowBase = time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+func TestFetchTradesBetweenStitchesWindows(t *testing.T) {
+	h := time.Hour
+	tests := []struct {
+		name     string
+		offsets  []time.Duration
+		from, to time.Duration
+		limit    int
+		wantIds  []int64
+		requests int
+	}{
+		{"within the first hour", []time.Duration{10 * time.Minute, 20 * time.Minute}, 0, 6 * h, 5, []int64{0, 1}, 6},
+		{"first trade hours in", []time.Duration{3*h + time.Minute}, 0, 6 * h, 1, []int64{0}, 4},
+		{"trades on the window edges", []time.Duration{h - time.Millisecond, h, 2*h - time.Millisecond, 2 * h}, 0, 3 * h, 10, []int64{0, 1, 2, 3}, 3},
+		{"limit spans windows", []time.Duration{30 * time.Minute, 90 * time.Minute, 150 * time.Minute, 210 * time.Minute}, 0, 6 * h, 3, []int64{0, 1, 2}, 3},
+		{"end is exclusive", []time.Duration{h + 30*time.Minute, 2 * h}, 0, 2 * h, 5, []int64{0}, 2},
+		{"span shorter than an hour", []time.Duration{5 * time.Minute}, 0, 10 * time.Minute, 5, []int64{0}, 1},
+		{"nothing in the span", []time.Duration{7 * h}, 0, 6 * h, 1, nil, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := serveWindows(t, windowBase, tt.offsets...)
+			from, to := windowBase.Add(tt.from), windowBase.Add(tt.to)
+			trades, err := fetchTradesBetween("BTCUSDT", from, to, tt.limit, noLimit{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int64
+			for _, trade := range trades {
+				ids = append(ids, trade.TradeId)
+			}
+			if !slices.Equal(ids, tt.wantIds) {
+				t.Errorf("got ids %v, want %v", ids, tt.wantIds)
+			}
+			if s.requests != tt.requests {
+				t.Errorf("%d requests, want %d", s.requests, tt.requests)
+			}
+			// 창은 from에서 시작해 빈틈 없이 이어지고 to를 넘지 않음
+			next := from.UnixMilli()
+			for _, w := range s.windows {
+				if w[0] != next {
+					t.Errorf("window starts at %+d ms, want %+d", w[0]-windowBase.UnixMilli(), next-windowBase.UnixMilli())
+				}
+				if w[1] >= to.UnixMilli() {
+					t.Errorf("window ends at %+d ms, past the end of the span", w[1]-windowBase.UnixMilli())
+				}
+				next = w[1] + 1
+			}
+		})
+	}
+}
+
+func TestFirstTradeAtOrAfter(t *testing.T) {
+	day := 24 * time.Hour
+	// 거래 1000개: 처음 500개는 1분 간격, 그 뒤 30일 공백, 나머지 다시 1분 간격
+	var offsets []time.Duration
+	for i := range 1000 {
+		d := time.Duration(i) * time.Minute
+		if i >= 500 {
+			d += 30 * day
+		}
+		offsets = append(offsets, d)
+	}
+	gapEnd := 30*day + 500*time.Minute
+	tests := []struct {
+		name    string
+		from    time.Duration
+		wantId  int64 // -1: nil
+		maxReqs int
+	}{
+		{"an hour before the first trade", -time.Hour, 0, 2},
+		{"just before the first trade", -time.Minute, 0, 1},
+		{"on a trade", 100 * time.Minute, 100, 1},
+		{"between trades", 100*time.Minute + time.Second, 101, 1},
+		{"in the gap", 10 * day, 500, 1 + 11},
+		{"just before the gap ends", gapEnd - time.Millisecond, 500, 1},
+		{"after the gap", gapEnd + 10*time.Minute, 510, 1},
+		{"the latest trade", gapEnd + 499*time.Minute, 999, 1},
+		{"after the latest trade", gapEnd + 500*time.Minute, -1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := serveWindows(t, windowBase, offsets...)
+			latest := s.trades[len(s.trades)-1]
+			got, err := firstTradeAtOrAfter("BTCUSDT", windowBase.Add(tt.from), &latest, noLimit{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.wantId < 0 && got != nil:
+				t.Errorf("got trade %d, want none", got.TradeId)
+			case tt.wantId >= 0 && (got == nil || got.TradeId != tt.wantId):
+				t.Errorf("got %v, want trade %d", got, tt.wantId)
+			}
+			if s.requests > tt.maxReqs {
+				t.Errorf("%d requests, want at most %d", s.requests, tt.maxReqs)
+			}
+			for _, w := range s.windows {
+				if w[1]-w[0] >= time.Hour.Milliseconds() {
+					t.Errorf("window of %d ms", w[1]-w[0])
+				}
+			}
+		})
+	}
+}
+
+func TestFirstTradeBetween(t *testing.T) {
+	s := serveWindows(t, windowBase, 0, 5*time.Hour)
+	latest := s.trades[1]
+	for _, tt := range []struct {
+		from, to time.Duration
+		wantId   int64
+	}{
+		{time.Minute, 4 * time.Hour, -1},
+		{time.Minute, 6 * time.Hour, 1},
+		{0, time.Hour, 0},
+	} {
+		got, err := firstTradeBetween("BTCUSDT", windowBase.Add(tt.from), windowBase.Add(tt.to), &latest, noLimit{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (tt.wantId < 0) != (got == nil) || got != nil && got.TradeId != tt.wantId {
+			t.Errorf("[%v, %v): got %v, want %d", tt.from, tt.to, got, tt.wantId)
+		}
+	}
+}
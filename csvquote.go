@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvQuoteModes are the accepted -csv-quote values: minimal quotes only the
+// fields that need it (encoding/csv), all quotes every field, and none
+// never quotes and fails on a field that would need it.
+var csvQuoteModes = []string{"minimal", "all", "none"}
+
+// csvRowWriter is the part of *csv.Writer the CSV writers use.
+type csvRowWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// newCSVWriter returns a writer for -csv-quote and -csv-crlf.
+func newCSVWriter(w io.Writer) csvRowWriter {
+	switch cfg.CSVQuote {
+	case "all", "none":
+		return &quotingWriter{w: bufio.NewWriter(w), all: cfg.CSVQuote == "all", crlf: cfg.CSVCRLF}
+	}
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = cfg.CSVCRLF
+	return cw
+}
+
+// quotingWriter writes -csv-quote=all or none rows.
+type quotingWriter struct {
+	w    *bufio.Writer
+	all  bool
+	crlf bool
+	err  error
+}
+
+func (q *quotingWriter) Write(record []string) error {
+	if q.err != nil {
+		return q.err
+	}
+	for i, field := range record {
+		if i > 0 {
+			q.w.WriteByte(',')
+		}
+		switch {
+		case q.all:
+			q.w.WriteByte('"')
+			q.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+			q.w.WriteByte('"')
+		case strings.ContainsAny(field, ",\"\r\n") || (field == "" && len(record) == 1):
+			q.err = fmt.Errorf("-csv-quote=none cannot write field %q, which needs quoting", field)
+			return q.err
+		default:
+			q.w.WriteString(field)
+		}
+	}
+	if q.crlf {
+		q.w.WriteString("\r\n")
+	} else {
+		q.w.WriteByte('\n')
+	}
+	return nil
+}
+
+// writeAll writes records and flushes, like (*csv.Writer).WriteAll.
+func writeAll(w csvRowWriter, records [][]string) error {
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func (q *quotingWriter) Flush() {
+	if err := q.w.Flush(); err != nil && q.err == nil {
+		q.err = err
+	}
+}
+
+func (q *quotingWriter) Error() error {
+	return q.err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCSVQuoteModes(t *testing.T) {
+	defer func(mode string, crlf bool) { cfg.CSVQuote, cfg.CSVCRLF = mode, crlf }(cfg.CSVQuote, cfg.CSVCRLF)
+	tests := []struct {
+		mode    string
+		crlf    bool
+		record  []string
+		want    string
+		wantErr bool
+	}{
+		{"minimal", false, []string{"1", "42000.01", "0.5"}, "1,42000.01,0.5\n", false},
+		{"minimal", false, []string{"1", "a,b", `say "hi"`}, "1,\"a,b\",\"say \"\"hi\"\"\"\n", false},
+		{"minimal", false, []string{"1", "two\nlines"}, "1,\"two\nlines\"\n", false},
+		{"minimal", true, []string{"1", "2"}, "1,2\r\n", false},
+		{"all", false, []string{"1", "42000.01", "true"}, "\"1\",\"42000.01\",\"true\"\n", false},
+		{"all", false, []string{"a,b", `say "hi"`, ""}, "\"a,b\",\"say \"\"hi\"\"\",\"\"\n", false},
+		{"all", true, []string{"1"}, "\"1\"\r\n", false},
+		{"none", false, []string{"1", "42000.01", "", "true"}, "1,42000.01,,true\n", false},
+		{"none", true, []string{"1", "2"}, "1,2\r\n", false},
+		{"none", false, []string{"1", "a,b"}, "", true},
+		{"none", false, []string{"1", `say "hi"`}, "", true},
+		{"none", false, []string{"two\nlines"}, "", true},
+		{"none", false, []string{""}, "", true}, // 빈 줄로 읽힘
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+strings.Join(tt.record, "|"), func(t *testing.T) {
+			cfg.CSVQuote, cfg.CSVCRLF = tt.mode, tt.crlf
+			var buf bytes.Buffer
+			err := writeAll(newCSVWriter(&buf), [][]string{tt.record})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if buf.String() != tt.want {
+				t.Errorf("wrote %q, want %q", buf.String(), tt.want)
+			}
+			read, err := csv.NewReader(&buf).Read()
+			if err != nil {
+				t.Fatalf("reading back %q: %v", tt.want, err)
+			}
+			if !slices.Equal(read, tt.record) {
+				t.Errorf("read back %q, want %q", read, tt.record)
+			}
+		})
+	}
+}
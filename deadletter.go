@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deadLetters tracks the space used by <symbol>/dead_letter files, across
+// every symbol and including files left by earlier runs, against
+// -dead-letter-max.
+var deadLetters struct {
+	mu      sync.Mutex
+	scanned bool
+	used    int64
+	full    bool // 한도 도달을 이미 알림
+}
+
+func deadLetterDir(symbol string) string {
+	return filepath.Join(symbolDir(symbol), "dead_letter")
+}
+
+// saveDeadLetter keeps a response that could not be decoded: the request
+// URL, status and error, then the raw body. Nothing is written once the
+// files would exceed -dead-letter-max.
+func saveDeadLetter(symbol, url string, status int, body []byte, decodeErr error) {
+	if cfg.DeadLetterMax <= 0 {
+		return
+	}
+	now := time.Now().UTC()
+	var b strings.Builder
+	fmt.Fprintf(&b, "url: %s\nstatus: %d\ntime: %s\nerror: %v\nbody (%d bytes):\n", url, status, now.Format(time.RFC3339Nano), decodeErr, len(body))
+	data := append([]byte(b.String()), body...)
+
+	deadLetters.mu.Lock()
+	defer deadLetters.mu.Unlock()
+	if !deadLetters.scanned {
+		deadLetters.used, deadLetters.scanned = deadLetterUsage(), true
+	}
+	if deadLetters.used+int64(len(data)) > int64(cfg.DeadLetterMax) {
+		if !deadLetters.full {
+			fmt.Printf("Warning: dead-letter files reached -dead-letter-max=%s; not keeping more malformed responses\n", cfg.DeadLetterMax.String())
+			deadLetters.full = true
+		}
+		return
+	}
+	dir := deadLetterDir(symbol)
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.txt", symbol, now.Format("20060102T150405.000000000Z")))
+	err := os.MkdirAll(dir, cfg.DirMode.Perm())
+	if err == nil {
+		err = os.WriteFile(path, data, cfg.FileMode.Perm())
+	}
+	if err != nil {
+		fmt.Printf("Error saving dead letter for %s: %v\n", symbol, err)
+		return
+	}
+	deadLetters.used += int64(len(data))
+	fmt.Printf("Saved malformed response for %s to %s\n", symbol, path)
+}
+
+// deadLetterUsage is the size of the dead-letter files already under -out.
+func deadLetterUsage() int64 {
+	var total int64
+	dirs, _ := filepath.Glob(filepath.Join(cfg.OutDir, "*", "dead_letter"))
+	dirs = append(dirs, filepath.Join(cfg.OutDir, "dead_letter")) // -flatten
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if info, err := d.Info(); err == nil && !d.IsDir() {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	return total
+}
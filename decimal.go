@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// mulDecimal multiplies two decimal strings exactly, without going through float64.
+func mulDecimal(a, b string) (string, error) {
+	x, xs, err := parseDecimal(a)
+	if err != nil {
+		return "", err
+	}
+	y, ys, err := parseDecimal(b)
+	if err != nil {
+		return "", err
+	}
+	return formatDecimal(new(big.Int).Mul(x, y), xs+ys), nil
+}
+
+func parseDecimal(s string) (*big.Int, int, error) {
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	n, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid decimal %q", s)
+	}
+	return n, len(fracPart), nil
+}
+
+func formatDecimal(n *big.Int, scale int) string {
+	neg := n.Sign() < 0
+	digits := new(big.Int).Abs(n).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	intPart, fracPart := digits[:len(digits)-scale], strings.TrimRight(digits[len(digits)-scale:], "0")
+	s := intPart
+	if fracPart != "" {
+		s += "." + fracPart
+	}
+	if neg && s != "0" {
+		s = "-" + s
+	}
+	return s
+}
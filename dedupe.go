@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// runDedupe implements the dedupe subcommand: it rewrites a symbol's CSV
+// date files without rows whose tradeId already appeared earlier in the same
+// date (across its parts), keeping the first copy.
+func runDedupe(args []string) int {
+	fs := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	registerFlags(fs)
+	if err := parseArgs(fs, args); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	symbols, err := explicitSymbols()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if !flagWasSet(fs, "symbols") && cfg.SymbolsFile == "" {
+		if symbols, err = listSymbolDirs(cfg.OutDir); err != nil {
+			fmt.Printf("Error listing %s: %v\n", cfg.OutDir, err)
+			return 1
+		}
+	}
+
+	release, err := acquireOutLock(cfg.OutDir, cfg.LockWait)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer release()
+
+	failed := false
+	for _, symbol := range symbols {
+		if err := dedupeSymbol(symbol); err != nil {
+			fmt.Printf("Error deduplicating %s: %v\n", symbol, err)
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func dedupeSymbol(symbol string) error {
+	dates, err := listDateFilesIn(cfg.OutDir, symbol, ".csv")
+	if err != nil {
+		return err
+	}
+	m, err := loadManifestIn(cfg.OutDir, symbol)
+	if err != nil {
+		return err
+	}
+	total := 0
+	for _, date := range dates {
+		paths := datePartPaths(cfg.OutDir, symbol, date, ".csv")
+		minId, maxId, err := tradeIdRange(paths)
+		if err != nil {
+			return err
+		}
+		if minId > maxId {
+			continue // 빈 파일
+		}
+		seen := newIdSet(minId, maxId)
+		for _, path := range paths {
+			removed, err := dedupeFile(path, seen)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if removed == 0 {
+				continue
+			}
+			fmt.Printf("%s: removed %d duplicate rows\n", path, removed)
+			total += removed
+			if r, ok := m.Files[filepath.Base(path)]; ok {
+				r.Rows -= int64(removed)
+				m.dirty = true
+			}
+		}
+	}
+	fmt.Printf("%s: %d duplicate rows removed\n", symbol, total)
+	if len(m.Files) > 0 {
+		return m.save()
+	}
+	return nil
+}
+
+// tradeIdRange is the first pass over a date's files: the lowest and highest
+// tradeId, so the second pass can track seen ids in a bitmap instead of a map.
+func tradeIdRange(paths []string) (minId, maxId int64, err error) {
+	minId, maxId = 1, 0
+	for _, path := range paths {
+		_, err := eachCSVRow(path, func(id int64, _ []string) error {
+			if minId > maxId {
+				minId, maxId = id, id
+			}
+			minId, maxId = min(minId, id), max(maxId, id)
+			return nil
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return minId, maxId, nil
+}
+
+// dedupeFile rewrites path without rows whose tradeId is already in seen,
+// adding the file's ids to seen. Duplicates are counted first so a clean
+// file is not rewritten; otherwise the rows are written to a temporary file
+// that is renamed over path.
+func dedupeFile(path string, seen *idSet) (int, error) {
+	before := seen.clone()
+	removed := 0
+	header, err := eachCSVRow(path, func(id int64, _ []string) error {
+		if seen.has(id) {
+			removed++
+		}
+		seen.add(id)
+		return nil
+	})
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	tmp := path + ".dedupe.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp) // rename에 성공하면 이미 없음
+
+	w := newCSVWriter(out)
+	err = w.Write(header)
+	if err == nil {
+		_, err = eachCSVRow(path, func(id int64, record []string) error {
+			if before.has(id) {
+				return nil
+			}
+			before.add(id)
+			return w.Write(record)
+		})
+	}
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return removed, os.Rename(tmp, path)
+}
+
+// eachCSVRow streams the rows of a date file after its header, passing the
+// tradeId in the first column, and returns the header.
+func eachCSVRow(path string, fn func(id int64, record []string) error) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	header = slices.Clone(header)
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return header, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad tradeId %q", line, record[0])
+		}
+		if err := fn(id, record); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// idSet is a bitmap of the tradeIds in [min, max].
+type idSet struct {
+	min, max int64
+	bits     []uint64
+}
+
+func newIdSet(minId, maxId int64) *idSet {
+	return &idSet{min: minId, max: maxId, bits: make([]uint64, (maxId-minId)/64+1)}
+}
+
+func (s *idSet) has(id int64) bool {
+	i := id - s.min
+	return s.bits[i/64]&(1<<(i%64)) != 0
+}
+
+func (s *idSet) add(id int64) {
+	i := id - s.min
+	s.bits[i/64] |= 1 << (i % 64)
+}
+
+func (s *idSet) clone() *idSet {
+	return &idSet{min: s.min, max: s.max, bits: slices.Clone(s.bits)}
+}
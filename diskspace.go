@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const diskCheckInterval = 30 * time.Second
+
+var errFreeSpaceUnsupported = errors.New("free space check not supported on this platform")
+
+var diskGuard struct {
+	mu        sync.Mutex
+	lastCheck time.Time
+	err       error
+}
+
+func startupDiskCheck() error {
+	free, err := freeSpace(cfg.OutDir)
+	if err != nil {
+		if cfg.MinFree > 0 {
+			fmt.Printf("Warning: cannot check free space on %s: %v\n", cfg.OutDir, err)
+		}
+	} else {
+		fmt.Printf("Free space on %s: %.1f GB\n", cfg.OutDir, float64(free)/(1<<30))
+		if cfg.MinFree > 0 && free < uint64(cfg.MinFree) {
+			return fmt.Errorf("free space on %s (%d bytes) is below -min-free=%s", cfg.OutDir, free, cfg.MinFree.String())
+		}
+	}
+
+	inodes, err := freeInodes(cfg.OutDir)
+	if err != nil {
+		if cfg.MinFreeInodes > 0 {
+			fmt.Printf("Warning: cannot check free inodes on %s: %v\n", cfg.OutDir, err)
+		}
+		return nil
+	}
+	fmt.Printf("Free inodes on %s: %d\n", cfg.OutDir, inodes)
+	if cfg.MinFreeInodes > 0 && inodes < cfg.MinFreeInodes {
+		return fmt.Errorf("free inodes on %s (%d) are below -min-free-inodes=%d", cfg.OutDir, inodes, cfg.MinFreeInodes)
+	}
+	return nil
+}
+
+// checkDiskSpace re-reads free space and inodes at most every
+// diskCheckInterval, so it is cheap to call before every page write.
+func checkDiskSpace() error {
+	if cfg.MinFree <= 0 && cfg.MinFreeInodes == 0 {
+		return nil
+	}
+	diskGuard.mu.Lock()
+	defer diskGuard.mu.Unlock()
+
+	if time.Since(diskGuard.lastCheck) < diskCheckInterval {
+		return diskGuard.err
+	}
+	diskGuard.lastCheck = time.Now()
+	diskGuard.err = nil
+	if cfg.MinFree > 0 {
+		if free, err := freeSpace(cfg.OutDir); err == nil && free < uint64(cfg.MinFree) {
+			diskGuard.err = fmt.Errorf("low disk space on %s: %d bytes free, -min-free=%s", cfg.OutDir, free, cfg.MinFree.String())
+			return diskGuard.err
+		}
+	}
+	if cfg.MinFreeInodes > 0 {
+		if inodes, err := freeInodes(cfg.OutDir); err == nil && inodes < cfg.MinFreeInodes {
+			diskGuard.err = fmt.Errorf("low free inodes on %s: %d free, -min-free-inodes=%d", cfg.OutDir, inodes, cfg.MinFreeInodes)
+		}
+	}
+	return diskGuard.err
+}
+
+// manyFiles is the projected file count above which startup warns.
+const manyFiles = 100_000
+
+// binanceLaunch bounds how far back a run without -start-time can reach.
+var binanceLaunch = time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC)
+
+// warnFileCount estimates how many date files the run can create (one per
+// symbol, interval and day of the window, or since Binance launched without
+// -start-time) and warns when that is very large or more than the free
+// inodes. Chunked output (-trades-per-file) depends on volume and is not
+// estimated.
+func warnFileCount(symbols []string, intervals []string) {
+	if cfg.TradesPerFile > 0 {
+		return
+	}
+	start, end := collectWindow()
+	if start.IsZero() {
+		start = binanceLaunch
+	}
+	if end.IsZero() || end.After(time.Now()) {
+		end = time.Now()
+	}
+	days := int64(end.Sub(start).Hours()/24) + 1
+	streams := int64(len(symbols) * max(len(intervals), 1))
+	projected := streams * days
+	inodes, inodeErr := freeInodes(cfg.OutDir)
+	if projected < manyFiles && (inodeErr != nil || uint64(projected) < inodes) {
+		return
+	}
+	fmt.Printf("Warning: this run may create up to %d date files (%d streams x %d days)\n", projected, streams, days)
+	if inodeErr == nil && uint64(projected) >= inodes {
+		fmt.Printf("Warning: that is more than the %d free inodes on %s\n", inodes, cfg.OutDir)
+	}
+	fmt.Println("  Fewer, larger files: -trades-per-file=N; a narrower -start-time/-end-time; -min-free-inodes to stop before the volume runs out")
+}
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+func freeSpace(path string) (uint64, error) {
+	return 0, errFreeSpaceUnsupported
+}
+
+func freeInodes(path string) (uint64, error) {
+	return 0, errFreeSpaceUnsupported
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// errorWindow is the outcome of the last -error-rate-window fetches.
+type errorWindow struct {
+	failed []bool
+	next   int
+	n      int // 채워진 칸 수
+	errors int
+}
+
+func (w *errorWindow) add(failed bool) {
+	if w.failed == nil {
+		w.failed = make([]bool, cfg.ErrorRateWindow)
+	}
+	if w.n == len(w.failed) {
+		if w.failed[w.next] {
+			w.errors--
+		}
+	} else {
+		w.n++
+	}
+	w.failed[w.next] = failed
+	if failed {
+		w.errors++
+	}
+	w.next = (w.next + 1) % len(w.failed)
+}
+
+// exceeds reports whether the window is full and more than max of it
+// failed.
+func (w *errorWindow) exceeds(max float64) bool {
+	return max > 0 && w.n == len(w.failed) && float64(w.errors) > max*float64(w.n)
+}
+
+func (w *errorWindow) String() string {
+	return fmt.Sprintf("%d of the last %d fetches failed (%.0f%%)", w.errors, w.n, 100*float64(w.errors)/float64(max(w.n, 1)))
+}
+
+// errorRates tracks failed aggTrades fetches for -max-error-rate, over the
+// whole run, and -max-symbol-error-rate, per symbol.
+type errorRates struct {
+	mu      sync.Mutex
+	all     errorWindow
+	symbols map[string]*errorWindow
+	tripped bool
+	abort   func(error) // runContext가 설정
+}
+
+var fetchErrors = &errorRates{symbols: make(map[string]*errorWindow)}
+
+// record counts one fetch. Once the run's rate is over -max-error-rate it
+// aborts the run, like -deadline.
+func (e *errorRates) record(symbol string, err error) {
+	if cfg.MaxErrorRate <= 0 && cfg.MaxSymbolErrorRate <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.all.add(err != nil)
+	w := e.symbols[symbol]
+	if w == nil {
+		w = &errorWindow{}
+		e.symbols[symbol] = w
+	}
+	w.add(err != nil)
+	if e.all.exceeds(cfg.MaxErrorRate) && !e.tripped && e.abort != nil {
+		e.tripped = true
+		reason := fmt.Errorf("-max-error-rate=%g exceeded: %v", cfg.MaxErrorRate, &e.all)
+		fmt.Printf("%v; the API looks degraded, stopping...\n", reason)
+		e.abort(reason)
+	}
+}
+
+// symbolExceeded returns the error to stop symbol with once its own rate is
+// over -max-symbol-error-rate.
+func (e *errorRates) symbolExceeded(symbol string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if w := e.symbols[symbol]; w != nil && w.exceeds(cfg.MaxSymbolErrorRate) {
+		return fmt.Errorf("-max-symbol-error-rate=%g exceeded: %v", cfg.MaxSymbolErrorRate, w)
+	}
+	return nil
+}
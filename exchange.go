@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// exchangeProfile is what -exchange selects: the REST base, the request
+// weights and per-minute weight budget documented for it, and the response
+// header reporting the weight used. The API shape and paging are the same on
+// every exchange.
+type exchangeProfile struct {
+	apiBase      string
+	weights      []weightRule
+	weightLimit  int // 0: -rate 요청분의 가중치
+	weightHeader string
+}
+
+const spotWeightHeader = "X-MBX-USED-WEIGHT-1M"
+
+// usWeights are Binance.US's REQUEST_WEIGHT costs, which are lower than the
+// global exchange's for the same endpoints.
+var usWeights = []weightRule{
+	{"aggTrades", 0, 1},
+	{"klines", 0, 1},
+	{"exchangeInfo", 0, 10},
+	{"ticker/bookTicker", 1, 1},
+	{"ticker/bookTicker", 0, 2},
+	{"ticker/24hr", 1, 1},
+	{"ticker/24hr", 0, 40},
+	{"ping", 0, 1},
+	{"time", 0, 1},
+}
+
+var exchanges = map[string]exchangeProfile{
+	"global": {apiBase: defaultAPIBase, weights: defaultWeights, weightHeader: spotWeightHeader},
+	"us":     {apiBase: "https://api.binance.us/api/v3", weights: usWeights, weightLimit: 1199, weightHeader: spotWeightHeader}, // 1200 - 1, like maxReqPerMin
+}
+
+// exchange is the -exchange profile in use; configureExchange sets it.
+var exchange = exchanges["global"]
+
+// configureExchange applies -exchange: its endpoints (which -base-url may
+// still replace) and its default request weights.
+func configureExchange(name string) error {
+	ex, ok := exchanges[name]
+	if !ok {
+		names := make([]string, 0, len(exchanges))
+		for n := range exchanges {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("invalid -exchange %q (want %s)", name, strings.Join(names, " or "))
+	}
+	exchange, weights = ex, ex.weights
+	return configureEndpoints(ex.apiBase)
+}
+
+// weightHeader is the response header with the weight used this minute:
+// -weight-header, or the exchange's.
+func weightHeader() string {
+	if cfg.WeightHeader != "" {
+		return cfg.WeightHeader
+	}
+	return exchange.weightHeader
+}
+
+var weightHeaderMissing atomic.Bool
+
+// logUsedWeight logs, with -debug, the weight the server reports as used
+// this minute, for comparing with the limiter's own count.
+func logUsedWeight(symbol string, h http.Header) {
+	if !cfg.Debug {
+		return
+	}
+	name := weightHeader()
+	used := h.Get(name)
+	if used == "" {
+		if !weightHeaderMissing.Swap(true) {
+			fmt.Printf("sym(%s) the response has no %s header; set -weight-header if the API reports it under another name\n", symbol, name)
+		}
+		return
+	}
+	n, err := strconv.Atoi(used)
+	if err != nil {
+		fmt.Printf("sym(%s) unreadable %s header %q\n", symbol, name, used)
+		return
+	}
+	fmt.Printf("sym(%s) server used weight: %d (%s)\n", symbol, n, name)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// onExistingPolicies are the -on-existing values: what a collection does
+// with a symbol that already has files in -out.
+var onExistingPolicies = []string{"append", "resume", "fail", "overwrite"}
+
+func parseOnExisting(s string) error {
+	if s == "" || slices.Contains(onExistingPolicies, s) {
+		return nil
+	}
+	return fmt.Errorf("invalid -on-existing %q: want append, resume, fail or overwrite", s)
+}
+
+// existingPolicy looks for files of the symbol already in -out and decides
+// what to do with them (see choosePolicy). -full-history also resumes from
+// the dates its manifest marks finished. Date files moved into -archive
+// files are no longer on disk, so their tradeIds come from the manifest.
+// policy is "" when there are no files; lo and hi are the lowest and
+// highest tradeId on disk, which a resume continues from, and ok is false
+// when the files have none.
+func existingPolicy(symbol string) (policy string, lo, hi int64, ok bool, err error) {
+	if cfg.FifoDir != "" {
+		return "", 0, 0, false, nil // 파일을 쓰지 않음
+	}
+	listed, err := listSymbolFiles(symbol)
+	if err != nil {
+		return "", 0, 0, false, err
+	}
+	var files []listedFile // 다른 -format의 파일은 건드리지 않음
+	for _, f := range listed {
+		name := strings.TrimSuffix(strings.TrimSuffix(f.File, ".gz"), ".zst")
+		if filepath.Ext(name) == "."+formatFor(symbol) {
+			files = append(files, f)
+		}
+	}
+	archives, err := archivePaths(symbol)
+	if err != nil {
+		return "", 0, 0, false, err
+	}
+	if len(files) == 0 && len(archives) == 0 {
+		return "", 0, 0, false, nil
+	}
+	if formatFor(symbol) == "csv" && !discardFields["tradeId"] {
+		if lo, hi, ok, err = tradeIdBoundsOnDisk(symbol); err != nil {
+			return "", 0, 0, false, err
+		}
+	}
+	checkpoint, found := ok, "the files have tradeIds"
+	if len(archives) > 0 {
+		m, err := loadManifestIn(cfg.OutDir, symbol)
+		if err != nil {
+			return "", 0, 0, false, err
+		}
+		for _, r := range m.Files {
+			if !ok || r.MinId < lo {
+				lo = r.MinId
+			}
+			if !ok || r.MaxId > hi {
+				hi = r.MaxId
+			}
+			ok = true
+		}
+		checkpoint, found = ok, "the files and the manifest of the archived ones have tradeIds"
+	}
+	if cfg.FullHistory && !ok {
+		m, err := loadManifestIn(cfg.OutDir, symbol)
+		if err != nil {
+			return "", 0, 0, false, err
+		}
+		checkpoint, found = len(m.Complete) > 0, "the manifest marks finished dates"
+	}
+	policy = choosePolicy(symbol, symbolDir(symbol), len(files)+len(archives), checkpoint, found)
+	if policy == "overwrite" {
+		err = removeSymbolData(symbol, files, archives)
+	}
+	return policy, lo, hi, ok, err
+}
+
+// choosePolicy decides what a collection does with the files it already
+// has and logs the choice: -on-existing if set, resume with -update, and
+// otherwise resume when the files hold a checkpoint to continue from and
+// fail when they don't, so a rerun never writes the same rows twice. Only
+// -on-existing=append adds to the files regardless.
+func choosePolicy(name, dir string, files int, checkpoint bool, found string) string {
+	policy, reason := cfg.OnExisting, "-on-existing"
+	switch {
+	case policy != "":
+	case cfg.Update:
+		policy, reason = "resume", "-update"
+	case checkpoint:
+		policy, reason = "resume", "default: "+found
+	default:
+		policy, reason = "fail", "default: nothing to resume from"
+	}
+	fmt.Printf("%s already has %d file(s) in %s: %s (%s)\n", name, files, dir, policy, reason)
+	return policy
+}
+
+// removeSymbolData deletes a symbol's date and chunk files, its archives
+// and the state kept next to them (-on-existing=overwrite), so collection
+// starts clean.
+func removeSymbolData(symbol string, files []listedFile, archives []string) error {
+	paths := []string{manifestPathIn(cfg.OutDir, symbol), rangeIndexPath(symbol), symbolPath(symbol, "index.csv"), symbolPath(symbol, "failed_ranges.log")}
+	for _, f := range files {
+		paths = append(paths, filepath.Join(cfg.OutDir, f.File))
+	}
+	paths = append(paths, archives...)
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	fmt.Printf("Removed %d existing file(s) of %s\n", len(files)+len(archives), symbol)
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDateFiles writes CSV files of tradeIds into a temporary -out, by file
+// name, and points cfg at it.
+func writeDateFiles(t *testing.T, files map[string][]string) {
+	t.Helper()
+	cfg.OutDir, cfg.FileMode, cfg.TradesPerFile = t.TempDir(), 0o644, 0
+	dir := filepath.Join(cfg.OutDir, "BTCUSDT")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, ids := range files {
+		var b strings.Builder
+		b.WriteString("tradeId,price,quantity\n")
+		for _, id := range ids {
+			b.WriteString(id + ",1.0,2\n")
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTradeIdBoundsOnDisk(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string][]string
+		lo, hi int64
+		ok     bool
+	}{
+		{"none", nil, 0, 0, false},
+		{"header only", map[string][]string{"2023-11-14.csv": nil}, 0, 0, false},
+		{"ascending", map[string][]string{
+			"2023-11-14.csv": {"0", "1", "2"},
+			"2023-11-15.csv": {"3", "4"},
+		}, 0, 4, true},
+		{"newest first", map[string][]string{
+			"2023-11-15.csv": {"4321", "4320"},
+			"2023-11-14.csv": {"4319", "4000"},
+		}, 4000, 4321, true},
+		{"parts", map[string][]string{
+			"2023-11-14.csv":       {"5", "6"},
+			"2023-11-14.part2.csv": {"7", "8"},
+		}, 5, 8, true},
+		{"empty newest date", map[string][]string{
+			"2023-11-14.csv": {"10", "11"},
+			"2023-11-15.csv": nil,
+		}, 10, 11, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeDateFiles(t, tt.files)
+			lo, hi, ok, err := tradeIdBoundsOnDisk("BTCUSDT")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lo != tt.lo || hi != tt.hi || ok != tt.ok {
+				t.Errorf("got (%d, %d, %v), want (%d, %d, %v)", lo, hi, ok, tt.lo, tt.hi, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTradeIdBoundsOnDiskCompressed(t *testing.T) {
+	for _, method := range []string{"gzip", "zstd"} {
+		t.Run(method, func(t *testing.T) {
+			writeDateFiles(t, map[string][]string{
+				"2023-11-14.csv": {"0", "1"},
+				"2023-11-15.csv": {"2", "3"},
+			})
+			path := filepath.Join(cfg.OutDir, "BTCUSDT", "2023-11-15.csv")
+			if err := compressFile(path, method); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+			lo, hi, ok, err := tradeIdBoundsOnDisk("BTCUSDT")
+			if err != nil || lo != 0 || hi != 3 || !ok {
+				t.Errorf("got (%d, %d, %v, %v), want (0, 3, true, nil)", lo, hi, ok, err)
+			}
+		})
+	}
+}
+
+func TestChoosePolicy(t *testing.T) {
+	tests := []struct {
+		onExisting string
+		update     bool
+		checkpoint bool
+		want       string
+	}{
+		{"", false, true, "resume"},
+		{"", false, false, "fail"},
+		{"", true, false, "resume"},
+		{"append", false, true, "append"},
+		{"overwrite", false, false, "overwrite"},
+	}
+	defer func(onExisting string, update bool) { cfg.OnExisting, cfg.Update = onExisting, update }(cfg.OnExisting, cfg.Update)
+	for _, tt := range tests {
+		cfg.OnExisting, cfg.Update = tt.onExisting, tt.update
+		if got := choosePolicy("BTCUSDT", "data/BTCUSDT", 1, tt.checkpoint, "test"); got != tt.want {
+			t.Errorf("choosePolicy(-on-existing=%q, -update=%v, checkpoint=%v) = %s, want %s", tt.onExisting, tt.update, tt.checkpoint, got, tt.want)
+		}
+	}
+}
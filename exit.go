@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Exit codes of a collection run.
+const (
+	exitComplete  = 0 // every symbol finished
+	exitPartial   = 1 // some symbols failed
+	exitAllFailed = 2 // every symbol that had trades failed
+	exitAborted   = 3 // stopped by a signal, -deadline or -max-error-rate
+)
+
+// runContext returns the context collection runs under. It is canceled by
+// the first SIGINT or SIGTERM (a second one kills the process as usual),
+// when -deadline has passed and when -max-error-rate is exceeded;
+// context.Cause says which.
+func runContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stopTimer := func() bool { return false }
+	if cfg.Deadline > 0 {
+		d := cfg.Deadline
+		timer := time.AfterFunc(d, func() {
+			fmt.Printf("-deadline of %v reached, stopping...\n", d)
+			cancel(fmt.Errorf("-deadline of %v reached", d))
+		})
+		stopTimer = timer.Stop
+	}
+
+	fetchErrors.abort = cancel // -max-error-rate
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Stop(sigs) // 두 번째 신호는 즉시 종료
+			fmt.Printf("Received %v, stopping after the current pages (send again to exit now)...\n", sig)
+			cancel(fmt.Errorf("received %v", sig))
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		stopTimer()
+		signal.Stop(sigs)
+		cancel(context.Canceled)
+	}
+}
+
+// exitCode prints each symbol's outcome and maps them to an exit code.
+// Halted symbols (-status-check) collected what they traded and count as
+// successful. Empty symbols never traded, so they count neither way: the
+// run failed (exitAllFailed) when every symbol that ran a collection
+// failed.
+func exitCode(ctx context.Context, results []SymbolResult) int {
+	failed, aborted, empty, halted := 0, 0, 0, 0
+	for _, r := range results {
+		var h *haltedError
+		switch {
+		case r.Err == nil:
+		case errors.Is(r.Err, errNoTrades):
+			empty++
+		case errors.As(r.Err, &h):
+			halted++
+			fmt.Printf("  %s: %v\n", r.Symbol, h)
+		case errors.Is(r.Err, errAborted):
+			aborted++
+			fmt.Printf("  %s: aborted\n", r.Symbol)
+		default:
+			failed++
+			fmt.Printf("  %s: failed: %v\n", r.Symbol, r.Err)
+		}
+	}
+	fmt.Printf("Results: %d complete, %d empty, %d halted, %d failed, %d aborted\n", len(results)-empty-halted-failed-aborted, empty, halted, failed, aborted)
+	switch {
+	case aborted > 0:
+		fmt.Printf("Run aborted: %v\n", context.Cause(ctx))
+		return exitAborted
+	case failed == 0:
+		return exitComplete
+	case failed == len(results)-empty:
+		return exitAllFailed
+	default:
+		return exitPartial
+	}
+}
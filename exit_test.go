@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	outcomes := map[byte]error{
+		'c': nil,
+		'e': errNoTrades,
+		'h': &haltedError{"BREAK"},
+		'f': errors.New("invalid symbol"),
+		'p': &panicError{"boom"},
+		'a': fmt.Errorf("stopping: %w", errAborted),
+	}
+	tests := []struct {
+		results string // 심볼마다 한 글자
+		want    int
+	}{
+		{"c", exitComplete},
+		{"cc", exitComplete},
+		{"e", exitComplete},
+		{"ce", exitComplete},
+		{"h", exitComplete},
+		{"ch", exitComplete},
+		{"cf", exitPartial},
+		{"hf", exitPartial},
+		{"f", exitAllFailed},
+		{"fp", exitAllFailed},
+		{"fe", exitAllFailed}, // 빈 심볼은 세지 않음
+		{"fee", exitAllFailed},
+		{"fh", exitPartial}, // 중단된 심볼은 수집을 마친 것
+		{"ca", exitAborted},
+		{"fa", exitAborted},
+		{"", exitComplete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.results, func(t *testing.T) {
+			var results []SymbolResult
+			for i := range len(tt.results) {
+				results = append(results, SymbolResult{Symbol: fmt.Sprintf("S%dUSDT", i), Err: outcomes[tt.results[i]]})
+			}
+			ctx, cancel := context.WithCancelCause(context.Background())
+			if strings.Contains(tt.results, "a") {
+				cancel(errors.New("received interrupt"))
+			}
+			defer cancel(nil)
+			if got := exitCode(ctx, results); got != tt.want {
+				t.Errorf("exitCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// runExport converts CSV files collected under -in into -format files under
+// -out, without touching the API.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	registerFlags(fs)
+	var inDir string
+	fs.StringVar(&inDir, "in", ".", "directory holding previously collected <symbol>/<date>.csv files")
+	if err := parseArgs(fs, args); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	if !slices.Contains(timestampFormats, cfg.TimestampFormat) {
+		fmt.Printf("Error: invalid -timestamp-format %q (want %s)\n", cfg.TimestampFormat, strings.Join(timestampFormats, ", "))
+		return 2
+	}
+
+	symbols, err := explicitSymbols()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if !flagWasSet(fs, "symbols") && cfg.SymbolsFile == "" {
+		if cfg.Flatten {
+			fmt.Println("Error: export with -flatten needs -symbols")
+			return 1
+		}
+		var err error
+		if symbols, err = listSymbolDirs(inDir); err != nil {
+			fmt.Printf("Error listing %s: %v\n", inDir, err)
+			return 1
+		}
+	}
+
+	if cfg.Format == "csv" && filepath.Clean(inDir) == filepath.Clean(cfg.OutDir) {
+		fmt.Println("Error: exporting CSV into -in would append to the source files; pick another -out")
+		return 1
+	}
+
+	sink, err := newSink(cfg.Format)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer background.Wait() // sink.Close 뒤에 실행: -trades-per-file 청크 압축
+	defer sink.Close()
+
+	failed := false
+	for _, symbol := range symbols {
+		dates, err := listDateFilesIn(inDir, symbol, ".csv")
+		if err != nil {
+			fmt.Printf("Error listing %s: %v\n", symbol, err)
+			failed = true
+			continue
+		}
+		if err := os.MkdirAll(symbolDir(symbol), cfg.DirMode.Perm()); err != nil {
+			fmt.Printf("Error creating directory for %s: %v\n", symbol, err)
+			failed = true
+			continue
+		}
+		for _, date := range dates {
+			for _, src := range datePartPaths(inDir, symbol, date, ".csv") {
+				n, err := readTradesCSV(src, func(trades []AggTrade) error {
+					return sink.Write(symbol, date, trades)
+				})
+				if err != nil {
+					fmt.Printf("Error exporting %s: %v\n", src, err)
+					failed = true
+					continue
+				}
+				fmt.Printf("Exported %s (%d trades)\n", src, n)
+			}
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func flagWasSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func listSymbolDirs(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []string
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name()[0] != '.' {
+			symbols = append(symbols, entry.Name())
+		}
+	}
+	return symbols, nil
+}
+
+const exportBatch = 100000
+
+// readTradesCSV streams a date file written by this tool to fn in batches.
+// The header must be the collector's schema, optionally followed by the
+// derived quoteQty column.
+func readTradesCSV(path string, fn func([]AggTrade) error) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return 0, fmt.Errorf("reading header: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], utf8BOM)
+	}
+	checksummed := len(header) > 0 && header[len(header)-1] == checksumColumn
+	if checksummed {
+		header = header[:len(header)-1]
+	}
+	if !slices.Equal(header, baseCSVHeader) && !slices.Equal(header, append(slices.Clone(baseCSVHeader), "quoteQty")) {
+		return 0, fmt.Errorf("unexpected header %v, want %v", header, baseCSVHeader)
+	}
+
+	total := 0
+	batch := make([]AggTrade, 0, exportBatch)
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return total, err
+		}
+		if checksummed {
+			fields, sum := record[:len(record)-1], record[len(record)-1]
+			if want := rowChecksum(fields); sum != want {
+				return total, fmt.Errorf("line %d: checksum %s does not match the row (want %s)", line, sum, want)
+			}
+		}
+		trade, err := parseTradeRecord(record)
+		if err != nil {
+			return total, fmt.Errorf("line %d: %w", line, err)
+		}
+		batch = append(batch, trade)
+		if len(batch) == exportBatch {
+			if err := fn(batch); err != nil {
+				return total, err
+			}
+			total += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := fn(batch); err != nil {
+			return total, err
+		}
+		total += len(batch)
+	}
+	return total, nil
+}
+
+func parseTradeRecord(record []string) (AggTrade, error) {
+	var trade AggTrade
+	var err error
+	if trade.TradeId, err = strconv.ParseInt(record[0], 10, 64); err != nil {
+		return trade, fmt.Errorf("bad tradeId %q", record[0])
+	}
+	trade.Price, trade.Quantity = record[1], record[2]
+	if trade.Timestamp, err = parseTimestamp(record[3]); err != nil {
+		return trade, err
+	}
+	if trade.IsMaker, err = strconv.ParseBool(record[4]); err != nil {
+		return trade, fmt.Errorf("bad isBuyerMaker %q", record[4])
+	}
+	return trade, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// fifoSink streams each symbol's trades as CSV to <-fifo-dir>/<symbol>.fifo
+// instead of writing date files (-fifo-dir). The FIFO is created if needed
+// and opened once; every reader that attaches gets the header first. Writes
+// block while the reader is behind. With -fifo-no-reader=drop, pages that
+// arrive while no reader is attached (or after it went away) are dropped;
+// with block they wait for the next reader, until ctx is canceled.
+type fifoSink struct {
+	ctx  context.Context
+	dir  string
+	drop bool
+
+	symbols sync.Map // symbol -> *symbolFifo
+}
+
+// symbolFifo is one symbol's FIFO, used only by the symbol's owner.
+type symbolFifo struct {
+	path    string
+	f       *os.File // nil: no reader attached
+	dropped int64    // 리더가 없어 버린 거래 수 (-fifo-no-reader=drop)
+}
+
+func newFIFOSink(ctx context.Context, dir string, drop bool) (*fifoSink, error) {
+	if err := os.MkdirAll(dir, cfg.DirMode.Perm()); err != nil {
+		return nil, err
+	}
+	return &fifoSink{ctx: ctx, dir: dir, drop: drop}, nil
+}
+
+func (s *fifoSink) fifo(symbol string) (*symbolFifo, error) {
+	if p, ok := s.symbols.Load(symbol); ok {
+		return p.(*symbolFifo), nil
+	}
+	path := filepath.Join(s.dir, symbol+".fifo")
+	if err := makeFIFO(path); err != nil {
+		return nil, err
+	}
+	p, _ := s.symbols.LoadOrStore(symbol, &symbolFifo{path: path})
+	return p.(*symbolFifo), nil
+}
+
+func (s *fifoSink) Write(symbol, _ string, trades []AggTrade) error {
+	p, err := s.fifo(symbol)
+	if err != nil {
+		return err
+	}
+	lines, err := csvLines(csvRecords(trades))
+	if err != nil {
+		return err
+	}
+	var header []byte
+	for len(lines) > 0 {
+		if p.f == nil {
+			f, err := s.open(p)
+			if s.drop && isNoReader(err) {
+				if p.dropped == 0 {
+					fmt.Printf("No reader on %s, dropping %s trades until one attaches\n", p.path, symbol)
+				}
+				p.dropped += int64(len(lines))
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if p.dropped > 0 {
+				fmt.Printf("Reader attached to %s, %d %s trades were dropped\n", p.path, p.dropped, symbol)
+				p.dropped = 0
+			}
+			p.f = f
+			h, err := csvLines([][]string{csvHeader()})
+			if err != nil {
+				return err
+			}
+			header = h[0]
+		}
+		n, err := s.writeLines(p.f, header, lines)
+		if err == nil {
+			return nil
+		}
+		p.f.Close()
+		p.f = nil
+		if !isReaderGone(err) {
+			return err
+		}
+		// 다 보낸 행은 다시 보내지 않음; 잘린 행부터 다음 리더에게 보냄
+		sent := 0
+		for n -= len(header); sent < len(lines) && n >= len(lines[sent]); sent++ {
+			n -= len(lines[sent])
+		}
+		lines = lines[sent:]
+		fmt.Printf("Reader of %s went away, %d trades of the page left\n", p.path, len(lines))
+	}
+	return nil
+}
+
+// csvLines encodes records as CSV, one []byte per record, so a write cut
+// off by a departing reader can resume at the first record it did not finish.
+func csvLines(records [][]string) ([][]byte, error) {
+	var buf bytes.Buffer
+	w := newCSVWriter(&buf)
+	ends := make([]int, 0, len(records))
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+		ends = append(ends, buf.Len())
+	}
+	lines := make([][]byte, len(ends))
+	start := 0
+	for i, end := range ends {
+		lines[i], start = buf.Bytes()[start:end], end
+	}
+	return lines, nil
+}
+
+// open opens the FIFO for writing. With block it waits for a reader in a
+// goroutine, so a canceled run does not hang on a FIFO nobody opens.
+func (s *fifoSink) open(p *symbolFifo) (*os.File, error) {
+	if s.drop {
+		return openFIFO(p.path, false)
+	}
+	fmt.Printf("Waiting for a reader on %s...\n", p.path)
+	type opened struct {
+		f   *os.File
+		err error
+	}
+	done := make(chan opened, 1)
+	go func() {
+		f, err := openFIFO(p.path, true)
+		done <- opened{f, err}
+	}()
+	select {
+	case o := <-done:
+		return o.f, o.err
+	case <-s.ctx.Done():
+		wakeFIFOOpen(p.path)
+		go func() {
+			if o := <-done; o.f != nil {
+				o.f.Close()
+			}
+		}()
+		return nil, context.Cause(s.ctx)
+	}
+}
+
+// writeLines writes the header, if any, and lines to f and returns the bytes
+// written. A write blocked on a full pipe is cut off once ctx is canceled.
+func (s *fifoSink) writeLines(f *os.File, header []byte, lines [][]byte) (int, error) {
+	stop := context.AfterFunc(s.ctx, func() { f.SetWriteDeadline(time.Now()) })
+	defer stop()
+	buf := slices.Concat(append([][]byte{header}, lines...)...)
+	n, err := f.Write(buf)
+	if errors.Is(err, os.ErrDeadlineExceeded) && s.ctx.Err() != nil {
+		err = context.Cause(s.ctx)
+	}
+	return n, err
+}
+
+func (s *fifoSink) Close() error {
+	var firstErr error
+	s.symbols.Range(func(_, v any) bool {
+		p := v.(*symbolFifo)
+		if p.dropped > 0 {
+			fmt.Printf("%s: %d trades were dropped without a reader\n", p.path, p.dropped)
+		}
+		if p.f != nil {
+			if err := p.f.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return true
+	})
+	return firstErr
+}
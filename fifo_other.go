@@ -0,0 +1,24 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoFIFO = errors.New("-fifo-dir needs named pipes, which this platform does not have")
+
+func makeFIFO(path string) error {
+	return errNoFIFO
+}
+
+func openFIFO(path string, wait bool) (*os.File, error) {
+	return nil, errNoFIFO
+}
+
+func wakeFIFOOpen(path string) {}
+
+func isNoReader(err error) bool { return false }
+
+func isReaderGone(err error) bool { return false }
@@ -0,0 +1,204 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fifoPage is a page far larger than a pipe buffer, so writing it blocks
+// until the reader takes most of it.
+func fifoPage() []AggTrade {
+	trades := make([]AggTrade, 20000)
+	for i := range trades {
+		trades[i] = testTrade(int64(i))
+	}
+	return trades
+}
+
+// writeAsync runs one Write of trades to BTCUSDT's FIFO in a goroutine.
+func writeAsync(s *fifoSink, trades []AggTrade) chan error {
+	done := make(chan error, 1)
+	go func() { done <- s.Write("BTCUSDT", "2023-11-14", trades) }()
+	return done
+}
+
+func waitWrite(t *testing.T, done chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Write did not return")
+		return nil
+	}
+}
+
+// readSome opens the FIFO, reads n bytes and closes it again.
+func readSome(t *testing.T, path string, n int) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+// wholeRowIds returns the tradeIds of the complete rows in out.
+func wholeRowIds(t *testing.T, out string) []int64 {
+	t.Helper()
+	out = out[:strings.LastIndexByte(out, '\n')+1]
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, record := range records {
+		if id, err := strconv.ParseInt(record[0], 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func newTestFIFOSink(t *testing.T, ctx context.Context, drop bool) (*fifoSink, string) {
+	t.Helper()
+	s, err := newFIFOSink(ctx, t.TempDir(), drop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	path := filepath.Join(s.dir, "BTCUSDT.fifo")
+	if err := makeFIFO(path); err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+func TestFIFOReaderGoneMidPage(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.Location, cfg.FileMode, cfg.DirMode = time.UTC, 0o644, 0o755
+	header := strings.Join(csvHeader(), ",") + "\n"
+	page := fifoPage()
+
+	t.Run("block sends the rest of the page to the next reader", func(t *testing.T) {
+		s, path := newTestFIFOSink(t, context.Background(), false)
+		done := writeAsync(s, page)
+		first := wholeRowIds(t, readSome(t, path, 4096))
+		time.Sleep(100 * time.Millisecond) // 쓰는 쪽이 EPIPE를 받은 뒤에 다음 리더를 엶
+
+		rest := make(chan string, 1)
+		go func() {
+			f, err := os.Open(path)
+			if err != nil {
+				rest <- ""
+				return
+			}
+			defer f.Close()
+			b, _ := io.ReadAll(f)
+			rest <- string(b)
+		}()
+		if err := waitWrite(t, done); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+		out := <-rest
+		if !strings.HasPrefix(out, header) {
+			t.Fatalf("the next reader got %.40q..., want the header first", out)
+		}
+		ids := wholeRowIds(t, out)
+		if len(ids) == 0 || ids[0] <= first[len(first)-1] || ids[len(ids)-1] != int64(len(page)-1) {
+			t.Fatalf("the first reader got ids up to %d, the next one %d ids, want the rest of the page once", first[len(first)-1], len(ids))
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] != ids[i-1]+1 {
+				t.Fatalf("the next reader got id %d after %d", ids[i], ids[i-1])
+			}
+		}
+	})
+
+	t.Run("drop drops the rest of the page", func(t *testing.T) {
+		s, path := newTestFIFOSink(t, context.Background(), true)
+		// drop은 리더가 이미 열었을 때만 FIFO를 엶
+		r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := writeAsync(s, page)
+		buf := make([]byte, 4096)
+		for got, start := 0, time.Now(); got < len(buf); {
+			n, err := r.Read(buf[got:])
+			got += n
+			if err == io.EOF && time.Since(start) < 5*time.Second {
+				time.Sleep(10 * time.Millisecond) // 아직 쓰는 쪽이 열지 않음
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		r.Close()
+		if err := waitWrite(t, done); err != nil {
+			t.Fatal(err)
+		}
+		first := wholeRowIds(t, string(buf))
+		p, _ := s.fifo("BTCUSDT")
+		if p.f != nil {
+			t.Error("the FIFO is still open after its reader went away")
+		}
+		if len(first) == 0 || p.dropped <= 0 || p.dropped >= int64(len(page)) {
+			t.Errorf("%d trades dropped after the reader took %d rows, want the rest of the page", p.dropped, len(first))
+		}
+	})
+}
+
+func TestFIFOBlockStopsOnCancel(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.Location, cfg.FileMode, cfg.DirMode = time.UTC, 0o644, 0o755
+
+	t.Run("waiting for a reader", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, _ := newTestFIFOSink(t, ctx, false)
+		done := writeAsync(s, fifoPage()[:10])
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		if err := waitWrite(t, done); !errors.Is(err, context.Canceled) {
+			t.Errorf("Write = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("writing to a reader that does not read", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s, path := newTestFIFOSink(t, ctx, false)
+		done := writeAsync(s, fifoPage())
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		if err := waitWrite(t, done); !errors.Is(err, context.Canceled) {
+			t.Errorf("Write = %v, want context.Canceled", err)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// makeFIFO creates the named pipe at path unless it already exists.
+func makeFIFO(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s exists and is not a FIFO", path)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := syscall.Mkfifo(path, uint32(cfg.FileMode.Perm())); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("creating FIFO %s: %w", path, err)
+	}
+	return nil
+}
+
+// openFIFO opens the FIFO for writing. With wait it blocks until a reader
+// opens it; otherwise it fails at once (see isNoReader) when none has. Writes
+// to the returned file block while the pipe is full either way.
+func openFIFO(path string, wait bool) (*os.File, error) {
+	flags := os.O_WRONLY
+	if !wait {
+		flags |= syscall.O_NONBLOCK
+	}
+	return os.OpenFile(path, flags, 0)
+}
+
+// wakeFIFOOpen lets an openFIFO waiting for a reader return, by opening and
+// closing the read end once.
+func wakeFIFOOpen(path string) {
+	if f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0); err == nil {
+		f.Close()
+	}
+}
+
+func isNoReader(err error) bool {
+	return errors.Is(err, syscall.ENXIO)
+}
+
+func isReaderGone(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	fileRetries      = 5
+	fileRetryBackoff = 100 * time.Millisecond
+)
+
+// appendFile opens path for appending, calls write, then syncs and closes it.
+// Network filesystems (NFS/SMB) occasionally fail these calls transiently, so
+// a transient failure rolls the file back to its previous contents (or
+// removes it if this call created it) and retries with a growing backoff.
+// Permanent errors such as permission denied are returned immediately.
+func appendFile(path string, write func(file *os.File, isNewFile bool) error) error {
+	backoff := fileRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := appendFileOnce(path, write)
+		if err == nil || attempt == fileRetries || !isTransientFileErr(err) {
+			return err
+		}
+		debugf("Retrying write to %s in %v (attempt %d/%d): %v\n", path, backoff, attempt+1, fileRetries, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// fileBuffer buffers writes to a date file, -write-buffer-bytes at a time
+// (4KB by default). Each append flushes it before the file is synced, so no
+// page is left in memory across appends, rollovers or shutdown.
+func fileBuffer(file *os.File) *bufio.Writer {
+	if cfg.WriteBufferBytes > 0 {
+		return bufio.NewWriterSize(file, int(cfg.WriteBufferBytes))
+	}
+	return bufio.NewWriter(file)
+}
+
+func appendFileOnce(path string, write func(file *os.File, isNewFile bool) error) (err error) {
+	mark := markFile(path)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, cfg.FileMode.Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			rollbackFiles([]fileMark{mark})
+		}
+	}()
+
+	if err = write(file, mark.size <= 0); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func isTransientFileErr(err error) bool {
+	if errors.Is(err, os.ErrPermission) || errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case syscall.EIO, syscall.EAGAIN, syscall.EINTR, syscall.ESTALE, syscall.ETIMEDOUT, syscall.EBUSY:
+		return true
+	}
+	return false
+}
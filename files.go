@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listDateFiles returns the dates of a symbol's CSV date files, oldest first,
+// counting the ones -final-compression left only compressed.
+func listDateFiles(symbol string) ([]string, error) {
+	var dates []string
+	for _, suffix := range compressedSuffixes {
+		found, err := listDateFilesIn(cfg.OutDir, symbol, ".csv"+suffix)
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, found...)
+	}
+	slices.Sort(dates)
+	return slices.Compact(dates), nil
+}
+
+func listDateFilesIn(root, symbol, ext string) ([]string, error) {
+	entries, err := os.ReadDir(symbolDirIn(root, symbol))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var dates []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if date, _, ok := parseDateFileName(symbol, entry.Name(), ext); ok && !seen[date] {
+			seen[date] = true
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+// dateFileName is the name of part n of a date file: <date><ext> for the
+// first part and <date>.part<n><ext> after -max-file-size rolls it over.
+func dateFileName(date string, part int, ext string) string {
+	if part <= 1 {
+		return date + ext
+	}
+	return fmt.Sprintf("%s.part%d%s", date, part, ext)
+}
+
+func parseDateFileName(symbol, name, ext string) (date string, part int, ok bool) {
+	if cfg.Flatten {
+		if name, ok = strings.CutPrefix(name, symbol+"_"); !ok {
+			return "", 0, false
+		}
+	}
+	if name, ok = strings.CutSuffix(name, ext); !ok {
+		return "", 0, false
+	}
+	date, partStr, hasPart := strings.Cut(name, ".part")
+	part = 1
+	if hasPart {
+		var err error
+		if part, err = strconv.Atoi(partStr); err != nil || part < 2 {
+			return "", 0, false
+		}
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", 0, false
+	}
+	return date, part, true
+}
+
+// datePartPaths returns the existing parts of a date file in order.
+func datePartPaths(root, symbol, date, ext string) []string {
+	var paths []string
+	for part := 1; ; part++ {
+		path := symbolPathIn(root, symbol, dateFileName(date, part, ext))
+		if _, err := os.Stat(path); err != nil {
+			return paths
+		}
+		paths = append(paths, path)
+	}
+}
+
+// tradeIdBoundsOnDisk returns the lowest and highest tradeId of a symbol's
+// CSV files. Both ends of the oldest and the newest date with rows are read,
+// so ascending and -newest-first files give the same bounds. ok is false
+// when the symbol has no rows yet. With -trades-per-file the first and last
+// chunks are read instead. A file that -final-compression compressed (and
+// -remove-original removed) is read from its .gz or .zst.
+func tradeIdBoundsOnDisk(symbol string) (lo, hi int64, ok bool, err error) {
+	var groups [][]string
+	if cfg.TradesPerFile > 0 {
+		chunks, err := listCSVChunks(symbol)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		for _, path := range chunks {
+			groups = append(groups, []string{path})
+		}
+	} else {
+		dates, err := listDateFiles(symbol)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		for _, date := range dates {
+			groups = append(groups, dateCSVPaths(symbol, date))
+		}
+	}
+	for i := range groups {
+		if lo, hi, ok, err = fileIdBounds(groups[i]); err != nil || ok {
+			break
+		}
+	}
+	if !ok {
+		return 0, 0, false, err
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		l, h, found, err := fileIdBounds(groups[i])
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if found {
+			return min(lo, l), max(hi, h), true, nil
+		}
+	}
+	return lo, hi, true, nil
+}
+
+// dateCSVPaths returns the parts of a symbol's CSV date file in order, each
+// as readablePath picks it.
+func dateCSVPaths(symbol, date string) []string {
+	var paths []string
+	for part := 1; ; part++ {
+		path, ok := readablePath(symbolPath(symbol, dateFileName(date, part, ".csv")))
+		if !ok {
+			return paths
+		}
+		paths = append(paths, path)
+	}
+}
+
+// fileIdBounds returns the lowest and highest tradeId of the first and last
+// rows of the files. ok is false when none of them has rows.
+func fileIdBounds(paths []string) (lo, hi int64, ok bool, err error) {
+	for _, path := range paths {
+		first, err := firstRecord(path)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("reading %s: %w", path, err)
+		}
+		last, err := lastRecord(path)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("reading %s: %w", path, err)
+		}
+		for _, record := range [][]string{first, last} {
+			if record == nil || strings.TrimPrefix(record[0], utf8BOM) == "tradeId" {
+				continue
+			}
+			id, err := strconv.ParseInt(record[0], 10, 64)
+			if err != nil {
+				return 0, 0, false, fmt.Errorf("reading %s: bad tradeId %q", path, record[0])
+			}
+			if !ok || id < lo {
+				lo = id
+			}
+			if !ok || id > hi {
+				hi = id
+			}
+			ok = true
+		}
+	}
+	return lo, hi, ok, nil
+}
+
+// readablePath returns path, or the compressed copy of it that is left, with
+// the plain file preferred since its end can be read directly.
+func readablePath(path string) (string, bool) {
+	for _, suffix := range compressedSuffixes {
+		if _, err := os.Stat(path + suffix); err == nil {
+			return path + suffix, true
+		}
+	}
+	return "", false
+}
+
+// listCSVChunks returns the symbol's -trades-per-file CSV chunks in order,
+// each as readablePath picks it.
+func listCSVChunks(symbol string) ([]string, error) {
+	var plain []string
+	for _, suffix := range compressedSuffixes {
+		found, err := listChunkPaths(cfg.OutDir, symbol, ".csv"+suffix)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range found {
+			plain = append(plain, strings.TrimSuffix(path, suffix))
+		}
+	}
+	slices.Sort(plain) // part-00001 순서
+	var paths []string
+	for _, path := range slices.Compact(plain) {
+		if path, ok := readablePath(path); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// lastRecord reads the last CSV record of a file without scanning all of it.
+// A .gz or .zst file has to be decompressed from the start, keeping only
+// its tail.
+func lastRecord(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if suffix := filepath.Ext(path); suffix == ".gz" || suffix == ".zst" {
+		r, done, err := decompressReader(f, suffix)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+		tail := &tailBuffer{max: 64 * 1024}
+		if _, err := io.Copy(tail, r); err != nil {
+			return nil, err
+		}
+		return parseLastLine(tail.bytes())
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	const chunk = 64 * 1024
+	offset := max(info.Size()-chunk, 0)
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return parseLastLine(buf)
+}
+
+// firstRecord reads the first CSV record of a file after its header, nil
+// when it has none.
+func firstRecord(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if suffix := filepath.Ext(path); suffix == ".gz" || suffix == ".zst" {
+		dr, done, err := decompressReader(f, suffix)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+		r = dr
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimPrefix(record[0], utf8BOM) != "tradeId" {
+			return record, nil
+		}
+	}
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	buf []byte
+	max int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > 2*t.max {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) bytes() []byte {
+	return t.buf[max(len(t.buf)-t.max, 0):]
+}
+
+func parseLastLine(buf []byte) ([]string, error) {
+	buf = bytes.TrimRight(buf, "\r\n")
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	}
+	return csv.NewReader(bytes.NewReader(buf)).Read()
+}
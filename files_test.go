@@ -0,0 +1,156 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// writeFixture writes content to path, compressed as its .gz or .zst
+// suffix says, the way another tool (not compressFile) might have.
+func writeFixture(t *testing.T, path, content string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.WriteCloser
+	switch filepath.Ext(path) {
+	case ".gz":
+		w = gzip.NewWriter(f)
+	case ".zst":
+		if w, err = zstd.NewWriter(f); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		_, err = f.WriteString(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// csvRows is a date file of the tradeIds from..to-1.
+func csvRows(from, to int64) string {
+	var b strings.Builder
+	b.WriteString("tradeId,price,quantity,timestamp,isBuyerMaker\n")
+	for id := from; id < to; id++ {
+		fmt.Fprintf(&b, "%d,42000.01000000,0.00100000,%d,true\n", id, 1699920000000+id)
+	}
+	return b.String()
+}
+
+func TestFirstLastRecordCompressed(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		first, last string // 첫 열, "": 없음
+	}{
+		{"small", csvRows(5, 8), "5", "7"},
+		{"larger than the tail buffer", csvRows(0, 5000), "0", "4999"},
+		{"no trailing newline", strings.TrimSuffix(csvRows(5, 8), "\n"), "5", "7"},
+		{"CRLF", strings.ReplaceAll(csvRows(5, 8), "\n", "\r\n"), "5", "7"},
+		{"BOM", utf8BOM + csvRows(5, 8), "5", "7"},
+		{"header only", csvRows(0, 0), "", "tradeId"},
+		{"empty", "", "", ""},
+	}
+	dir := t.TempDir()
+	for _, suffix := range compressedSuffixes {
+		for i, tt := range tests {
+			t.Run(tt.name+suffix, func(t *testing.T) {
+				path := filepath.Join(dir, fmt.Sprintf("%d.csv%s", i, suffix))
+				writeFixture(t, path, tt.content)
+				first, err := firstRecord(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := firstField(first); got != tt.first {
+					t.Errorf("firstRecord starts with %q, want %q", got, tt.first)
+				}
+				last, err := lastRecord(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := firstField(last); got != tt.last {
+					t.Errorf("lastRecord starts with %q, want %q", got, tt.last)
+				}
+			})
+		}
+	}
+}
+
+func firstField(record []string) string {
+	if len(record) == 0 {
+		return ""
+	}
+	return record[0]
+}
+
+func TestListDateFilesCompressed(t *testing.T) {
+	writeDateFiles(t, nil)
+	dir := symbolDir("BTCUSDT")
+	for _, name := range []string{
+		"2023-11-14.csv.gz", // 압축만 남음
+		"2023-11-15.csv",    // 압축 중: 둘 다 있음
+		"2023-11-15.csv.gz",
+		"2023-11-16.csv.zst",
+		"2023-11-17.csv.zst.tmp", // 쓰다 만 파일은 세지 않음
+		"notes.txt",
+	} {
+		writeFixture(t, filepath.Join(dir, name), csvRows(0, 1))
+	}
+	dates, err := listDateFiles("BTCUSDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2023-11-14", "2023-11-15", "2023-11-16"}; !slices.Equal(dates, want) {
+		t.Errorf("dates %v, want %v", dates, want)
+	}
+	if path, _ := readablePath(filepath.Join(dir, "2023-11-15.csv")); filepath.Ext(path) != ".csv" {
+		t.Errorf("readablePath picked %s over the plain file", path)
+	}
+}
+
+// TestResumeFromCompressed resumes a forward run whose newest date file
+// was left as a fixture .csv.gz or .csv.zst only.
+func TestResumeFromCompressed(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Location, cfg.Format = time.UTC, "csv"
+	for _, suffix := range []string{".gz", ".zst"} {
+		t.Run(strings.TrimPrefix(suffix, "."), func(t *testing.T) {
+			writeDateFiles(t, map[string][]string{"2023-11-13.csv": {"0", "1"}})
+			cfg.DirMode = 0o755
+			writeFixture(t, symbolPath("BTCUSDT", "2023-11-14.csv"+suffix), csvRows(2, 3000))
+			var fromIds []int64
+			servePages(t, func(from int64) []int64 {
+				fromIds = append(fromIds, from)
+				return nil
+			})
+			c := NewCollector(noLimit{})
+			c.RegisterSink(newCSVSink())
+			if err := c.processSymbol(context.Background(), "BTCUSDT"); err != nil {
+				t.Fatal(err)
+			}
+			if len(fromIds) == 0 || fromIds[0] != 3000 {
+				t.Errorf("requested fromIds %v, want to start at 3000", fromIds)
+			}
+		})
+	}
+}
@@ -1,3 +1,11 @@
 module binance-data
 
 go 1.24.0
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/linkedin/goavro/v2 v2.15.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/golang/snappy v0.0.1 // indirect
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// runHead prints the first -head trades of each symbol as a table, without
+// writing anything: the trades at or after -start-time, or the most recent
+// ones without it. It returns the exit code.
+func runHead(symbols []string, rl Limiter) int {
+	code := exitComplete
+	for _, symbol := range symbols {
+		trades, err := headTrades(symbol, rl)
+		if err != nil {
+			fmt.Printf("%s: error: %v\n", symbol, err)
+			code = exitPartial
+			continue
+		}
+		fmt.Printf("%s: %d trades\n", symbol, len(trades))
+		if len(trades) == 0 {
+			continue
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "tradeId\ttime\tprice\tquantity\tbuyerMaker\tfirstId\tlastId\t")
+		for _, t := range trades {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%t\t%d\t%d\t\n", t.TradeId,
+				time.UnixMilli(t.Timestamp).In(cfg.Location).Format("2006-01-02 15:04:05.000"),
+				t.Price, t.Quantity, t.IsMaker, t.FirstId, t.LastId)
+		}
+		w.Flush()
+	}
+	return code
+}
+
+func headTrades(symbol string, rl Limiter) ([]AggTrade, error) {
+	limit := strconv.Itoa(min(cfg.Head, limitPerReq))
+	if cfg.StartTime.IsZero() {
+		rl.Wait(aggTradesWeight(min(cfg.Head, limitPerReq)))
+		return fetchAggTrades(symbol, url.Values{"limit": {limit}})
+	}
+	latest, err := fetchLatestTrade(symbol, rl)
+	if err != nil {
+		return nil, err
+	}
+	first, err := firstTradeAtOrAfter(symbol, cfg.StartTime.Time, latest, rl)
+	if err != nil || first == nil {
+		return nil, err
+	}
+	rl.Wait(aggTradesWeight(min(cfg.Head, limitPerReq)))
+	return fetchAggTrades(symbol, url.Values{"fromId": {strconv.FormatInt(first.TradeId, 10)}, "limit": {limit}})
+}
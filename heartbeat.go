@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// What a symbol is doing, as shown by -heartbeat.
+const (
+	activityRateLimit = "waiting on rate limit"
+	activityFetching  = "fetching"
+	activityWriting   = "writing"
+	activityRetrying  = "waiting to retry"
+	activityPaused    = "paused"
+)
+
+// heartbeatNames is how many symbols a heartbeat names per activity.
+const heartbeatNames = 5
+
+// waitTurn waits on the limiter for a request of this weight, showing name as
+// waiting on the rate limit until then and as fetching afterwards. With
+// -scheduler=round-robin it first waits for name's turn.
+func (c *Collector) waitTurn(name string, weight int) {
+	progress.activity(name, activityRateLimit)
+	if c.turns != nil {
+		done := c.turns.turn(name)
+		defer done()
+	}
+	c.limiter.Wait(weight)
+	progress.activity(name, activityFetching)
+}
+
+// retryDelay is the pause before a failed request or write is retried.
+func retryDelay(ctx context.Context, name string, d time.Duration) {
+	progress.activity(name, activityRetrying)
+	sleepCtx(ctx, d)
+}
+
+func (p *progressTracker) activity(symbol, what string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sp := p.symbol(symbol)
+	if sp.activity != what {
+		sp.activity, sp.activitySince = what, time.Now()
+	}
+}
+
+// startHeartbeat logs a summary every -heartbeat until the returned stop is
+// called, so a quiet log (an illiquid symbol, a long rate-limit wait) still
+// shows that the process is alive and what it is waiting for.
+func startHeartbeat(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Println(progress.heartbeat())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// heartbeat summarizes the running symbols by activity, e.g.
+//
+//	Heartbeat: 3 running, 1 finished, 1520000 rows written; fetching: BTCUSDT (0s); waiting on rate limit: ETHUSDT (12s), SOLUSDT (12s)
+func (p *progressTracker) heartbeat() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.symbols))
+	for name := range p.symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	running, finished := 0, 0
+	var written int64
+	byActivity := make(map[string][]string)
+	for _, name := range names {
+		sp := p.symbols[name]
+		written += sp.written
+		if sp.finished {
+			finished++
+			continue
+		}
+		running++
+		what := sp.activity
+		if what == "" {
+			what = "starting"
+		}
+		byActivity[what] = append(byActivity[what], fmt.Sprintf("%s (%s)", name, time.Since(sp.activitySince).Round(time.Second)))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Heartbeat: %d running, %d finished, %d rows written", running, finished, written)
+	for _, what := range []string{activityFetching, activityWriting, activityRateLimit, activityRetrying, activityPaused, "starting"} {
+		list := byActivity[what]
+		if len(list) == 0 {
+			continue
+		}
+		more := ""
+		if len(list) > heartbeatNames {
+			more = fmt.Sprintf(" (+%d more)", len(list)-heartbeatNames)
+			list = list[:heartbeatNames]
+		}
+		fmt.Fprintf(&b, "; %s: %s%s", what, strings.Join(list, ", "), more)
+	}
+	return b.String()
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// processFullHistory implements -full-history: it finds the symbol's first
+// trade and collects every day from then on as its own window, -concurrency
+// windows at a time. Resuming skips the days the manifest marks complete.
+func (c *Collector) processFullHistory(ctx context.Context, symbol string) error {
+	fmt.Printf("Starting full-history collection for %s...\n", symbol)
+	progress.start(symbol)
+	defer progress.finish(symbol)
+	if err := os.MkdirAll(symbolDir(symbol), cfg.DirMode.Perm()); err != nil {
+		fmt.Printf("Error creating directory for %s: %v\n", symbol, err)
+		return err
+	}
+
+	latest, err := fetchLatestTrade(symbol, c.limiter)
+	if err != nil {
+		fmt.Printf("Error finding the latest trade for %s: %v\n", symbol, err)
+		return err
+	}
+	if latest == nil {
+		return noTrades(symbol)
+	}
+	first, err := earliestTrade(symbol, latest, c.limiter)
+	if err != nil {
+		fmt.Printf("Error finding the first trade of %s: %v\n", symbol, err)
+		return err
+	}
+
+	policy, _, _, _, err := existingPolicy(symbol)
+	if err != nil {
+		fmt.Printf("Error reading existing data for %s: %v\n", symbol, err)
+		return err
+	}
+	if policy == "fail" {
+		fmt.Printf("Not collecting %s: pass -on-existing=append|resume|overwrite to use its existing files\n", symbol)
+		return fmt.Errorf("%s already has files in %s", symbol, symbolDir(symbol))
+	}
+
+	var done *manifest // 이어받기: 이전 실행이 끝낸 날짜는 건너뜀
+	if cfg.SkipComplete || policy == "resume" {
+		if done, err = loadManifestIn(cfg.OutDir, symbol); err != nil {
+			fmt.Printf("Error loading manifest for %s: %v\n", symbol, err)
+			return err
+		}
+	}
+
+	days := historyDays(time.UnixMilli(first.Timestamp), time.UnixMilli(latest.Timestamp))
+	fmt.Printf("%s: first trade %d at %s, %d days to collect\n", symbol, first.TradeId,
+		time.UnixMilli(first.Timestamp).In(cfg.Location).Format(time.RFC3339), len(days))
+
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range days {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	for range max(cfg.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				err := runIsolated(symbol+" "+days[i].Format("2006-01-02"), func() error {
+					return c.collectDay(ctx, symbol, days, i, latest, done)
+				})
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return errAborted
+	}
+	return errors.Join(errs...)
+}
+
+// collectDay collects days[i], from midnight to midnight in -tz. With a
+// manifest of finished days, a complete day is skipped and a partial one
+// resumed.
+func (c *Collector) collectDay(ctx context.Context, symbol string, days []time.Time, i int, latest *AggTrade, done *manifest) error {
+	start, end := days[i], nextDay(days[i])
+	date := start.Format("2006-01-02")
+	if done != nil && done.Complete[date] {
+		fmt.Printf("%s %s is already complete (day %d/%d)\n", symbol, date, i+1, len(days))
+		return nil
+	}
+
+	to := end
+	if latest.Timestamp < end.UnixMilli() {
+		to = time.UnixMilli(latest.Timestamp + 1) // 오늘: 가장 최근 거래까지만 조회
+	}
+	first, err := firstTradeBetween(symbol, start, to, latest, c.limiter)
+	if err != nil {
+		fmt.Printf("Error finding the first trade of %s on %s: %v\n", symbol, date, err)
+		return err
+	}
+	if first == nil {
+		fmt.Printf("No trades for %s on %s (day %d/%d)\n", symbol, date, i+1, len(days))
+		return nil
+	}
+	fromId := first.TradeId
+	if done != nil {
+		if fromId, err = resumeDay(symbol, date, fromId); err != nil {
+			fmt.Printf("Error reading existing data for %s on %s: %v\n", symbol, date, err)
+			return err
+		}
+	}
+	fmt.Printf("Collecting %s %s from fromId(%d) (day %d/%d)\n", symbol, date, fromId, i+1, len(days))
+	return c.collectFrom(ctx, symbol, fromId, end, nil, done, true)
+}
+
+// resumeDay returns where an unfinished date continues: after the highest
+// tradeId of its CSV files, or from fromId once files that cannot be read
+// back (other formats, a discarded tradeId) have been removed, so that a
+// rerun doesn't write the day's first rows twice.
+func resumeDay(symbol, date string, fromId int64) (int64, error) {
+	format := formatFor(symbol)
+	if format == "csv" && !discardFields["tradeId"] {
+		_, hi, ok, err := fileIdBounds(dateCSVPaths(symbol, date))
+		if err != nil || !ok {
+			return fromId, err
+		}
+		fmt.Printf("%s %s is partly on disk up to tradeId %d\n", symbol, date, hi)
+		return max(fromId, hi+1), nil
+	}
+	paths := datePartPaths(cfg.OutDir, symbol, date, "."+format)
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return 0, err
+		}
+	}
+	if len(paths) > 0 {
+		fmt.Printf("Removed %d partial file(s) of %s %s to collect it again\n", len(paths), symbol, date)
+	}
+	return fromId, nil
+}
+
+// historyDays returns the midnights in -tz of every day from first to last.
+func historyDays(first, last time.Time) []time.Time {
+	var days []time.Time
+	for day := startOfDay(first); !day.After(last); day = nextDay(day) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// earliestTrade returns the symbol's first aggregate trade. fromId=0 normally
+// returns it directly; if the oldest ids are not served, it binary-searches
+// for the lowest fromId that still returns a trade.
+func earliestTrade(symbol string, latest *AggTrade, rl Limiter) (*AggTrade, error) {
+	return searchEarliest(latest, func(id int64) (*AggTrade, error) {
+		return tradeAtId(symbol, id, rl)
+	})
+}
+
+// searchEarliest finds the trade returned for the lowest fromId in
+// [0, latest.TradeId] for which probe returns one. probe must return nil for
+// every id below some cutoff and a trade for every id at or above it.
+func searchEarliest(latest *AggTrade, probe func(int64) (*AggTrade, error)) (*AggTrade, error) {
+	trade, err := probe(0)
+	if err != nil || trade != nil {
+		return trade, err
+	}
+	lo, hi := int64(0), latest.TradeId // probe(lo) == nil, probe(hi) != nil
+	found := latest
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		t, err := probe(mid)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			lo = mid
+		} else {
+			hi, found = mid, t
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchEarliest(t *testing.T) {
+	tests := []struct {
+		name           string
+		cutoff, latest int64 // probe returns a trade for ids at or above cutoff
+	}{
+		{"served from 0", 0, 1000},
+		{"cutoff 1", 1, 1000},
+		{"cutoff in the middle", 517, 1000},
+		{"only the latest", 1000, 1000},
+		{"large ids", 123456789, 987654321},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes := 0
+			probe := func(id int64) (*AggTrade, error) {
+				probes++
+				if id < tt.cutoff {
+					return nil, nil
+				}
+				return &AggTrade{TradeId: id}, nil
+			}
+			got, err := searchEarliest(&AggTrade{TradeId: tt.latest}, probe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.TradeId != tt.cutoff {
+				t.Errorf("found tradeId %d, want %d", got.TradeId, tt.cutoff)
+			}
+			if limit := 1 + bits.Len64(uint64(tt.latest)); probes > limit {
+				t.Errorf("%d probes, want at most %d", probes, limit)
+			}
+		})
+	}
+}
+
+func TestSearchEarliestError(t *testing.T) {
+	want := errors.New("boom")
+	calls := 0
+	probe := func(id int64) (*AggTrade, error) {
+		if calls++; calls == 3 {
+			return nil, want
+		}
+		return nil, nil
+	}
+	if _, err := searchEarliest(&AggTrade{TradeId: 1000}, probe); !errors.Is(err, want) {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
+
+func TestResumeDay(t *testing.T) {
+	defer func(format string) { cfg.Format = format }(cfg.Format)
+	cfg.Format = "csv"
+	tests := []struct {
+		name   string
+		files  map[string][]string
+		fromId int64
+		want   int64
+	}{
+		{"nothing on disk", nil, 100, 100},
+		{"partial day", map[string][]string{"2023-11-14.csv": {"100", "101", "102"}}, 100, 103},
+		{"partial second part", map[string][]string{
+			"2023-11-14.csv":       {"100", "101"},
+			"2023-11-14.part2.csv": {"102", "103"},
+		}, 100, 104},
+		{"other dates only", map[string][]string{"2023-11-13.csv": {"1", "2"}}, 100, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeDateFiles(t, tt.files)
+			got, err := resumeDay("BTCUSDT", "2023-11-14", tt.fromId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resumeDay = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumeDayRemovesUnreadableFiles(t *testing.T) {
+	defer func(format string) { cfg.Format = format }(cfg.Format)
+	cfg.Format = "jsonl"
+	writeDateFiles(t, nil)
+	path := filepath.Join(cfg.OutDir, "BTCUSDT", "2023-11-14.jsonl")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := resumeDay("BTCUSDT", "2023-11-14", 100)
+	if err != nil || got != 100 {
+		t.Fatalf("resumeDay = %d, %v; want 100, nil", got, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s was not removed", path)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// httpClient is shared by every request so connections are reused.
+// configureHTTPClient applies the network flags to its transport.
+var (
+	httpTransport = http.DefaultTransport.(*http.Transport).Clone()
+	httpClient    = &http.Client{Timeout: 10 * time.Second, Transport: httpTransport}
+)
+
+const defaultAPIBase = "https://api.binance.com/api/v3"
+
+// REST endpoints; -base-url replaces them in configureEndpoints.
+var (
+	apiURL          = defaultAPIBase + "/aggTrades"
+	exchangeInfoURL = defaultAPIBase + "/exchangeInfo"
+	klinesURL       = defaultAPIBase + "/klines"
+	bookTickerURL   = defaultAPIBase + "/ticker/bookTicker"
+	ticker24hrURL   = defaultAPIBase + "/ticker/24hr"
+	pingURL         = defaultAPIBase + "/ping"
+	serverTimeURL   = defaultAPIBase + "/time"
+)
+
+// configureEndpoints applies -base-url. A URL whose path ends in /aggTrades
+// is used verbatim for aggTrades, and the other endpoints sit next to it; a
+// URL with no path gets /api/v3 appended; any other path is the prefix of
+// every endpoint.
+func configureEndpoints(base string) error {
+	if base == "" {
+		return nil
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid -base-url %q: want an http(s) URL such as http://localhost:8080/mock/aggTrades", base)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid -base-url %q: query parameters are added per request", base)
+	}
+	prefix := strings.TrimRight(base, "/")
+	switch {
+	case strings.Trim(u.Path, "/") == "":
+		prefix += "/api/v3"
+		apiURL = prefix + "/aggTrades"
+	case path.Base(u.Path) == "aggTrades":
+		apiURL = base
+		prefix = strings.TrimSuffix(prefix, "/aggTrades")
+	default:
+		apiURL = prefix + "/aggTrades"
+	}
+	exchangeInfoURL = prefix + "/exchangeInfo"
+	klinesURL = prefix + "/klines"
+	bookTickerURL = prefix + "/ticker/bookTicker"
+	ticker24hrURL = prefix + "/ticker/24hr"
+	pingURL = prefix + "/ping"
+	serverTimeURL = prefix + "/time"
+	return nil
+}
+
+func configureHTTPClient() error {
+	if err := configureExchange(cfg.Exchange); err != nil {
+		return err
+	}
+	if err := configureEndpoints(cfg.BaseURL); err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	network := "tcp"
+	switch cfg.IPVersion {
+	case "", "any":
+	case "4":
+		network = "tcp4"
+	case "6":
+		network = "tcp6"
+	default:
+		return fmt.Errorf("invalid -ip-version %q (want 4 or 6)", cfg.IPVersion)
+	}
+
+	if cfg.LocalAddr != "" {
+		ip := net.ParseIP(cfg.LocalAddr)
+		if ip == nil {
+			return fmt.Errorf("invalid -local-addr %q: not an IP address", cfg.LocalAddr)
+		}
+		if (network == "tcp4" && ip.To4() == nil) || (network == "tcp6" && ip.To4() != nil) {
+			return fmt.Errorf("-local-addr %s does not match -ip-version=%s", ip, cfg.IPVersion)
+		}
+		if !localAddrAssigned(ip) {
+			return fmt.Errorf("-local-addr %s is not assigned to any interface on this host", ip)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	if err := configurePool(); err != nil {
+		return err
+	}
+	if err := configureTLS(); err != nil {
+		return err
+	}
+
+	if cfg.DNS == "" {
+		httpTransport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			transferStats.conns.Add(1)
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return nil
+	}
+
+	server, err := dnsServerAddr(cfg.DNS)
+	if err != nil {
+		return err
+	}
+	// -dns 서버로 먼저 조회하고, 이름 해석에 실패하면 시스템 리졸버로 한 번 더
+	custom := *dialer
+	custom.Resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, proto, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, proto, server)
+		},
+	}
+	httpTransport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		transferStats.conns.Add(1)
+		conn, err := custom.DialContext(ctx, network, addr)
+		var dnsErr *net.DNSError
+		if err != nil && errors.As(err, &dnsErr) && ctx.Err() == nil {
+			fmt.Printf("DNS lookup via %s failed (%v), retrying with the system resolver\n", server, dnsErr)
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return conn, err
+	}
+	return nil
+}
+
+// configurePool applies -max-idle-conns, -max-conns-per-host and
+// -idle-conn-timeout. Every request goes to the one API host, so the idle
+// limit is also the per-host limit; the transport's default of 2 idle
+// connections per host makes concurrent symbols dial a new connection (and
+// TLS handshake) for most requests.
+func configurePool() error {
+	if cfg.MaxIdleConns < 0 {
+		return fmt.Errorf("invalid -max-idle-conns %d: must not be negative", cfg.MaxIdleConns)
+	}
+	if cfg.MaxConnsPerHost < 0 {
+		return fmt.Errorf("invalid -max-conns-per-host %d: must not be negative", cfg.MaxConnsPerHost)
+	}
+	if cfg.IdleConnTimeout < 0 {
+		return fmt.Errorf("invalid -idle-conn-timeout %s: must not be negative", cfg.IdleConnTimeout)
+	}
+	httpTransport.MaxIdleConns = cfg.MaxIdleConns
+	httpTransport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	httpTransport.DisableKeepAlives = cfg.MaxIdleConns == 0
+	httpTransport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	httpTransport.IdleConnTimeout = cfg.IdleConnTimeout
+	return nil
+}
+
+// configureTLS applies -ca-cert and -insecure-skip-verify to httpTransport.
+func configureTLS() error {
+	if cfg.CACert == "" && !cfg.InsecureSkipVerify {
+		return nil
+	}
+	tlsConfig := &tls.Config{}
+	if httpTransport.TLSClientConfig != nil {
+		tlsConfig = httpTransport.TLSClientConfig.Clone()
+	}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return fmt.Errorf("reading -ca-cert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("-ca-cert %s: no PEM certificates found", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.InsecureSkipVerify {
+		fmt.Println("WARNING: -insecure-skip-verify is set: TLS certificates are NOT verified and API responses can be forged by anyone on the network path")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	httpTransport.TLSClientConfig = tlsConfig
+	return nil
+}
+
+// dnsServerAddr validates -dns: an IP address with an optional port (53 by
+// default).
+func dnsServerAddr(s string) (string, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		host, port = strings.Trim(s, "[]"), "53"
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid -dns %q: want an IP address with an optional port, e.g. 1.1.1.1:53", s)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid -dns %q: bad port %q", s, port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func localAddrAssigned(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return true // 확인할 수 없으면 연결 시점의 오류에 맡김
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+var transferStats struct {
+	wire    atomic.Int64 // bytes as received
+	decoded atomic.Int64 // bytes after decompression
+	conns   atomic.Int64 // connections dialed
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// doGzip sends req asking for a gzip body and decodes it itself, rather
+// than leaving it to the transport, so the compressed size can be measured.
+// The returned body yields decompressed bytes; done must be called after it
+// is consumed, and records the sizes.
+func doGzip(req *http.Request) (resp *http.Response, body io.Reader, done func(), err error) {
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = httpClient.Do(req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	wire := &countingReader{r: resp.Body}
+	decoded := &countingReader{r: wire}
+	gzipped := resp.Header.Get("Content-Encoding") == "gzip"
+	if gzipped {
+		zr, err := gzip.NewReader(wire)
+		if err != nil {
+			resp.Body.Close()
+			return nil, nil, nil, err
+		}
+		decoded.r = zr
+	}
+	done = func() {
+		io.Copy(io.Discard, decoded)
+		transferStats.wire.Add(wire.n)
+		transferStats.decoded.Add(decoded.n)
+		throughput.add(1, wire.n, 0)
+		if gzipped {
+			debugf("%s: %d bytes gzip, %d bytes decoded (%.0f%%)\n", req.URL.Path, wire.n, decoded.n, 100*float64(wire.n)/float64(max(decoded.n, 1)))
+		} else {
+			debugf("%s: %d bytes, not compressed\n", req.URL.Path, wire.n)
+		}
+	}
+	return resp, decoded, done, nil
+}
+
+func transferSummary() string {
+	wire, decoded := transferStats.wire.Load(), transferStats.decoded.Load()
+	if decoded == 0 {
+		return "no data transferred"
+	}
+	return fmt.Sprintf("%.1f MB received, %.1f MB decoded (%.0f%% of decoded size on the wire), %d connections opened",
+		float64(wire)/(1<<20), float64(decoded)/(1<<20), 100*float64(wire)/float64(decoded), transferStats.conns.Load())
+}
+
+func debugf(format string, args ...any) {
+	if cfg.Debug {
+		fmt.Printf(format, args...)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+type jsonTrade struct {
+	TradeId      int64         `json:"tradeId"`
+	Price        string        `json:"price"`
+	Quantity     string        `json:"quantity"`
+	Timestamp    jsonTimestamp `json:"timestamp"`
+	IsBuyerMaker bool          `json:"isBuyerMaker"`
+	QuoteQty     string        `json:"quoteQty,omitempty"`
+}
+
+func toJSONTrade(trade AggTrade) jsonTrade {
+	jt := jsonTrade{
+		TradeId:      trade.TradeId,
+		Price:        trade.Price,
+		Quantity:     trade.Quantity,
+		Timestamp:    jsonTimestamp(trade.Timestamp),
+		IsBuyerMaker: trade.IsMaker,
+	}
+	if cfg.QuoteQty {
+		jt.QuoteQty, _ = mulDecimal(trade.Price, trade.Quantity)
+	}
+	return jt
+}
+
+// jsonTimestamp is a millisecond timestamp encoded in -timestamp-format: a
+// number, or a string for iso8601.
+type jsonTimestamp int64
+
+func (t jsonTimestamp) MarshalJSON() ([]byte, error) {
+	s := formatTimestamp(int64(t))
+	if cfg.TimestampFormat == "iso8601" {
+		return json.Marshal(s)
+	}
+	return []byte(s), nil
+}
+
+// jsonFields are the canonical JSON keys in output order.
+var jsonFields = []string{"tradeId", "price", "quantity", "timestamp", "isBuyerMaker", "quoteQty"}
+
+// jsonKeys renames canonical keys in JSON output (-json-fields); nil keeps
+// them. It is set once by newSink.
+var jsonKeys map[string]string
+
+// parseJSONFields parses -json-fields, "tradeId=trade_id,price=exec_price",
+// checking that every source is a known field and every key is unique.
+func parseJSONFields(spec string) (map[string]string, error) {
+	pairs := splitList(spec)
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	keys := make(map[string]string)
+	for _, pair := range pairs {
+		field, key, ok := strings.Cut(pair, "=")
+		field, key = strings.TrimSpace(field), strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid -json-fields entry %q (want field=key)", pair)
+		}
+		if !slices.Contains(jsonFields, field) {
+			return nil, fmt.Errorf("unknown field %q in -json-fields (want one of %s)", field, strings.Join(jsonFields, ", "))
+		}
+		keys[field] = key
+	}
+	seen := make(map[string]string)
+	for _, field := range jsonFields {
+		key := jsonKey(keys, field)
+		if other, dup := seen[key]; dup {
+			return nil, fmt.Errorf("-json-fields maps both %s and %s to %q", other, field, key)
+		}
+		seen[key] = field
+	}
+	return keys, nil
+}
+
+func jsonKey(keys map[string]string, field string) string {
+	if key, ok := keys[field]; ok {
+		return key
+	}
+	return field
+}
+
+// marshalTrade encodes one trade, under the -json-fields names if any.
+func marshalTrade(trade AggTrade) ([]byte, error) {
+	jt := toJSONTrade(trade)
+	if jsonKeys == nil {
+		return json.Marshal(jt)
+	}
+	values := []any{jt.TradeId, jt.Price, jt.Quantity, jt.Timestamp, jt.IsBuyerMaker, jt.QuoteQty}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range jsonFields {
+		if field == "quoteQty" && jt.QuoteQty == "" {
+			continue // omitempty
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(jsonKey(jsonKeys, field))
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func saveToJSONL(filePath string, trades []AggTrade) error {
+	return appendFile(filePath, func(file *os.File, _ bool) error {
+		w := fileBuffer(file)
+		for _, trade := range trades {
+			data, err := marshalTrade(trade)
+			if err != nil {
+				return err
+			}
+			w.Write(data)
+			w.WriteByte('\n')
+		}
+		return w.Flush()
+	})
+}
+
+const (
+	jsonArrayEnd   = "\n]\n"
+	jsonEmptyArray = "[" + jsonArrayEnd
+)
+
+// saveToJSON appends trades to a file holding one JSON array, <date>.json.
+// The closing bracket is cut off and rewritten after the new elements, so
+// the file is a complete array after every page. With -pretty each element
+// is indented.
+func saveToJSON(filePath string, trades []AggTrade) error {
+	return appendFile(filePath, func(file *os.File, isNewFile bool) error {
+		w := fileBuffer(file)
+		first := true
+		if isNewFile {
+			w.WriteString("[")
+		} else {
+			info, err := file.Stat()
+			if err != nil {
+				return err
+			}
+			tail, err := readTail(filePath, info.Size(), len(jsonEmptyArray))
+			if err != nil {
+				return err
+			}
+			if !bytes.HasSuffix(tail, []byte(jsonArrayEnd)) {
+				return fmt.Errorf("%s does not end with a JSON array", filePath)
+			}
+			first = string(tail) == jsonEmptyArray
+			if err := file.Truncate(info.Size() - int64(len(jsonArrayEnd))); err != nil {
+				return err
+			}
+		}
+		for _, trade := range trades {
+			data, err := marshalTrade(trade)
+			if err != nil {
+				return err
+			}
+			if cfg.Pretty {
+				var indented bytes.Buffer
+				if err := json.Indent(&indented, data, "  ", "  "); err != nil {
+					return err
+				}
+				data = indented.Bytes()
+			}
+			if first {
+				w.WriteString("\n")
+				first = false
+			} else {
+				w.WriteString(",\n")
+			}
+			if cfg.Pretty {
+				w.WriteString("  ")
+			}
+			w.Write(data)
+		}
+		w.WriteString(jsonArrayEnd)
+		return w.Flush()
+	})
+}
+
+// readTail reads up to n bytes that end at offset size; file is only open
+// for appending, so the end is read through a second handle.
+func readTail(path string, size int64, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tail := make([]byte, min(size, int64(n)))
+	if _, err := f.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return nil, err
+	}
+	return tail, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// klineIntervals are the intervals /api/v3/klines accepts.
+var klineIntervals = []string{"1s", "1m", "3m", "5m", "15m", "30m", "1h", "2h", "4h", "6h", "8h", "12h", "1d", "3d", "1w", "1M"}
+
+type Kline struct {
+	OpenTime      int64
+	Open          string
+	High          string
+	Low           string
+	Close         string
+	Volume        string
+	CloseTime     int64
+	QuoteVolume   string
+	Trades        int64
+	TakerBuyBase  string
+	TakerBuyQuote string
+}
+
+// UnmarshalJSON decodes the API's positional array form of a kline.
+func (k *Kline) UnmarshalJSON(data []byte) error {
+	fields := []any{&k.OpenTime, &k.Open, &k.High, &k.Low, &k.Close, &k.Volume,
+		&k.CloseTime, &k.QuoteVolume, &k.Trades, &k.TakerBuyBase, &k.TakerBuyQuote}
+	return json.Unmarshal(data, &fields)
+}
+
+var klineCSVHeader = []string{"openTime", "open", "high", "low", "close", "volume", "closeTime", "quoteVolume", "trades", "takerBuyBase", "takerBuyQuote"}
+
+func klineRecord(k Kline) []string {
+	return []string{
+		strconv.FormatInt(k.OpenTime, 10), k.Open, k.High, k.Low, k.Close, k.Volume,
+		strconv.FormatInt(k.CloseTime, 10), k.QuoteVolume, strconv.FormatInt(k.Trades, 10),
+		k.TakerBuyBase, k.TakerBuyQuote,
+	}
+}
+
+func parseIntervals(list string) ([]string, error) {
+	intervals := splitList(list)
+	for _, interval := range intervals {
+		if !slices.Contains(klineIntervals, interval) {
+			return nil, fmt.Errorf("invalid -interval %q (want one of %s)", interval, strings.Join(klineIntervals, ", "))
+		}
+	}
+	return intervals, nil
+}
+
+func fetchKlines(symbol, interval string, startTime int64, end time.Time) ([]Kline, error) {
+	req, err := http.NewRequest("GET", klinesURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	q.Add("symbol", symbol)
+	q.Add("interval", interval)
+	q.Add("startTime", strconv.FormatInt(startTime, 10))
+	if !end.IsZero() {
+		q.Add("endTime", strconv.FormatInt(end.UnixMilli()-1, 10))
+	}
+	q.Add("limit", strconv.Itoa(limitPerReq))
+	req.URL.RawQuery = q.Encode()
+
+	start := time.Now()
+	defer func() { observeFetch(symbol, req.URL.RawQuery, time.Since(start)) }()
+
+	resp, body, done, err := doGzip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	defer done()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(body)
+		return nil, parseAPIError(resp.StatusCode, bodyBytes)
+	}
+
+	var klines []Kline
+	if err := json.NewDecoder(body).Decode(&klines); err != nil {
+		return nil, err
+	}
+	return klines, nil
+}
+
+// klineDir is where one interval's date files go: <symbol>/klines-<interval>.
+func klineDir(symbol, interval string) string {
+	return symbolPath(symbol, "klines-"+interval)
+}
+
+// lastKlineOnDisk returns the openTime of the last kline in the newest date
+// file of an interval. ok is false when there is none.
+func lastKlineOnDisk(dir string) (openTime int64, ok bool, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return 0, false, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".csv") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for i := len(names) - 1; i >= 0; i-- {
+		path := filepath.Join(dir, names[i])
+		record, err := lastRecord(path)
+		if err != nil {
+			return 0, false, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if record == nil || strings.TrimPrefix(record[0], utf8BOM) == "openTime" {
+			continue
+		}
+		openTime, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("reading %s: bad openTime %q", path, record[0])
+		}
+		return openTime, true, nil
+	}
+	return 0, false, nil
+}
+
+// processKlines pages one symbol's klines for one interval forward by
+// startTime, from -start-time (or the last kline on disk when resuming) until
+// -end-time or the current, still open kline. Each interval has its own
+// cursor; all of them share the collector's limiter.
+func (c *Collector) processKlines(ctx context.Context, symbol, interval string) error {
+	name := symbol + " " + interval
+	fmt.Printf("Starting %s kline collection for %s...\n", interval, symbol)
+	progress.start(name)
+	defer progress.finish(name)
+
+	dir := klineDir(symbol, interval)
+	if err := os.MkdirAll(dir, cfg.DirMode.Perm()); err != nil {
+		fmt.Printf("Error creating directory for %s: %v\n", name, err)
+		return err
+	}
+
+	var startTime int64
+	windowStart, windowEnd := collectWindow()
+	if !windowStart.IsZero() {
+		startTime = windowStart.UnixMilli()
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		last, ok, err := lastKlineOnDisk(dir)
+		if err != nil {
+			fmt.Printf("Error reading existing klines for %s: %v\n", name, err)
+			return err
+		}
+		switch choosePolicy(name, dir, len(existing), ok, "the files end at an openTime") {
+		case "fail":
+			fmt.Printf("Not collecting %s: pass -on-existing=append|resume|overwrite to use its existing files\n", name)
+			return fmt.Errorf("%s already has files in %s", name, dir)
+		case "overwrite":
+			for _, path := range existing {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("Removed %d existing file(s) of %s\n", len(existing), name)
+		case "resume":
+			if ok {
+				startTime = last + 1
+				fmt.Printf("Updating %s klines from startTime(%d)\n", name, startTime)
+			}
+		}
+	}
+
+	saveFails := 0
+	for {
+		if ctx.Err() != nil {
+			fmt.Printf("Stopping %s at startTime(%d): %v\n", name, startTime, context.Cause(ctx))
+			return errAborted
+		}
+		waitWhilePaused(ctx, name)
+		if ctx.Err() != nil {
+			continue
+		}
+		c.waitTurn(name, requestWeight("klines", limitPerReq))
+		fmt.Printf("sym(%s) interval(%s) startTime(%d)\n", symbol, interval, startTime)
+
+		klines, err := fetchKlines(symbol, interval, startTime, windowEnd)
+		if err != nil {
+			if !shouldRetry(err) {
+				fmt.Printf("Stopping %s: %v\n", name, err)
+				return err
+			}
+			fmt.Printf("Error fetching klines for %s: %v\n", name, err)
+			retryDelay(ctx, name, 5*time.Second) // 에러 발생 시 대기
+			continue
+		}
+		progress.fetched(name, startTime, len(klines))
+		pageDelay(ctx)
+
+		// 아직 닫히지 않은 캔들은 쓰지 않음
+		now := time.Now().UnixMilli()
+		closed := klines
+		for len(closed) > 0 && closed[len(closed)-1].CloseTime >= now {
+			closed = closed[:len(closed)-1]
+		}
+		if len(closed) == 0 {
+			fmt.Printf("No more closed %s klines for %s. Finished.\n", interval, symbol)
+			return nil
+		}
+
+		if err := checkDiskSpace(); err != nil {
+			fmt.Printf("Stopping %s at startTime(%d): %v\n", name, startTime, err)
+			return err
+		}
+		if err := saveKlines(dir, closed); err != nil {
+			if err := saveFailed(&saveFails, err); err != nil {
+				fmt.Printf("Stopping %s at startTime(%d): %v\n", name, startTime, err)
+				return err
+			}
+			fmt.Printf("Error saving klines for %s at startTime(%d), retrying: %v\n", name, startTime, err)
+			retryDelay(ctx, name, 5*time.Second)
+			continue
+		}
+		saveFails = 0
+		lastDate := time.UnixMilli(closed[len(closed)-1].OpenTime).In(cfg.Location).Format("2006-01-02")
+		progress.written(name, startTime, lastDate, len(closed))
+
+		startTime = closed[len(closed)-1].OpenTime + 1
+		if len(closed) < len(klines) {
+			fmt.Printf("Reached the open %s kline for %s. Finished.\n", interval, symbol)
+			return nil
+		}
+	}
+}
+
+// saveKlines appends klines to <dir>/<date>.csv by openTime date. A failed
+// page is rolled back so the retry does not duplicate rows.
+func saveKlines(dir string, klines []Kline) error {
+	var dates []string
+	byDate := make(map[string][][]string)
+	for _, k := range klines {
+		date := time.UnixMilli(k.OpenTime).In(cfg.Location).Format("2006-01-02")
+		if _, ok := byDate[date]; !ok {
+			dates = append(dates, date)
+		}
+		byDate[date] = append(byDate[date], klineRecord(k))
+	}
+	var marks []fileMark
+	for _, date := range dates {
+		path := filepath.Join(dir, date+".csv")
+		marks = append(marks, markFile(path))
+		if err := appendCSV(path, klineCSVHeader, byDate[date]); err != nil {
+			rollbackFiles(marks)
+			return fmt.Errorf("saving %s: %w", path, err)
+		}
+	}
+	return nil
+}
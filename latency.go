@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyHistogram counts request durations into fixed buckets; the last
+// bucket is open-ended.
+type latencyHistogram struct {
+	mu     sync.Mutex
+	bounds []time.Duration
+	counts []int64
+	total  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+var fetchLatency = newLatencyHistogram(
+	50*time.Millisecond, 100*time.Millisecond, 250*time.Millisecond, 500*time.Millisecond,
+	time.Second, 2500*time.Millisecond, 5*time.Second, 10*time.Second,
+)
+
+func newLatencyHistogram(bounds ...time.Duration) *latencyHistogram {
+	return &latencyHistogram{bounds: bounds, counts: make([]int64, len(bounds)+1)}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.total++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+func (h *latencyHistogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return "no requests\n"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d requests, avg %v, max %v\n", h.total, (h.sum / time.Duration(h.total)).Round(time.Millisecond), h.max.Round(time.Millisecond))
+	for i, n := range h.counts {
+		label := "> " + h.bounds[len(h.bounds)-1].String()
+		if i < len(h.bounds) {
+			label = "<= " + h.bounds[i].String()
+		}
+		fmt.Fprintf(&b, "  %-10s %d\n", label, n)
+	}
+	return b.String()
+}
+
+func observeFetch(symbol, query string, d time.Duration) {
+	fetchLatency.observe(d)
+	if cfg.SlowThreshold > 0 && d > cfg.SlowThreshold {
+		fmt.Printf("Warning: slow request for %s (%s) took %v (-slow-threshold=%v)\n", symbol, query, d.Round(time.Millisecond), cfg.SlowThreshold)
+	}
+}
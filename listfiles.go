@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// listedFile is one line (or -json element) of list-files.
+type listedFile struct {
+	Symbol string `json:"symbol"`
+	File   string `json:"file"`           // relative to -out
+	Date   string `json:"date,omitempty"` // 청크 파일은 날짜 없음
+	Rows   *int64 `json:"rows"`           // nil: 세지 못함 (.json, .avro)
+	Bytes  int64  `json:"bytes"`
+	Source string `json:"source"` // manifest, scan or none
+}
+
+// runListFiles implements the list-files subcommand: every date (or chunk)
+// file of the symbols with its row count and size, taking row counts from
+// the manifest where it has the file and counting lines otherwise.
+func runListFiles(args []string) int {
+	fs := flag.NewFlagSet("list-files", flag.ExitOnError)
+	registerFlags(fs)
+	var asJSON bool
+	fs.BoolVar(&asJSON, "json", false, "print a JSON array instead of a table")
+	if err := parseArgs(fs, args); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	symbols, err := explicitSymbols()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if !flagWasSet(fs, "symbols") && cfg.SymbolsFile == "" {
+		if symbols, err = listSymbolDirs(cfg.OutDir); err != nil {
+			fmt.Printf("Error listing %s: %v\n", cfg.OutDir, err)
+			return 1
+		}
+	}
+
+	failed := false
+	all := []listedFile{}
+	for _, symbol := range symbols {
+		files, err := listSymbolFiles(symbol)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing %s: %v\n", symbol, err)
+			failed = true
+		}
+		all = append(all, files...)
+	}
+
+	if asJSON {
+		data, _ := json.MarshalIndent(all, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printListedFiles(all)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// listSymbolFiles lists a symbol's date and chunk files, in any -format and
+// with or without -final-compression, in name order.
+func listSymbolFiles(symbol string) ([]listedFile, error) {
+	entries, err := os.ReadDir(symbolDirIn(cfg.OutDir, symbol))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadManifestIn(cfg.OutDir, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []listedFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name, compressed := entry.Name(), ""
+		for _, suffix := range []string{".gz", ".zst"} {
+			if base, ok := strings.CutSuffix(name, suffix); ok {
+				name, compressed = base, suffix
+			}
+		}
+		ext := filepath.Ext(name)
+		if _, ok := sinkFormats[strings.TrimPrefix(ext, ".")]; !ok {
+			continue
+		}
+		date, _, isDate := parseDateFileName(symbol, name, ext)
+		if _, isChunk := parseChunkFileName(symbol, name, ext); !isDate && !isChunk {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return files, err
+		}
+
+		path := filepath.Join(symbolDirIn(cfg.OutDir, symbol), entry.Name())
+		rel, _ := filepath.Rel(cfg.OutDir, path)
+		f := listedFile{Symbol: symbol, File: rel, Date: date, Bytes: info.Size(), Source: "none"}
+		if r, ok := m.Files[name]; ok { // 매니페스트는 압축 전 이름으로 기록
+			f.Rows, f.Source = &r.Rows, "manifest"
+		} else if ext == ".csv" || ext == ".jsonl" {
+			rows, err := countFileRows(path, ext, compressed)
+			if err != nil {
+				return files, fmt.Errorf("%s: %w", path, err)
+			}
+			f.Rows, f.Source = &rows, "scan"
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].File < files[j].File })
+	return files, nil
+}
+
+// countFileRows counts the rows of a CSV or JSONL file, decompressing it
+// first when compressed is ".gz" or ".zst".
+func countFileRows(path, ext, compressed string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r, done, err := decompressReader(f, compressed)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	var lines int64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if ext == ".csv" && lines > 0 {
+		lines-- // 헤더
+	}
+	return lines, nil
+}
+
+func printListedFiles(files []listedFile) {
+	symbol := ""
+	var rows, size int64
+	total := func() {
+		if symbol != "" {
+			fmt.Printf("%-28s %12d rows %14d bytes\n", symbol+" total", rows, size)
+		}
+	}
+	for _, f := range files {
+		if f.Symbol != symbol {
+			total()
+			symbol, rows, size = f.Symbol, 0, 0
+		}
+		count := "?"
+		if f.Rows != nil {
+			count = fmt.Sprint(*f.Rows)
+			rows += *f.Rows
+		}
+		size += f.Bytes
+		fmt.Printf("%-28s %12s rows %14d bytes  (%s)\n", f.File, count, f.Bytes, f.Source)
+	}
+	total()
+}
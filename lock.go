@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errLocked = errors.New("locked")
+
+// acquireOutLock takes <out>/.lock so that a second collector cannot write to
+// the same directory. With wait it polls until the holder exits.
+func acquireOutLock(dir string, wait bool) (release func(), err error) {
+	path := filepath.Join(dir, ".lock")
+	for {
+		release, err = lockFile(path)
+		if !errors.Is(err, errLocked) {
+			return release, err
+		}
+		holder := "another process"
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			holder = "pid " + strings.TrimSpace(string(data))
+		}
+		if !wait {
+			return nil, fmt.Errorf("%s is already in use by %s (lock %s); use -lock-wait to wait for it", dir, holder, path)
+		}
+		fmt.Printf("%s is in use by %s, waiting...\n", dir, holder)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func pidString() string {
+	return strconv.Itoa(os.Getpid()) + "\n"
+}
@@ -0,0 +1,27 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// Without flock the lock is the file's existence; a crashed run leaves it
+// behind and it must be removed by hand.
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, cfg.FileMode.Perm())
+	if os.IsExist(err) {
+		return nil, errLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.WriteString(pidString())
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
+
+func withFileLock(f *os.File, fn func() error) error {
+	return errors.New("file locks are not supported on this platform")
+}
@@ -1,45 +1,70 @@
 package main
 
 import (
-	"encoding/csv"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Limiter gates outgoing requests; Wait blocks until a request of the given
+// weight (see requestWeight) is allowed.
+type Limiter interface {
+	Wait(weight int)
+}
+
 type RateLimiter struct {
 	mu          sync.Mutex
+	clock       Clock
 	count       int
 	limitPerMin int
+	windowStart time.Time
 	resetTime   time.Time
 }
 
-func NewRateLimiter(limit int) *RateLimiter {
+// NewRateLimiter allows limit weight per 61-second window, timed by clock:
+// realClock{} for requests, a manualClock in tests to step through windows.
+func NewRateLimiter(limit int, clock Clock) *RateLimiter {
+	now := clock.Now()
 	return &RateLimiter{
+		clock:       clock,
 		limitPerMin: limit,
-		resetTime:   time.Now().Add(61 * time.Second),
+		windowStart: now,
+		resetTime:   now.Add(61 * time.Second),
 	}
 }
 
-func (rl *RateLimiter) Wait() {
+func (rl *RateLimiter) Wait(weight int) {
 	for {
 		rl.mu.Lock()
 
-		now := time.Now()
-		if now.After(rl.resetTime) {
-			fmt.Printf("--- Request count reset. Previous minute's count: %d ---\n", rl.count)
+		now := rl.clock.Now()
+		if !now.Before(rl.resetTime) { // resetTime까지 딱 맞춰 잔 경우도 새 창
+			next := now.Add(61 * time.Second)
+			// 목표 -rate 조정용: 이전 창의 사용량과 다음 리셋 시각
+			debugf("limiter reset: prev_weight=%d limit=%d used=%.0f%% window_start=%s window_end=%s next_reset=%s\n",
+				rl.count, rl.limitPerMin, 100*float64(rl.count)/float64(rl.limitPerMin),
+				rl.windowStart.Format(time.RFC3339), now.Format(time.RFC3339), next.Format(time.RFC3339))
 			rl.count = 0
-			rl.resetTime = now.Add(61 * time.Second)
+			rl.windowStart, rl.resetTime = now, next
 		}
 
-		if rl.count < rl.limitPerMin {
-			rl.count++
-			fmt.Printf("Request permitted. Current minute's count: %d/%d\n", rl.count, rl.limitPerMin)
+		if rl.count+weight <= rl.limitPerMin || rl.count == 0 {
+			rl.count += weight
+			fmt.Printf("Request permitted. Current minute's weight: %d/%d\n", rl.count, rl.limitPerMin)
 			rl.mu.Unlock()
 			return
 		}
@@ -50,11 +75,41 @@ func (rl *RateLimiter) Wait() {
 
 		if sleepDuration > 0 {
 			fmt.Printf("Rate limit reached. Waiting for %v...\n", sleepDuration)
-			time.Sleep(sleepDuration)
+			rl.clock.Sleep(sleepDuration)
 		}
 	}
 }
 
+// alignToServer starts the first window at the server's current minute and
+// with the weight the server has already counted for this IP in it
+// (-align-limiter), from one /api/v3/time request. The window still ends a
+// second after the server's minute, as later ones last 61 seconds.
+func (rl *RateLimiter) alignToServer() error {
+	var st struct {
+		ServerTime int64 `json:"serverTime"`
+	}
+	sent := rl.clock.Now()
+	resp, err := apiGet(serverTimeURL, &st)
+	if err != nil {
+		return err
+	}
+	received := rl.clock.Now()
+	used, err := strconv.Atoi(resp.Header.Get(weightHeader()))
+	if err != nil {
+		return fmt.Errorf("no usable %s header in the /time response", weightHeader())
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	server := time.UnixMilli(st.ServerTime)
+	start := local.Add(-server.Sub(server.Truncate(time.Minute)))
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.count, rl.windowStart, rl.resetTime = used, start, start.Add(61*time.Second)
+	fmt.Printf("Limiter aligned to the server minute: %d/%d weight already used, next reset in %s\n",
+		used, rl.limitPerMin, rl.resetTime.Sub(received).Round(time.Second))
+	return nil
+}
+
 type AggTrade struct {
 	TradeId   int64  `json:"a"`
 	Price     string `json:"p"`
@@ -67,12 +122,31 @@ type AggTrade struct {
 }
 
 const (
-	apiURL       = "https://api.binance.com/api/v3/aggTrades"
 	limitPerReq  = 1000
 	maxReqPerMin = 1499 // 6000 (총 가중치) / 4 (요청당 가중치)
 )
 
 func fetchTrades(symbol string, fromId int64) ([]AggTrade, error) {
+	if cfg.Replay != "" {
+		return replayTrades(symbol, fromId)
+	}
+	params := url.Values{}
+	params.Add("fromId", strconv.FormatInt(fromId, 10))
+	if cfg.RecordResponses == "" {
+		return fetchAggTrades(symbol, params)
+	}
+	return fetchAggTradesRaw(symbol, params, func(raw []byte) { recordResponse(symbol, fromId, raw) })
+}
+
+// fetchAggTrades requests one page of aggTrades; params carries fromId or
+// startTime/endTime. With neither, the API returns the most recent trades.
+func fetchAggTrades(symbol string, params url.Values) ([]AggTrade, error) {
+	return fetchAggTradesRaw(symbol, params, nil)
+}
+
+// fetchAggTradesRaw is fetchAggTrades that also passes the raw body of a 200
+// response to record, if not nil, before decoding it.
+func fetchAggTradesRaw(symbol string, params url.Values, record func(raw []byte)) (trades []AggTrade, err error) {
 	req, err := http.NewRequest("GET", apiURL, nil)
 	if err != nil {
 		return nil, err
@@ -80,120 +154,875 @@ func fetchTrades(symbol string, fromId int64) ([]AggTrade, error) {
 
 	q := req.URL.Query()
 	q.Add("symbol", symbol)
-	q.Add("limit", strconv.Itoa(limitPerReq))
-	q.Add("fromId", strconv.FormatInt(fromId, 10))
+	if !params.Has("limit") {
+		q.Add("limit", strconv.Itoa(limitPerReq))
+	}
+	for key, values := range params {
+		for _, v := range values {
+			q.Add(key, v)
+		}
+	}
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	start := time.Now()
+	defer func() { observeFetch(symbol, req.URL.RawQuery, time.Since(start)) }()
+	defer func() { fetchErrors.record(symbol, err) }()
+
+	resp, body, done, err := doGzip(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	defer done()
+	logUsedWeight(symbol, resp.Header)
 
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: status code %d, body: %s", resp.StatusCode, string(bodyBytes))
+		bodyBytes, _ := io.ReadAll(body)
+		return nil, parseAPIError(resp.StatusCode, bodyBytes)
 	}
 
+	// 디코딩에 실패하면 dead letter로 남길 수 있도록 본문을 함께 보관
+	var raw bytes.Buffer
+	if record != nil {
+		if _, err := raw.ReadFrom(body); err != nil {
+			return nil, err
+		}
+		record(raw.Bytes())
+		body = bytes.NewReader(raw.Bytes())
+	} else {
+		body = io.TeeReader(body, &raw)
+	}
+	trades, err = decodeAggTrades(body)
+	if errors.Is(err, errBadPage) {
+		if record == nil {
+			io.Copy(io.Discard, body) // 디코더가 읽지 않은 나머지도 raw로
+		}
+		saveDeadLetter(symbol, req.URL.String(), resp.StatusCode, raw.Bytes(), err)
+	}
+	return trades, err
+}
+
+func decodeAggTrades(body io.Reader) ([]AggTrade, error) {
 	var trades []AggTrade
-	if err := json.NewDecoder(resp.Body).Decode(&trades); err != nil {
+	if err := json.NewDecoder(body).Decode(&trades); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("%w: %v", errBadPage, err)
+		}
 		return nil, err
 	}
-
 	return trades, nil
 }
 
-func processSymbol(symbol string, rl *RateLimiter) {
+func (c *Collector) processSymbol(ctx context.Context, symbol string) error {
 	fmt.Printf("Starting data collection for %s...\n", symbol)
-	if err := os.MkdirAll(symbol, os.ModePerm); err != nil {
+	progress.start(symbol)
+	defer progress.finish(symbol)
+	if err := os.MkdirAll(symbolDir(symbol), cfg.DirMode.Perm()); err != nil {
 		fmt.Printf("Error creating directory for %s: %v\n", symbol, err)
-		return
+		return err
 	}
 
 	var fromId int64 = 0
+	resumed := false
+
+	policy, _, lastId, ok, err := existingPolicy(symbol)
+	if err != nil {
+		fmt.Printf("Error reading existing data for %s: %v\n", symbol, err)
+		return err
+	}
+	switch {
+	case policy == "fail":
+		fmt.Printf("Not collecting %s: pass -update or -on-existing=append|resume|overwrite to use its existing files\n", symbol)
+		return fmt.Errorf("%s already has files in %s", symbol, symbolDir(symbol))
+	case policy == "resume" && ok:
+		fromId, resumed = lastId+1, true
+		fmt.Printf("Updating %s from fromId(%d) (highest tradeId on disk: %d)\n", symbol, fromId, lastId)
+	}
+
+	if id, ok := sinceIds.fromId(symbol); ok {
+		if resumed {
+			fmt.Printf("Starting %s from -since-trade-id fromId(%d) instead of fromId(%d) from the files\n", symbol, id, fromId)
+		} else {
+			fmt.Printf("Starting %s from -since-trade-id fromId(%d)\n", symbol, id)
+		}
+		fromId, resumed = id, true
+	}
+
+	if cfg.Replay != "" && !resumed {
+		first, err := firstRecordedId(symbol)
+		if err != nil {
+			fmt.Printf("Error reading recorded responses for %s: %v\n", symbol, err)
+			return err
+		}
+		fromId = first
+	}
+
+	start, end := collectWindow()
+	if !start.IsZero() && !resumed {
+		latest, err := fetchLatestTrade(symbol, c.limiter)
+		if err != nil {
+			fmt.Printf("Error finding the latest trade for %s: %v\n", symbol, err)
+			return err
+		}
+		if latest == nil {
+			return noTrades(symbol)
+		}
+		first, err := firstTradeAtOrAfter(symbol, start, latest, c.limiter)
+		if err != nil {
+			fmt.Printf("Error finding the first trade at %s for %s: %v\n", start.Format(time.RFC3339), symbol, err)
+			return err
+		}
+		if first == nil || (!end.IsZero() && first.Timestamp >= end.UnixMilli()) {
+			fmt.Printf("No trades for %s in the time range. Finished.\n", symbol)
+			return nil
+		}
+		fromId = first.TradeId
+		fmt.Printf("Starting %s at %s from fromId(%d)\n", symbol, start.Format(time.RFC3339), fromId)
+	}
+
+	var index *rangeIndex
+	if cfg.RangeIndex {
+		var err error
+		if index, err = loadRangeIndex(symbol); err != nil {
+			fmt.Printf("Error loading range index for %s: %v\n", symbol, err)
+			return err
+		}
+	}
+
+	var done *manifest // -skip-complete: dates finished by earlier runs
+	if cfg.SkipComplete {
+		var err error
+		if done, err = loadManifestIn(cfg.OutDir, symbol); err != nil {
+			fmt.Printf("Error loading manifest for %s: %v\n", symbol, err)
+			return err
+		}
+	}
+
+	if cfg.Source == "vision" {
+		var err error
+		if fromId, err = c.collectVision(ctx, symbol, fromId, end, index, done); err != nil {
+			fmt.Printf("Error reading dumps for %s: %v\n", symbol, err)
+			return c.flushed(symbol, err)
+		}
+	}
+
+	return c.collectFrom(ctx, symbol, fromId, end, index, done, cfg.AlignDays)
+}
+
+// collectFrom fetches forward from fromId until the latest trade or end (if
+// not zero). With finishLast, end is a midnight and the last date is marked
+// finished when it is reached.
+func (c *Collector) collectFrom(ctx context.Context, symbol string, fromId int64, end time.Time, index *rangeIndex, done *manifest, finishLast bool) error {
+	return c.flushed(symbol, c.collectPages(ctx, symbol, fromId, end, index, done, finishLast))
+}
+
+func (c *Collector) collectPages(ctx context.Context, symbol string, fromId int64, end time.Time, index *rangeIndex, done *manifest, finishLast bool) error {
+	var days dayTracker
+	stuck := 0 // fromId를 전진시키지 못한 연속 페이지 수
+	saveFails := 0
+	bad := badPages{symbol: symbol}
+	pages := 0
 
 	for {
-		rl.Wait()
+		if ctx.Err() != nil {
+			fmt.Printf("Stopping %s at fromId(%d): %v\n", symbol, fromId, context.Cause(ctx))
+			return errAborted
+		}
+		if cfg.MaxPages > 0 && pages >= cfg.MaxPages {
+			fmt.Printf("Reached -max-pages=%d for %s at fromId(%d). Stopping.\n", cfg.MaxPages, symbol, fromId)
+			return nil
+		}
+		if index != nil {
+			if next := index.skipForward(fromId); next != fromId {
+				fmt.Printf("sym(%s) ids %d-%d already written, skipping to fromId(%d)\n", symbol, fromId, next-1, next)
+				fromId = next
+			}
+		}
+		if done != nil {
+			if date, maxId, ok := done.completeDayAt(fromId); ok {
+				fmt.Printf("sym(%s) %s is already complete, skipping to fromId(%d)\n", symbol, date, maxId+1)
+				fromId = maxId + 1
+				continue
+			}
+		}
+
+		waitWhilePaused(ctx, symbol)
+		if ctx.Err() != nil {
+			continue
+		}
+		c.waitTurn(symbol, aggTradesWeight(limitPerReq))
 
 		fmt.Printf("sym(%s) fromId(%d)\n", symbol, fromId)
 
 		trades, err := fetchTrades(symbol, fromId)
 		if err != nil {
+			if !shouldRetry(err) {
+				fmt.Printf("Stopping %s: %v\n", symbol, err)
+				return err
+			}
 			fmt.Printf("Error fetching trades for %s: %v\n", symbol, err)
-			time.Sleep(5 * time.Second) // 에러 발생 시 대기
+			if err := fetchErrors.symbolExceeded(symbol); err != nil {
+				fmt.Printf("Stopping %s at fromId(%d): %v\n", symbol, fromId, err)
+				return err
+			}
+			if bad.failed(err) {
+				bad.skip(fromId, fromId+limitPerReq-1, err)
+				fromId += limitPerReq
+				continue
+			}
+			retryDelay(ctx, symbol, 5*time.Second) // 에러 발생 시 대기
 			continue
 		}
+		bad.ok()
+		pages++
 
+		progress.fetched(symbol, fromId, len(trades))
 		if len(trades) == 0 {
+			if fromId == 0 && pages == 1 {
+				return noTrades(symbol)
+			}
 			fmt.Printf("No more trades found for %s. Finished.\n", symbol)
+			if c.status != nil {
+				if err := c.status.caughtUp(symbol); err != nil {
+					fmt.Printf("%s has caught up and is %v\n", symbol, err)
+					return err
+				}
+			}
 			break
 		}
+		pageDelay(ctx)
+
+		if err := checkDiskSpace(); err != nil {
+			fmt.Printf("Stopping %s at fromId(%d): %v\n", symbol, fromId, err)
+			return err
+		}
+		if err := checkAnomalies(symbol, pageAnomalies(trades, fromId, -1)); err != nil {
+			return err
+		}
 
-		groupedTrades := groupTradesByDate(trades)
-		for date, records := range groupedTrades {
-			filePath := fmt.Sprintf("%s/%s.csv", symbol, date)
-			if err := saveToCSV(filePath, records); err != nil {
-				fmt.Printf("Error saving to CSV for %s on %s: %v\n", symbol, date, err)
+		reachedEnd := false
+		if !end.IsZero() {
+			if kept := tradesBeforeTime(trades, end.UnixMilli()); len(kept) < len(trades) {
+				trades, reachedEnd = kept, true
 			}
 		}
+		if len(trades) == 0 {
+			// 이전 페이지가 구간의 마지막 거래에서 끝남
+			err := c.persist(symbol, nil, func() {
+				if finishLast && days.current != "" {
+					c.finishDay(symbol, days.current)
+				}
+			})
+			if err != nil {
+				fmt.Printf("Error finishing %s: %v\n", symbol, err)
+			}
+			fmt.Printf("Reached %s for %s. Finished.\n", end.Format(time.RFC3339), symbol)
+			break
+		}
 
-		lastTrade := trades[len(trades)-1]
+		page := trades
+		if index != nil {
+			trades = index.uncovered(trades)
+		}
+		if done != nil {
+			trades = filterTrades(trades, func(t AggTrade) bool { return !done.Complete[tradeDate(t)] })
+		}
+
+		lastTrade := page[len(page)-1]
+		pageFrom := fromId
+		err = c.persist(symbol, trades, func() {
+			progress.written(symbol, pageFrom, tradeDate(lastTrade), len(trades))
+			for _, date := range days.observe(tradeDates(trades)) {
+				c.finishDay(symbol, date)
+			}
+			if reachedEnd && finishLast && days.current != "" {
+				c.finishDay(symbol, days.current) // 구간 끝이 자정이므로 마지막 날짜도 완료
+			}
+			if index != nil {
+				index.add(page[0].TradeId, lastTrade.TradeId)
+				if err := index.save(); err != nil {
+					fmt.Printf("Error saving range index for %s: %v\n", symbol, err)
+				}
+			}
+		})
+		if err != nil {
+			if err := saveFailed(&saveFails, err); err != nil {
+				fmt.Printf("Stopping %s at fromId(%d): %v\n", symbol, fromId, err)
+				return err
+			}
+			fmt.Printf("Error saving page for %s at fromId(%d), retrying: %v\n", symbol, fromId, err)
+			retryDelay(ctx, symbol, 5*time.Second)
+			continue
+		}
+		saveFails = 0
+		if lastTrade.TradeId+1 <= fromId {
+			stuck++
+			if stuck >= cfg.MaxStuck {
+				err := fmt.Errorf("fromId(%d) has not advanced in %d consecutive pages", fromId, stuck)
+				fmt.Printf("Stopping %s: %v\n", symbol, err)
+				return err
+			}
+			continue
+		}
+		stuck = 0
 		fromId = lastTrade.TradeId + 1
+		if reachedEnd {
+			fmt.Printf("Reached %s for %s. Finished.\n", end.Format(time.RFC3339), symbol)
+			break
+		}
+		if cfg.StopWithin > 0 && time.Since(time.UnixMilli(lastTrade.Timestamp)) <= cfg.StopWithin {
+			// 거의 빈 마지막 페이지를 기다리지 않음
+			fmt.Printf("Reached trades within -stop-within=%v of now for %s at fromId(%d). Finished.\n", cfg.StopWithin, symbol, fromId)
+			break
+		}
 	}
+	return nil
 }
 
-func groupTradesByDate(trades []AggTrade) map[string][][]string {
-	grouped := make(map[string][][]string)
+// filterTrades returns the trades for which keep is true in a new slice,
+// leaving the page itself intact.
+func filterTrades(trades []AggTrade, keep func(AggTrade) bool) []AggTrade {
+	kept := make([]AggTrade, 0, len(trades))
 	for _, trade := range trades {
-		//t := time.UnixMilli(trade.Timestamp).In(time.FixedZone("KST", 9*60*60))
-		t := time.UnixMilli(trade.Timestamp).UTC()
-		dateStr := t.Format("2006-01-02")
-		record := []string{
-			strconv.FormatInt(trade.TradeId, 10),
-			trade.Price,
-			trade.Quantity,
-			strconv.FormatInt(trade.Timestamp, 10),
-			strconv.FormatBool(trade.IsMaker),
-		}
-		grouped[dateStr] = append(grouped[dateStr], record)
+		if keep(trade) {
+			kept = append(kept, trade)
+		}
+	}
+	return kept
+}
+
+// groupTradesByDate buckets trades by their date in -tz, dropping trades
+// dated outside -min-date/-max-date.
+func groupTradesByDate(trades []AggTrade) map[string][]AggTrade {
+	grouped := make(map[string][]AggTrade)
+	var dates dateCache
+	for _, trade := range trades {
+		dateStr := dates.date(trade)
+		if !inDateRange(dateStr) {
+			continue
+		}
+		grouped[dateStr] = append(grouped[dateStr], trade)
 	}
 	return grouped
 }
 
-func saveToCSV(filePath string, records [][]string) error {
-	_, err := os.Stat(filePath)
-	isNewFile := os.IsNotExist(err)
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+// inDateRange reports whether date (YYYY-MM-DD) is within -min-date and
+// -max-date, both inclusive.
+func inDateRange(date string) bool {
+	return (cfg.MinDate == "" || date >= cfg.MinDate) && (cfg.MaxDate == "" || date <= cfg.MaxDate)
+}
+
+func tradeDate(trade AggTrade) string {
+	t := time.UnixMilli(trade.Timestamp).In(cfg.Location)
+	return t.Format("2006-01-02")
+}
+
+const msPerDay = 86_400_000
+
+// dateCache returns the same dates as tradeDate. For UTC it buckets the
+// timestamp arithmetically and formats each day once, since consecutive
+// trades almost always share a day; other zones fall back to tradeDate.
+type dateCache struct {
+	day  int64
+	str  string
+	init bool
+}
+
+func (c *dateCache) date(trade AggTrade) string {
+	if cfg.Location != time.UTC {
+		return tradeDate(trade)
 	}
-	defer file.Close()
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-	if isNewFile {
-		header := []string{"tradeId", "price", "quantity", "timestamp", "isBuyerMaker"}
-		if err := writer.Write(header); err != nil {
-			return err
+	day := trade.Timestamp / msPerDay
+	if trade.Timestamp%msPerDay < 0 {
+		day-- // 1970년 이전: 내림
+	}
+	if !c.init || day != c.day {
+		c.day, c.init = day, true
+		c.str = time.UnixMilli(day * msPerDay).UTC().Format("2006-01-02")
+	}
+	return c.str
+}
+
+// utf8BOM is written before the header of new CSV files with -bom, so Excel
+// detects UTF-8. Readers strip it from the first field.
+const utf8BOM = "\ufeff"
+
+var baseCSVHeader = []string{"tradeId", "price", "quantity", "timestamp", "isBuyerMaker"}
+
+func csvHeader() []string {
+	header := slices.Clone(baseCSVHeader)
+	if cfg.QuoteQty {
+		header = append(header, "quoteQty")
+	}
+	header = keptColumns(header)
+	if cfg.RowChecksum && !discardFields[checksumColumn] {
+		header = append(header, checksumColumn)
+	}
+	return header
+}
+
+// discardFields are the -discard-fields columns; newSink sets them.
+var discardFields map[string]bool
+
+// parseDiscardFields parses -discard-fields, checking each name against the
+// columns the flags produce and that at least one column other than the
+// checksum is left.
+func parseDiscardFields(list string) (map[string]bool, error) {
+	names := splitList(list)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	columns := slices.Clone(baseCSVHeader)
+	if cfg.QuoteQty {
+		columns = append(columns, "quoteQty")
+	}
+	all := columns
+	if cfg.RowChecksum {
+		all = append(slices.Clone(columns), checksumColumn)
+	}
+	discard := make(map[string]bool)
+	for _, name := range names {
+		if !slices.Contains(all, name) {
+			return nil, fmt.Errorf("invalid -discard-fields %q (want some of %s)", name, strings.Join(all, ","))
+		}
+		discard[name] = true
+	}
+	if !slices.ContainsFunc(columns, func(c string) bool { return !discard[c] }) {
+		return nil, fmt.Errorf("-discard-fields=%s leaves no columns", list)
+	}
+	return discard, nil
+}
+
+// keptColumns drops the -discard-fields columns of a header or record,
+// whose fields are baseCSVHeader and quoteQty in that order, in place.
+func keptColumns(fields []string) []string {
+	if discardFields == nil {
+		return fields
+	}
+	kept := fields[:0]
+	for i, field := range fields {
+		name := "quoteQty"
+		if i < len(baseCSVHeader) {
+			name = baseCSVHeader[i]
+		}
+		if !discardFields[name] {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+const checksumColumn = "checksum"
+
+// rowChecksum is the -row-checksum column: the CRC-32 (IEEE) of the row's
+// other fields joined by commas, as 8 hex digits.
+func rowChecksum(fields []string) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(strings.Join(fields, ","))))
+}
+
+func tradeRecord(trade AggTrade) []string {
+	record := []string{
+		strconv.FormatInt(trade.TradeId, 10),
+		trade.Price,
+		trade.Quantity,
+		formatTimestamp(trade.Timestamp),
+		strconv.FormatBool(trade.IsMaker),
+	}
+	if cfg.QuoteQty {
+		quoteQty, err := mulDecimal(trade.Price, trade.Quantity)
+		if err != nil {
+			fmt.Printf("Error computing quoteQty for trade %d: %v\n", trade.TradeId, err)
 		}
+		record = append(record, quoteQty)
+	}
+	record = keptColumns(record)
+	if cfg.RowChecksum && !discardFields[checksumColumn] {
+		record = append(record, rowChecksum(record)) // 남은 열로 계산
+	}
+	return record
+}
+
+// symbolDir is the directory holding a symbol's files: <out>/<symbol>, or
+// <out> itself with -flatten.
+func symbolDir(symbol string) string {
+	return symbolDirIn(cfg.OutDir, symbol)
+}
+
+func symbolDirIn(root, symbol string) string {
+	if cfg.Flatten {
+		return root
+	}
+	return filepath.Join(root, symbol)
+}
+
+// symbolPath names a per-symbol file: <out>/<symbol>/<name>, or
+// <out>/<symbol>_<name> with -flatten.
+func symbolPath(symbol, name string) string {
+	return symbolPathIn(cfg.OutDir, symbol, name)
+}
+
+func symbolPathIn(root, symbol, name string) string {
+	if cfg.Flatten {
+		return filepath.Join(root, symbol+"_"+name)
 	}
-	return writer.WriteAll(records)
+	return filepath.Join(symbolDirIn(root, symbol), name)
+}
+
+func saveToCSV(filePath string, records [][]string) error {
+	return appendCSV(filePath, csvHeader(), records)
+}
+
+// appendCSV appends records to a CSV file, writing header first when the
+// file is new.
+func appendCSV(filePath string, header []string, records [][]string) error {
+	return appendFile(filePath, func(file *os.File, isNewFile bool) error {
+		bw := fileBuffer(file)
+		writer := newCSVWriter(bw)
+		if isNewFile {
+			if cfg.BOM {
+				if _, err := bw.WriteString(utf8BOM); err != nil {
+					return err
+				}
+			}
+			if err := writer.Write(header); err != nil {
+				return err
+			}
+		}
+		if err := writeAll(writer, records); err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
 }
 
 func main() {
-	rateLimiter := NewRateLimiter(maxReqPerMin)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "lookup":
+			os.Exit(runLookup(os.Args[2:]))
+		case "dedupe":
+			os.Exit(runDedupe(os.Args[2:]))
+		case "preflight":
+			os.Exit(runPreflight(os.Args[2:]))
+		case "list-files":
+			os.Exit(runListFiles(os.Args[2:]))
+		case "retry-failed":
+			os.Exit(runRetryFailed(os.Args[2:]))
+		case "redownload":
+			os.Exit(runRedownload(os.Args[2:]))
+		case "schema":
+			os.Exit(runSchema(os.Args[2:]))
+		}
+	}
+
+	registerFlags(flag.CommandLine)
+	if err := parseArgs(flag.CommandLine, os.Args[1:]); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		fmt.Printf("Error: invalid -tz %q: %v\n", cfg.Timezone, err)
+		os.Exit(1)
+	}
+	cfg.Location = loc
+	for _, d := range []struct{ name, value string }{{"min-date", cfg.MinDate}, {"max-date", cfg.MaxDate}} {
+		if _, err := time.Parse("2006-01-02", d.value); d.value != "" && err != nil {
+			fmt.Printf("Error: invalid -%s %q (want YYYY-MM-DD)\n", d.name, d.value)
+			os.Exit(1)
+		}
+	}
+	if err := configureHTTPClient(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := openProgressJSON(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if retryStatuses, err = parseRetryStatus(cfg.RetryStatus); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if weights, err = parseWeights(cfg.Weights); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := parseScheduler(cfg.Scheduler); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.WeightLimit == 0 && exchange.weightLimit > 0 && !flagWasSet(flag.CommandLine, "rate") {
+		cfg.WeightLimit = exchange.weightLimit
+	}
+
+	switch cfg.FinalCompression {
+	case "", "none", "gzip", "zstd":
+	default:
+		fmt.Printf("Error: invalid -final-compression %q (want none, gzip or zstd)\n", cfg.FinalCompression)
+		os.Exit(1)
+	}
+	if !slices.Contains(csvQuoteModes, cfg.CSVQuote) {
+		fmt.Printf("Error: invalid -csv-quote %q (want %s)\n", cfg.CSVQuote, strings.Join(csvQuoteModes, ", "))
+		os.Exit(1)
+	}
+	if cfg.BOM && cfg.CSVQuote == "all" {
+		fmt.Println("Error: -bom cannot be combined with -csv-quote=all: a quote after the byte-order mark makes the header unreadable for -update and export")
+		os.Exit(1)
+	}
+	if !slices.Contains(timestampFormats, cfg.TimestampFormat) {
+		fmt.Printf("Error: invalid -timestamp-format %q (want %s)\n", cfg.TimestampFormat, strings.Join(timestampFormats, ", "))
+		os.Exit(1)
+	}
+	switch cfg.Archive {
+	case "", "tar", "tar.gz":
+	default:
+		fmt.Printf("Error: invalid -archive %q (want tar.gz or tar)\n", cfg.Archive)
+		os.Exit(1)
+	}
+	if cfg.Sort && (usesFormat("json") || usesFormat("avro") || cfg.TradesPerFile > 0) {
+		fmt.Println("Error: -sort works on csv and jsonl date files, not -format=json, avro or -trades-per-file chunks")
+		os.Exit(1)
+	}
+	if cfg.Archive != "" && ((cfg.FinalCompression != "" && cfg.FinalCompression != "none") || cfg.TradesPerFile > 0) {
+		fmt.Println("Error: -archive cannot be combined with -final-compression or -trades-per-file")
+		os.Exit(1)
+	}
+
+	sink, err := newSink(cfg.Format)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	symbolSinks, err := newSymbolSinks()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if discardFields["tradeId"] && (cfg.Update || cfg.ResumeAll || cfg.OnExisting == "resume" || cfg.Sort) {
+		fmt.Println("Error: -update, -resume-all, -on-existing=resume and -sort read the tradeId column back; it cannot be in -discard-fields")
+		os.Exit(1)
+	}
+	if symbol, format, ok := overriddenFormat(); ok && (cfg.FifoDir != "" || cfg.Update || cfg.ResumeAll || cfg.OnExisting == "resume" || cfg.Interval != "") {
+		fmt.Printf("Error: the -config file writes %s as %s; per-symbol formats cannot be combined with -fifo-dir, -update, -resume-all, -on-existing=resume or -interval\n", symbol, format)
+		os.Exit(1)
+	}
+	if cfg.FifoDir != "" {
+		if cfg.Format != "csv" || cfg.Update || cfg.SkipComplete || cfg.TradesPerFile > 0 || cfg.MaxFileSize > 0 || cfg.Sort || cfg.Archive != "" || cfg.DailySummary || (cfg.FinalCompression != "" && cfg.FinalCompression != "none") || cfg.Interval != "" {
+			fmt.Println("Error: -fifo-dir streams CSV instead of writing date files and cannot be combined with -format, -update, -skip-complete, -trades-per-file, -max-file-size, -sort, -archive, -daily-summary, -final-compression or -interval")
+			os.Exit(1)
+		}
+		switch cfg.FifoNoReader {
+		case "block", "drop":
+		default:
+			fmt.Printf("Error: invalid -fifo-no-reader %q (want block or drop)\n", cfg.FifoNoReader)
+			os.Exit(1)
+		}
+	}
+	if cfg.ResumeAll {
+		if flagWasSet(flag.CommandLine, "symbols") || cfg.SymbolsFile != "" || cfg.Quote != "" || cfg.SymbolsRegex != "" || cfg.Flatten {
+			fmt.Println("Error: -resume-all takes the symbols from the directories in -out and cannot be combined with -symbols, -symbols-file, -quote, -symbols-regex or -flatten")
+			os.Exit(1)
+		}
+		cfg.Update = true
+	}
+	if err := parseOnExisting(cfg.OnExisting); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Update && cfg.OnExisting != "" && cfg.OnExisting != "resume" {
+		fmt.Printf("Error: -update resumes from the existing files and cannot be combined with -on-existing=%s\n", cfg.OnExisting)
+		os.Exit(1)
+	}
+	if cfg.OnExisting == "resume" && cfg.Format != "csv" {
+		fmt.Println("Error: -on-existing=resume reads existing CSV files and requires -format=csv")
+		os.Exit(1)
+	}
+	if cfg.Update && cfg.Format != "csv" {
+		fmt.Println("Error: -update reads existing CSV files and requires -format=csv")
+		os.Exit(1)
+	}
+	if cfg.Update && cfg.NewestFirst {
+		fmt.Println("Error: -update cannot be combined with -newest-first")
+		os.Exit(1)
+	}
+	if cfg.DailySummary && (cfg.TradesPerFile > 0 || cfg.Interval != "") {
+		fmt.Println("Error: -daily-summary summarizes date files of aggTrades and cannot be combined with -trades-per-file or -interval")
+		os.Exit(1)
+	}
+	if cfg.TradesPerFile > 0 && (cfg.NewestFirst || cfg.MaxFileSize > 0 || cfg.SkipComplete) {
+		fmt.Println("Error: -trades-per-file cannot be combined with -newest-first, -max-file-size or -skip-complete")
+		os.Exit(1)
+	}
 
-	symbols := []string{"USDCUSDT"}
-	var wg sync.WaitGroup
+	if cfg.FullHistory && (cfg.NewestFirst || cfg.Update || cfg.RangeIndex || cfg.TradesPerFile > 0 || cfg.MaxPages > 0 || !cfg.StartTime.IsZero() || !cfg.EndTime.IsZero()) {
+		fmt.Println("Error: -full-history cannot be combined with -newest-first, -update, -range-index, -trades-per-file, -max-pages, -start-time or -end-time")
+		os.Exit(1)
+	}
+	if cfg.Replay != "" && (cfg.RecordResponses != "" || cfg.FullHistory || cfg.NewestFirst || cfg.CountOnly || cfg.Head > 0 || len(cfg.Interval) > 0 || !cfg.StartTime.IsZero()) {
+		fmt.Println("Error: -replay only replays forward aggTrades pages and cannot be combined with -record-responses, -full-history, -newest-first, -count-only, -head, -interval or -start-time")
+		os.Exit(1)
+	}
+	if sinceIds, err = parseSinceTradeIds(cfg.SinceTradeId); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.StopWithin < 0 {
+		fmt.Println("Error: -stop-within cannot be negative")
+		os.Exit(1)
+	}
+	if cfg.StopWithin > 0 && (cfg.FullHistory || cfg.NewestFirst || cfg.Interval != "") {
+		fmt.Println("Error: -stop-within ends forward aggTrades collection and cannot be combined with -full-history, -newest-first or -interval")
+		os.Exit(1)
+	}
+	if sinceIds.set() && (cfg.FullHistory || cfg.NewestFirst || cfg.Replay != "" || cfg.CountOnly || cfg.Head > 0 || cfg.Interval != "" || !cfg.StartTime.IsZero()) {
+		fmt.Println("Error: -since-trade-id sets where forward aggTrades collection starts and cannot be combined with -full-history, -newest-first, -replay, -count-only, -head, -interval or -start-time")
+		os.Exit(1)
+	}
+	if cfg.MaxErrorRate < 0 || cfg.MaxErrorRate >= 1 || cfg.MaxSymbolErrorRate < 0 || cfg.MaxSymbolErrorRate >= 1 || cfg.ErrorRateWindow < 1 {
+		fmt.Println("Error: -max-error-rate and -max-symbol-error-rate must be fractions from 0 to below 1, and -error-rate-window at least 1")
+		os.Exit(1)
+	}
+	if cfg.Source != "api" && cfg.Source != "vision" {
+		fmt.Printf("Error: invalid -source %q: want api or vision\n", cfg.Source)
+		os.Exit(1)
+	}
+	if cfg.Source == "vision" && (cfg.Exchange != "global" || cfg.FullHistory || cfg.NewestFirst || cfg.Replay != "" || cfg.Interval != "" || cfg.CountOnly || cfg.Head > 0) {
+		fmt.Println("Error: -source=vision reads the spot dumps of -exchange=global for forward aggTrades collection and cannot be combined with -full-history, -newest-first, -replay, -interval, -count-only or -head")
+		os.Exit(1)
+	}
+	if cfg.Concurrency < 1 || (cfg.Concurrency > 1 && !cfg.FullHistory) {
+		fmt.Println("Error: -concurrency must be at least 1 and only applies to -full-history")
+		os.Exit(1)
+	}
 
-	for _, symbol := range symbols {
-		wg.Add(1)
-		go func(sym string) {
-			defer wg.Done()
-			processSymbol(sym, rateLimiter)
-		}(symbol)
+	intervals, err := parseIntervals(cfg.Interval)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(intervals) > 0 && (cfg.NewestFirst || cfg.FullHistory || cfg.CountOnly || cfg.Format != "csv") {
+		fmt.Println("Error: -interval writes CSV klines and cannot be combined with -newest-first, -full-history, -count-only or -format")
+		os.Exit(1)
 	}
 
-	wg.Wait()
+	snapshots, err := parseSnapshots(cfg.Snapshots)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(snapshots) > 0 && cfg.SnapshotInterval <= 0 {
+		fmt.Println("Error: -snapshot-interval must be positive")
+		os.Exit(1)
+	}
+	if len(snapshots) > 0 && cfg.Replay != "" {
+		fmt.Println("Error: -snapshots polls the live API and cannot be combined with -replay")
+		os.Exit(1)
+	}
+
+	symbols, err := resolveSymbols()
+	if err != nil {
+		fmt.Printf("Error selecting symbols: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.FixedPrecision {
+		if len(intervals) > 0 {
+			fmt.Println("Error: -fixed-precision formats aggTrades prices and quantities and cannot be combined with -interval")
+			os.Exit(1)
+		}
+		if err := loadPrecisions(symbols); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	limiter, err := newLimiter()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.Head > 0 {
+		os.Exit(runHead(symbols, limiter))
+	}
+
+	if cfg.CountOnly {
+		if cfg.StartTime.IsZero() {
+			fmt.Println("Error: -count-only requires -start-time")
+			os.Exit(1)
+		}
+		runCountOnly(symbols, limiter)
+		return
+	}
+
+	fmt.Printf("Collecting %d symbol(s): %v\n", len(symbols), symbols)
+
+	if err := os.MkdirAll(cfg.OutDir, cfg.DirMode.Perm()); err != nil {
+		fmt.Printf("Error creating output directory %s: %v\n", cfg.OutDir, err)
+		os.Exit(1)
+	}
+	releaseLock, err := acquireOutLock(cfg.OutDir, cfg.LockWait)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer releaseLock()
+
+	warnFileCount(symbols, intervals)
+	if err := startupDiskCheck(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		releaseLock()
+		os.Exit(1)
+	}
+
+	ctx, stop := runContext()
+	defer stop()
+	if cfg.FifoDir != "" {
+		// 리더를 기다리는 동안에도 SIGINT로 멈출 수 있도록 ctx를 넘김
+		if sink, err = newFIFOSink(ctx, cfg.FifoDir, cfg.FifoNoReader == "drop"); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			releaseLock()
+			os.Exit(1)
+		}
+	}
+
+	watchProgressSignal()
+	stopHeartbeat := startHeartbeat(cfg.Heartbeat)
+	collector := NewCollector(limiter)
+	collector.RegisterSink(sink)
+	for symbol, s := range symbolSinks {
+		collector.RegisterSymbolSink(symbol, s)
+	}
+	collector.CollectKlines(intervals)
+	collector.CollectSnapshots(snapshots)
+	started := time.Now()
+	results := collector.Run(ctx, symbols)
+	stopHeartbeat()
+	if err := collector.Close(); err != nil {
+		fmt.Printf("Error closing sinks: %v\n", err)
+	}
+	background.Wait()
+	fmt.Printf("fetchTrades latency: %s", fetchLatency)
+	fmt.Printf("Transfer: %s\n", transferSummary())
+	if cfg.MinDate != "" || cfg.MaxDate != "" {
+		progress.reportDateFiltered()
+	}
+	if cfg.ThroughputReport {
+		throughput.report()
+	}
 	fmt.Println("All data collection tasks finished.")
+
+	code := exitCode(ctx, results)
+	if cfg.StatsFile != "" {
+		if err := writeStatsFile(ctx, cfg.StatsFile, started, results, code); err != nil {
+			fmt.Printf("Error writing -stats-file: %v\n", err)
+		}
+	}
+	stop()
+	releaseLock()
+	os.Exit(code)
 }
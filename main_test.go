@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDateCache checks that dateCache agrees with tradeDate on the benchmark
+// pages and on timestamps around day boundaries, including before 1970.
+func TestDateCache(t *testing.T) {
+	for _, loc := range []string{"UTC", "Asia/Seoul", "America/Santiago"} {
+		t.Run(loc, func(t *testing.T) {
+			l, err := time.LoadLocation(loc)
+			if err != nil {
+				t.Skip(err)
+			}
+			saved := cfg.Location
+			cfg.Location = l
+			defer func() { cfg.Location = saved }()
+
+			trades := append(benchPage(midday), benchPage(boundary)...)
+			for _, day := range []int64{-2, -1, 0, 1, 19723, 19724} {
+				for _, offset := range []int64{-1, 0, 1, msPerDay / 2} {
+					trades = append(trades, AggTrade{Timestamp: day*msPerDay + offset})
+				}
+			}
+			var cache dateCache
+			for _, trade := range trades {
+				if got, want := cache.date(trade), tradeDate(trade); got != want {
+					t.Errorf("dateCache gives %s for timestamp %d, tradeDate gives %s", got, trade.Timestamp, want)
+				}
+			}
+		})
+	}
+}
+
+// servePages points apiURL at a server that answers each fromId with the
+// ids page returns for it.
+func servePages(t *testing.T, page func(fromId int64) []int64) *int {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		from, _ := strconv.ParseInt(r.URL.Query().Get("fromId"), 10, 64)
+		trades := []AggTrade{}
+		for _, id := range page(from) {
+			trades = append(trades, testTrade(id))
+		}
+		json.NewEncoder(w).Encode(trades)
+	}))
+	t.Cleanup(srv.Close)
+	old := apiURL
+	apiURL = srv.URL + "/api/v3/aggTrades"
+	t.Cleanup(func() { apiURL = old })
+	return &requests
+}
+
+func TestCollectPagesStuck(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.Location, cfg.Format = time.UTC, "csv"
+	defer func(maxStuck int) { cfg.MaxStuck = maxStuck }(cfg.MaxStuck)
+	cfg.MaxStuck = 3
+	upTo := func(n int64) func(int64) []int64 {
+		return func(from int64) []int64 {
+			var ids []int64
+			for id := from; id < min(from+3, n); id++ {
+				ids = append(ids, id)
+			}
+			return ids
+		}
+	}
+	tests := []struct {
+		name     string
+		page     func(fromId int64) []int64
+		wantErr  string
+		requests int
+	}{
+		{"advancing ends at the last trade", upTo(7), "", 4},
+		{"the same page again and again", func(int64) []int64 { return []int64{0, 1, 2} }, "has not advanced in 3 consecutive pages", 4},
+		{"a page that ends below fromId", func(from int64) []int64 {
+			if from == 0 {
+				return []int64{0, 1, 2}
+			}
+			return []int64{1, 2}
+		}, "has not advanced in 3 consecutive pages", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeDateFiles(t, nil)
+			requests := servePages(t, tt.page)
+			c := NewCollector(noLimit{})
+			c.RegisterSink(newCSVSink())
+			errc := make(chan error, 1)
+			go func() { errc <- c.collectPages(context.Background(), "BTCUSDT", 0, time.Time{}, nil, nil, false) }()
+			var err error
+			select {
+			case err = <-errc:
+			case <-time.After(10 * time.Second):
+				t.Fatal("collectPages did not terminate")
+			}
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+			if *requests != tt.requests {
+				t.Errorf("%d requests, want %d", *requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestDiscardFieldsAlignment(t *testing.T) {
+	defer func(c Config, d map[string]bool) { cfg, discardFields = c, d }(cfg, discardFields)
+	cfg.TimestampFormat, cfg.Location = "", time.UTC
+	trade := AggTrade{TradeId: 42, Price: "2.50000000", Quantity: "4.00000000", Timestamp: 1710028800123, IsMaker: true}
+	values := map[string]string{
+		"tradeId": "42", "price": "2.50000000", "quantity": "4.00000000",
+		"timestamp": "1710028800123", "isBuyerMaker": "true", "quoteQty": "10",
+	}
+	tests := []struct {
+		discard           string
+		quoteQty, checked bool
+		wantHeader        string
+	}{
+		{"", false, false, "tradeId,price,quantity,timestamp,isBuyerMaker"},
+		{"tradeId,isBuyerMaker", false, false, "price,quantity,timestamp"},
+		{"isBuyerMaker,tradeId", false, false, "price,quantity,timestamp"},
+		{"price", true, false, "tradeId,quantity,timestamp,isBuyerMaker,quoteQty"},
+		{"quoteQty", true, false, "tradeId,price,quantity,timestamp,isBuyerMaker"},
+		{"tradeId,price,quantity,isBuyerMaker", true, false, "timestamp,quoteQty"},
+		{"timestamp", false, true, "tradeId,price,quantity,isBuyerMaker,checksum"},
+		{"checksum", false, true, "tradeId,price,quantity,timestamp,isBuyerMaker"},
+		{" tradeId , isBuyerMaker ", true, true, "price,quantity,timestamp,quoteQty,checksum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.discard, func(t *testing.T) {
+			cfg.QuoteQty, cfg.RowChecksum = tt.quoteQty, tt.checked
+			var err error
+			if discardFields, err = parseDiscardFields(tt.discard); err != nil {
+				t.Fatal(err)
+			}
+			header, record := csvHeader(), tradeRecord(trade)
+			if got := strings.Join(header, ","); got != tt.wantHeader {
+				t.Errorf("header %s, want %s", got, tt.wantHeader)
+			}
+			if len(record) != len(header) {
+				t.Fatalf("record %v has %d fields for a %d-column header", record, len(record), len(header))
+			}
+			for i, name := range header {
+				want := values[name]
+				if name == checksumColumn {
+					want = rowChecksum(record[:i])
+				}
+				if record[i] != want {
+					t.Errorf("column %s holds %q, want %q", name, record[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDiscardFieldsErrors(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	tests := []struct {
+		discard           string
+		quoteQty, checked bool
+		wantErr           string
+	}{
+		{"side", false, false, `invalid -discard-fields "side"`},
+		{"quoteQty", false, false, `invalid -discard-fields "quoteQty"`},
+		{"checksum", false, false, `invalid -discard-fields "checksum"`},
+		{"tradeId,price,quantity,timestamp,isBuyerMaker", false, false, "leaves no columns"},
+		{"tradeId,price,quantity,timestamp,isBuyerMaker", false, true, "leaves no columns"},
+		{"tradeId,price,quantity,timestamp,isBuyerMaker,quoteQty", true, false, "leaves no columns"},
+	}
+	for _, tt := range tests {
+		cfg.QuoteQty, cfg.RowChecksum = tt.quoteQty, tt.checked
+		if _, err := parseDiscardFields(tt.discard); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseDiscardFields(%q) = %v, want %q", tt.discard, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const manifestSaveInterval = 10 * time.Second
+
+// fileRange describes the rows of one date file.
+type fileRange struct {
+	Date    string `json:"date"`
+	MinId   int64  `json:"minId"`
+	MaxId   int64  `json:"maxId"`
+	MinTime int64  `json:"minTime"`
+	MaxTime int64  `json:"maxTime"`
+	Rows    int64  `json:"rows"`
+}
+
+// manifest is <symbol>/manifest.json: the tradeId and timestamp range of
+// every date file, keyed by file name. It is saved every
+// manifestSaveInterval and when the sink closes, so after a crash it can lag
+// the files by a few pages.
+type manifest struct {
+	path     string
+	lastSave time.Time
+	dirty    bool
+
+	Files    map[string]*fileRange `json:"files"`
+	Complete map[string]bool       `json:"complete,omitempty"`
+}
+
+func manifestPathIn(root, symbol string) string {
+	return symbolPathIn(root, symbol, "manifest.json")
+}
+
+func newManifest(path string) *manifest {
+	return &manifest{path: path, Files: make(map[string]*fileRange), Complete: make(map[string]bool)}
+}
+
+func loadManifestIn(root, symbol string) (*manifest, error) {
+	m := newManifest(manifestPathIn(root, symbol))
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", m.path, err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]*fileRange)
+	}
+	if m.Complete == nil {
+		m.Complete = make(map[string]bool)
+	}
+	return m, nil
+}
+
+func (m *manifest) record(path, date string, trades []AggTrade) {
+	if len(trades) == 0 {
+		return
+	}
+	name := filepath.Base(path)
+	r, ok := m.Files[name]
+	if !ok {
+		r = &fileRange{Date: date, MinId: trades[0].TradeId, MaxId: trades[0].TradeId, MinTime: trades[0].Timestamp, MaxTime: trades[0].Timestamp}
+		m.Files[name] = r
+	}
+	for _, trade := range trades {
+		r.MinId, r.MaxId = min(r.MinId, trade.TradeId), max(r.MaxId, trade.TradeId)
+		r.MinTime, r.MaxTime = min(r.MinTime, trade.Timestamp), max(r.MaxTime, trade.Timestamp)
+	}
+	r.Rows += int64(len(trades))
+	m.dirty = true
+}
+
+// snapshot copies the entries for the given files so a failed page can be
+// undone with restore.
+func (m *manifest) snapshot(paths []string) map[string]*fileRange {
+	saved := make(map[string]*fileRange, len(paths))
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if r, ok := m.Files[name]; ok {
+			c := *r
+			saved[name] = &c
+		} else {
+			saved[name] = nil
+		}
+	}
+	return saved
+}
+
+func (m *manifest) restore(saved map[string]*fileRange) {
+	for name, r := range saved {
+		if r == nil {
+			delete(m.Files, name)
+		} else {
+			m.Files[name] = r
+		}
+	}
+	m.dirty = true
+}
+
+func (m *manifest) markComplete(date string) {
+	if !m.Complete[date] {
+		m.Complete[date] = true
+		m.dirty = true
+	}
+}
+
+func (m *manifest) saveIfDue() error {
+	if time.Since(m.lastSave) < manifestSaveInterval {
+		return nil
+	}
+	return m.save()
+}
+
+func (m *manifest) save() error {
+	if !m.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, cfg.FileMode.Perm()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return err
+	}
+	m.dirty, m.lastSave = false, time.Now()
+	return nil
+}
+
+// lookup returns the file names whose tradeId range contains id.
+func (m *manifest) lookup(id int64) []string {
+	var names []string
+	for name, r := range m.Files {
+		if r.MinId <= id && id <= r.MaxId {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeDayAt reports whether id falls in a date marked complete, and if
+// so the highest tradeId recorded for that date.
+func (m *manifest) completeDayAt(id int64) (date string, maxId int64, ok bool) {
+	for _, r := range m.Files {
+		if r.MinId <= id && id <= r.MaxId && m.Complete[r.Date] {
+			date = r.Date
+			break
+		}
+	}
+	if date == "" {
+		return "", 0, false
+	}
+	for _, r := range m.Files {
+		if r.Date == date {
+			maxId = max(maxId, r.MaxId)
+		}
+	}
+	return date, maxId, true
+}
+
+// runLookup implements the lookup subcommand: which file holds a tradeId.
+func runLookup(args []string) int {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	registerFlags(fs)
+	var id int64
+	fs.Int64Var(&id, "id", -1, "aggregate tradeId to look up")
+	if err := parseArgs(fs, args); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	symbols, err := explicitSymbols()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if id < 0 || len(symbols) != 1 {
+		fmt.Println("usage: lookup -symbols SYMBOL -id TRADEID [-out DIR]")
+		return 2
+	}
+	symbol := symbols[0]
+	m, err := loadManifestIn(cfg.OutDir, symbol)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(m.Files) == 0 {
+		fmt.Printf("No manifest for %s at %s\n", symbol, m.path)
+		return 1
+	}
+	names := m.lookup(id)
+	if len(names) == 0 {
+		fmt.Printf("tradeId %d of %s is not in any recorded file\n", id, symbol)
+		return 1
+	}
+	for _, name := range names {
+		r := m.Files[name]
+		fmt.Printf("%s (ids %d-%d, %s - %s, %d rows)\n", symbolPath(symbol, name), r.MinId, r.MaxId,
+			time.UnixMilli(r.MinTime).UTC().Format(time.RFC3339), time.UnixMilli(r.MaxTime).UTC().Format(time.RFC3339), r.Rows)
+	}
+	return 0
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+// processSymbolNewestFirst walks a symbol's history backward: it starts from
+// the most recent page and then requests the page ending just below the
+// oldest tradeId seen so far, until tradeId 0 is reached. Each page is
+// reversed before it is written, so files receive trades newest-first. A
+// resumed run continues below the lowest tradeId already on disk.
+//
+// Pages are stepped by id rather than by startTime/endTime window:
+// aggregate tradeIds are consecutive and in time order, so the 1000 ids
+// below the oldest one seen are exactly the trades just before it in time,
+// without the one-hour window limit or the empty windows of quiet hours.
+// -start-time and -end-time only decide where the walk starts (below the
+// first trade at or after the end) and stops (at the first trade before the
+// start), as collectWindow gives them to forward collection.
+func (c *Collector) processSymbolNewestFirst(ctx context.Context, symbol string) error {
+	fmt.Printf("Starting newest-first data collection for %s...\n", symbol)
+	progress.start(symbol)
+	defer progress.finish(symbol)
+	if err := os.MkdirAll(symbolDir(symbol), cfg.DirMode.Perm()); err != nil {
+		fmt.Printf("Error creating directory for %s: %v\n", symbol, err)
+		return err
+	}
+
+	var before int64 = -1 // 아직 최신 페이지를 받지 않음
+	policy, lo, _, ok, err := existingPolicy(symbol)
+	if err != nil {
+		fmt.Printf("Error reading existing data for %s: %v\n", symbol, err)
+		return err
+	}
+	switch {
+	case policy == "fail":
+		fmt.Printf("Not collecting %s: pass -on-existing=append|resume|overwrite to use its existing files\n", symbol)
+		return fmt.Errorf("%s already has files in %s", symbol, symbolDir(symbol))
+	case policy == "resume" && ok && lo == 0:
+		fmt.Printf("%s already reaches tradeId 0 on disk. Finished.\n", symbol)
+		return nil
+	case policy == "resume" && ok:
+		before = lo // 이전 실행이 멈춘 곳 아래로 계속
+		fmt.Printf("Resuming %s below before(%d) (lowest tradeId on disk)\n", symbol, before)
+	}
+
+	start, end := collectWindow()
+	if !end.IsZero() && before < 0 {
+		latest, err := fetchLatestTrade(symbol, c.limiter)
+		if err != nil {
+			fmt.Printf("Error finding the latest trade for %s: %v\n", symbol, err)
+			return err
+		}
+		if latest == nil {
+			return noTrades(symbol)
+		}
+		if latest.Timestamp >= end.UnixMilli() {
+			first, err := firstTradeAtOrAfter(symbol, end, latest, c.limiter)
+			if err != nil {
+				fmt.Printf("Error finding the first trade at %s for %s: %v\n", end.Format(time.RFC3339), symbol, err)
+				return err
+			}
+			if first.TradeId == 0 {
+				fmt.Printf("No trades for %s in the time range. Finished.\n", symbol)
+				return nil
+			}
+			before = first.TradeId
+			fmt.Printf("Starting %s below %s at before(%d)\n", symbol, end.Format(time.RFC3339), before)
+		}
+	}
+	var days dayTracker
+	bad := badPages{symbol: symbol}
+
+	var index *rangeIndex
+	if cfg.RangeIndex {
+		var err error
+		if index, err = loadRangeIndex(symbol); err != nil {
+			fmt.Printf("Error loading range index for %s: %v\n", symbol, err)
+			return err
+		}
+	}
+
+	pages, saveFails := 0, 0
+	for {
+		if ctx.Err() != nil {
+			fmt.Printf("Stopping %s before(%d): %v\n", symbol, before, context.Cause(ctx))
+			return errAborted
+		}
+		if cfg.MaxPages > 0 && pages >= cfg.MaxPages {
+			fmt.Printf("Reached -max-pages=%d for %s at before(%d). Stopping.\n", cfg.MaxPages, symbol, before)
+			return nil
+		}
+		if index != nil && before > 0 {
+			if next := index.skipBackward(before); next != before {
+				fmt.Printf("sym(%s) ids %d-%d already written, skipping to before(%d)\n", symbol, next, before-1, next)
+				before = next
+				if before == 0 {
+					fmt.Printf("Reached the oldest trade for %s. Finished.\n", symbol)
+					break
+				}
+			}
+		}
+
+		waitWhilePaused(ctx, symbol)
+		if ctx.Err() != nil {
+			continue
+		}
+		c.waitTurn(symbol, aggTradesWeight(limitPerReq))
+
+		var (
+			trades []AggTrade
+			err    error
+			fromId int64
+		)
+		if before < 0 {
+			fmt.Printf("sym(%s) latest\n", symbol)
+			trades, err = fetchAggTrades(symbol, url.Values{})
+		} else {
+			fromId = max(before-limitPerReq, 0)
+			fmt.Printf("sym(%s) fromId(%d) before(%d)\n", symbol, fromId, before)
+			trades, err = fetchTrades(symbol, fromId)
+		}
+		if err != nil {
+			if !shouldRetry(err) {
+				fmt.Printf("Stopping %s: %v\n", symbol, err)
+				return err
+			}
+			fmt.Printf("Error fetching trades for %s: %v\n", symbol, err)
+			if err := fetchErrors.symbolExceeded(symbol); err != nil {
+				fmt.Printf("Stopping %s at before(%d): %v\n", symbol, before, err)
+				return err
+			}
+			if bad.failed(err) && before > 0 {
+				bad.skip(fromId, before-1, err)
+				before = fromId
+				continue
+			}
+			retryDelay(ctx, symbol, 5*time.Second) // 에러 발생 시 대기
+			continue
+		}
+		bad.ok()
+		pages++
+
+		if before >= 0 {
+			trades = tradesBefore(trades, before)
+		}
+		progress.fetched(symbol, fromId, len(trades))
+		if len(trades) == 0 {
+			if before > 0 && fromId > 0 {
+				// 빈 구간: 더 아래쪽부터 다시 시도
+				before = fromId
+				continue
+			}
+			if before < 0 {
+				return noTrades(symbol)
+			}
+			fmt.Printf("Reached the oldest trade for %s. Finished.\n", symbol)
+			break
+		}
+		pageDelay(ctx)
+
+		if err := checkDiskSpace(); err != nil {
+			fmt.Printf("Stopping %s before(%d): %v\n", symbol, before, err)
+			return err
+		}
+		wantLast := int64(-1)
+		if before > 0 {
+			wantLast = before - 1
+		}
+		if err := checkAnomalies(symbol, pageAnomalies(trades, -1, wantLast)); err != nil {
+			return err
+		}
+
+		reachedStart := false
+		if !start.IsZero() {
+			if kept := tradesFromTime(trades, start.UnixMilli()); len(kept) < len(trades) {
+				trades, reachedStart = kept, true
+			}
+		}
+		if len(trades) == 0 {
+			// 이전 페이지가 구간의 첫 거래에서 끝남
+			err := c.persist(symbol, nil, func() {
+				if cfg.AlignDays && days.current != "" {
+					c.finishDay(symbol, days.current)
+				}
+			})
+			if err != nil {
+				fmt.Printf("Error finishing %s: %v\n", symbol, err)
+			}
+			fmt.Printf("Reached %s for %s. Finished.\n", start.Format(time.RFC3339), symbol)
+			break
+		}
+
+		page := trades
+		if index != nil {
+			trades = index.uncovered(trades)
+		}
+
+		reversed := make([]AggTrade, len(trades))
+		for i, trade := range trades {
+			reversed[len(trades)-1-i] = trade
+		}
+		err = c.persist(symbol, reversed, func() {
+			progress.written(symbol, fromId, tradeDate(page[0]), len(reversed))
+			for _, date := range days.observe(tradeDates(reversed)) {
+				c.finishDay(symbol, date)
+			}
+			if reachedStart && cfg.AlignDays && days.current != "" {
+				c.finishDay(symbol, days.current) // 구간 시작이 자정이므로 가장 오래된 날짜도 완료
+			}
+			if index != nil {
+				index.add(page[0].TradeId, page[len(page)-1].TradeId)
+				if err := index.save(); err != nil {
+					fmt.Printf("Error saving range index for %s: %v\n", symbol, err)
+				}
+			}
+		})
+		if err != nil {
+			if err := saveFailed(&saveFails, err); err != nil {
+				fmt.Printf("Stopping %s at before(%d): %v\n", symbol, before, err)
+				return err
+			}
+			fmt.Printf("Error saving page for %s before(%d), retrying: %v\n", symbol, before, err)
+			retryDelay(ctx, symbol, 5*time.Second)
+			continue
+		}
+		saveFails = 0
+
+		before = page[0].TradeId
+		if reachedStart {
+			fmt.Printf("Reached %s for %s. Finished.\n", start.Format(time.RFC3339), symbol)
+			break
+		}
+		if before == 0 {
+			fmt.Printf("Reached the oldest trade for %s. Finished.\n", symbol)
+			break
+		}
+	}
+	return nil
+}
+
+// tradesBefore keeps the trades with TradeId < before; pages are ascending.
+func tradesBefore(trades []AggTrade, before int64) []AggTrade {
+	for i, trade := range trades {
+		if trade.TradeId >= before {
+			return trades[:i]
+		}
+	}
+	return trades
+}
+
+// tradesFromTime keeps the trades with a timestamp at or after startMs;
+// pages are ascending.
+func tradesFromTime(trades []AggTrade, startMs int64) []AggTrade {
+	for i, trade := range trades {
+		if trade.Timestamp >= startMs {
+			return trades[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// minutes are n trade offsets one minute apart.
+func minutes(n int) []time.Duration {
+	offsets := make([]time.Duration, n)
+	for i := range offsets {
+		offsets[i] = time.Duration(i) * time.Minute
+	}
+	return offsets
+}
+
+// newestFirstIds runs one -newest-first collection of BTCUSDT and returns
+// the ids in its date files, oldest file first, failing if a file is not
+// descending.
+func newestFirstIds(t *testing.T) []int64 {
+	t.Helper()
+	c := NewCollector(noLimit{})
+	c.RegisterSink(newCSVSink())
+	if err := c.processSymbolNewestFirst(context.Background(), "BTCUSDT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	paths, _ := filepath.Glob(filepath.Join(symbolDir("BTCUSDT"), "*.csv"))
+	slices.Sort(paths)
+	var ids []int64
+	for _, path := range paths {
+		got := fileIds(t, path)
+		if !slices.IsSortedFunc(got, func(a, b int64) int { return int(b - a) }) {
+			t.Errorf("%s is not newest-first: %v...", filepath.Base(path), got[:min(len(got), 5)])
+		}
+		ids = append(ids, got...)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func idsBetween(from, to int64) []int64 {
+	var ids []int64
+	for id := from; id < to; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestNewestFirstPaging(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	tests := []struct {
+		name        string
+		trades      int
+		ids         func(i int) int64 // nil: i
+		start, end  time.Duration     // 0: open
+		wantIds     []int64
+		wantFromIds []int64
+	}{
+		{"clamps the last step to id 0", 1500, nil, 0, 0, idsBetween(0, 1500), []int64{0}},
+		{"whole pages", 3000, nil, 0, 0, idsBetween(0, 3000), []int64{1000, 0}},
+		{"a short and an empty page in the middle", 2500, func(i int) int64 {
+			if i < 1000 {
+				return int64(i)
+			}
+			return int64(i) + 2000 // 1000-2999 없음
+		}, 0, 0, append(idsBetween(0, 1000), idsBetween(3000, 4500)...), []int64{2500, 2000, 1000, 0}},
+		{"stops at the window start", 3000, nil, 1234 * time.Minute, 0, idsBetween(1234, 3000), []int64{1000}},
+		{"starts below the window end", 3000, nil, 0, 2500 * time.Minute, idsBetween(0, 2500), []int64{1500, 500, 0}},
+		{"both window edges", 3000, nil, 1234 * time.Minute, 2500 * time.Minute, idsBetween(1234, 2500), []int64{1500, 500}},
+		{"window start on a page edge", 3000, nil, 2000 * time.Minute, 0, idsBetween(2000, 3000), []int64{1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeDateFiles(t, nil)
+			cfg.Location, cfg.Format, cfg.NewestFirst, cfg.AlignDays = time.UTC, "csv", true, false
+			cfg.StartTime.Time, cfg.EndTime.Time = time.Time{}, time.Time{}
+			if tt.start > 0 {
+				cfg.StartTime.Time = windowBase.Add(tt.start)
+			}
+			if tt.end > 0 {
+				cfg.EndTime.Time = windowBase.Add(tt.end)
+			}
+			s := serveWindows(t, windowBase, minutes(tt.trades)...)
+			if tt.ids != nil {
+				for i := range s.trades {
+					s.trades[i].TradeId = tt.ids(i)
+				}
+			}
+			if got := newestFirstIds(t); !slices.Equal(got, tt.wantIds) {
+				t.Errorf("wrote %d ids %v..., want %d from %d", len(got), got[:min(len(got), 3)], len(tt.wantIds), tt.wantIds[0])
+			}
+			if !slices.Equal(s.fromIds, tt.wantFromIds) {
+				t.Errorf("requested fromIds %v, want %v", s.fromIds, tt.wantFromIds)
+			}
+		})
+	}
+}
+
+func TestNewestFirstResume(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	writeDateFiles(t, nil)
+	cfg.Location, cfg.Format, cfg.NewestFirst = time.UTC, "csv", true
+	cfg.StartTime.Time, cfg.EndTime.Time = time.Time{}, time.Time{}
+	s := serveWindows(t, windowBase, minutes(3500)...)
+
+	cfg.MaxPages = 2 // 최신 페이지와 그 아래 한 페이지
+	if got := newestFirstIds(t); !slices.Equal(got, idsBetween(1500, 3500)) {
+		t.Fatalf("first run wrote %d ids from %v", len(got), got[:min(len(got), 1)])
+	}
+	cfg.MaxPages = 0
+	s.fromIds = nil
+	if got := newestFirstIds(t); !slices.Equal(got, idsBetween(0, 3500)) {
+		t.Errorf("after resuming the files hold %d ids, want 3500 without duplicates", len(got))
+	}
+	if want := []int64{500, 0}; !slices.Equal(s.fromIds, want) {
+		t.Errorf("resumed with fromIds %v, want %v", s.fromIds, want)
+	}
+
+	s.fromIds, s.requests = nil, 0
+	if got := newestFirstIds(t); len(got) != 3500 {
+		t.Errorf("a finished symbol holds %d ids after another run, want 3500", len(got))
+	}
+	if s.requests != 0 {
+		t.Errorf("a finished symbol made %d requests", s.requests)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pausePollInterval is how often a paused symbol checks whether the pause
+// file is gone.
+const pausePollInterval = 2 * time.Second
+
+func pauseFile() string {
+	return filepath.Join(cfg.OutDir, ".pause")
+}
+
+// waitWhilePaused blocks while <out>/.pause exists, so touching the file
+// stops every symbol before its next request and removing it resumes them.
+func waitWhilePaused(ctx context.Context, name string) {
+	if _, err := os.Stat(pauseFile()); err != nil {
+		return
+	}
+	fmt.Printf("%s paused: %s exists\n", name, pauseFile())
+	progress.activity(name, activityPaused)
+	start := time.Now()
+	for ctx.Err() == nil {
+		sleepCtx(ctx, pausePollInterval)
+		if _, err := os.Stat(pauseFile()); err != nil {
+			fmt.Printf("%s resumed after %s\n", name, time.Since(start).Round(time.Second))
+			return
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// symbolFilter is one entry of a symbol's exchangeInfo filters; only the
+// tick and lot sizes are read.
+type symbolFilter struct {
+	FilterType string `json:"filterType"`
+	TickSize   string `json:"tickSize"`
+	StepSize   string `json:"stepSize"`
+}
+
+// symbolPrecision is the number of decimals a symbol's prices and
+// quantities are written with under -fixed-precision.
+type symbolPrecision struct {
+	priceTick, lotStep string
+	price, quantity    int
+}
+
+var (
+	precisions        map[string]symbolPrecision // -fixed-precision; 시작할 때 한 번 채움
+	precisionWarnings sync.Map                   // "symbol field" -> struct{}
+)
+
+// loadPrecisions looks up the tick size (PRICE_FILTER) and lot size
+// (LOT_SIZE) of every symbol in exchangeInfo for -fixed-precision.
+func loadPrecisions(symbols []string) error {
+	infos, err := fetchExchangeInfo()
+	if err != nil {
+		return fmt.Errorf("fetching exchangeInfo for -fixed-precision: %w", err)
+	}
+	bySymbol := make(map[string]SymbolInfo, len(infos))
+	for _, info := range infos {
+		bySymbol[info.Symbol] = info
+	}
+	precisions = make(map[string]symbolPrecision, len(symbols))
+	for _, symbol := range symbols {
+		info, ok := bySymbol[symbol]
+		if !ok {
+			return fmt.Errorf("-fixed-precision: %s is not in exchangeInfo", symbol)
+		}
+		var p symbolPrecision
+		for _, f := range info.Filters {
+			switch f.FilterType {
+			case "PRICE_FILTER":
+				p.priceTick = f.TickSize
+			case "LOT_SIZE":
+				p.lotStep = f.StepSize
+			}
+		}
+		if p.priceTick == "" || p.lotStep == "" {
+			return fmt.Errorf("-fixed-precision: exchangeInfo has no PRICE_FILTER tick size or LOT_SIZE step size for %s", symbol)
+		}
+		p.price, p.quantity = decimalPlaces(p.priceTick), decimalPlaces(p.lotStep)
+		precisions[symbol] = p
+	}
+	return nil
+}
+
+// decimalPlaces is the number of significant decimals of a step such as
+// "0.01000000" (2) or "1.00000000" (0).
+func decimalPlaces(step string) int {
+	_, frac, _ := strings.Cut(step, ".")
+	return len(strings.TrimRight(frac, "0"))
+}
+
+// fixDecimals writes s with exactly places decimals. ok is false, and s is
+// returned unchanged, when s has non-zero digits beyond them.
+func fixDecimals(s string, places int) (string, bool) {
+	intPart, frac, _ := strings.Cut(s, ".")
+	if len(frac) > places {
+		if strings.Trim(frac[places:], "0") != "" {
+			return s, false
+		}
+		frac = frac[:places]
+	}
+	if places == 0 {
+		return intPart, true
+	}
+	return intPart + "." + frac + strings.Repeat("0", places-len(frac)), true
+}
+
+// applyPrecision rewrites the prices and quantities of a grouped page to the
+// symbol's fixed decimals in place. A value more precise than the filter
+// allows is kept as it is, with a warning the first time per symbol and
+// field.
+func applyPrecision(symbol string, grouped map[string][]AggTrade) {
+	p, ok := precisions[symbol]
+	if !ok {
+		return
+	}
+	for _, trades := range grouped {
+		for i := range trades {
+			t := &trades[i]
+			var ok bool
+			if t.Price, ok = fixDecimals(t.Price, p.price); !ok {
+				precisionWarning(symbol, "price", t.Price, "tick size", p.priceTick)
+			}
+			if t.Quantity, ok = fixDecimals(t.Quantity, p.quantity); !ok {
+				precisionWarning(symbol, "quantity", t.Quantity, "lot size", p.lotStep)
+			}
+		}
+	}
+}
+
+func precisionWarning(symbol, field, value, filter, step string) {
+	if _, seen := precisionWarnings.LoadOrStore(symbol+" "+field, struct{}{}); seen {
+		return
+	}
+	fmt.Printf("Warning: %s %s %s has more decimals than its %s %s allows; writing such values unchanged\n", symbol, field, value, filter, step)
+}
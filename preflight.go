@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxClockSkew is how far the local clock may be from the server's. The
+	// limiter counts requests per local minute while Binance counts per
+	// server minute, so a larger skew lets two windows overlap.
+	maxClockSkew = time.Second
+)
+
+type preflightCheck struct {
+	name string
+	run  func() (detail string, err error)
+}
+
+// runPreflight implements the preflight subcommand: it checks the network,
+// the API, the clock and -out before a long run, and exits 1 if any check
+// fails.
+func runPreflight(args []string) int {
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	registerFlags(fs)
+	if err := parseArgs(fs, args); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	symbols, err := explicitSymbols()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	symbol := "BTCUSDT"
+	if len(symbols) > 0 {
+		symbol = symbols[0]
+	}
+
+	checks := []preflightCheck{
+		{"network settings", func() (string, error) { return "", configureHTTPClient() }},
+		{"API reachable", checkPing},
+		{"clock in sync", checkServerTime},
+		{"rate-limit headers", func() (string, error) { return checkWeightHeader(symbol) }},
+		{"output writable", checkOutWritable},
+		{"disk space", checkPreflightDisk},
+	}
+	failed := 0
+	for _, check := range checks {
+		detail, err := check.run()
+		status := "PASS"
+		if err != nil {
+			status, detail = "FAIL", err.Error()
+			failed++
+		}
+		if detail != "" {
+			fmt.Printf("%s  %-20s %s\n", status, check.name, detail)
+		} else {
+			fmt.Printf("%s  %s\n", status, check.name)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d checks failed\n", failed, len(checks))
+		return 1
+	}
+	fmt.Println("All checks passed")
+	return 0
+}
+
+// apiGet requests url and decodes a JSON body into v, if v is not nil.
+func apiGet(url string, v any) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, body, done, err := doGzip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	defer done()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(body)
+		return resp, parseAPIError(resp.StatusCode, bodyBytes)
+	}
+	if v != nil {
+		if err := json.NewDecoder(body).Decode(v); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+func checkPing() (string, error) {
+	start := time.Now()
+	if _, err := apiGet(pingURL, nil); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s round trip", time.Since(start).Round(time.Millisecond)), nil
+}
+
+// checkServerTime compares the local clock with /api/v3/time, taking the
+// server time as of the middle of the round trip.
+func checkServerTime() (string, error) {
+	var st struct {
+		ServerTime int64 `json:"serverTime"`
+	}
+	sent := time.Now()
+	if _, err := apiGet(serverTimeURL, &st); err != nil {
+		return "", err
+	}
+	received := time.Now()
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := local.Sub(time.UnixMilli(st.ServerTime))
+	detail := fmt.Sprintf("local clock is %s ahead of the server (round trip %s)", skew.Round(time.Millisecond), received.Sub(sent).Round(time.Millisecond))
+	if skew < 0 {
+		detail = fmt.Sprintf("local clock is %s behind the server (round trip %s)", (-skew).Round(time.Millisecond), received.Sub(sent).Round(time.Millisecond))
+	}
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return "", fmt.Errorf("%s; more than %s, sync the clock (NTP)", detail, maxClockSkew)
+	}
+	return detail, nil
+}
+
+func checkWeightHeader(symbol string) (string, error) {
+	u := apiURL + "?" + url.Values{"symbol": {symbol}, "limit": {"1"}}.Encode()
+	resp, err := apiGet(u, nil)
+	if err != nil {
+		return "", fmt.Errorf("aggTrades for %s: %w", symbol, err)
+	}
+	name := weightHeader()
+	used := resp.Header.Get(name)
+	if used == "" {
+		return "", fmt.Errorf("the response has no %s header (is a proxy stripping headers? see -weight-header)", name)
+	}
+	if _, err := strconv.Atoi(used); err != nil {
+		return "", fmt.Errorf("unreadable %s header %q", name, used)
+	}
+	return fmt.Sprintf("used weight %s this minute (aggTrades for %s)", used, symbol), nil
+}
+
+func checkOutWritable() (string, error) {
+	if err := os.MkdirAll(cfg.OutDir, cfg.DirMode.Perm()); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(cfg.OutDir, ".preflight-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("preflight\n"); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	abs, _ := filepath.Abs(cfg.OutDir)
+	return abs, nil
+}
+
+func checkPreflightDisk() (string, error) {
+	free, err := freeSpace(cfg.OutDir)
+	if errors.Is(err, errFreeSpaceUnsupported) {
+		return "not checked: " + err.Error(), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	detail := fmt.Sprintf("%.1f GB free", float64(free)/(1<<30))
+	if cfg.MinFree > 0 && free < uint64(cfg.MinFree) {
+		return "", fmt.Errorf("%s, below -min-free=%s", detail, cfg.MinFree.String())
+	}
+	if inodes, err := freeInodes(cfg.OutDir); err == nil {
+		detail += fmt.Sprintf(", %d inodes free", inodes)
+		if cfg.MinFreeInodes > 0 && inodes < cfg.MinFreeInodes {
+			return "", fmt.Errorf("%s, below -min-free-inodes=%d", detail, cfg.MinFreeInodes)
+		}
+	}
+	return detail, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// progressTracker is the per-symbol state printed by a progress dump
+// (SIGUSR1 where the platform has it).
+type progressTracker struct {
+	mu      sync.Mutex
+	symbols map[string]*symbolProgress
+	json    *json.Encoder // -progress-json
+}
+
+// pageEvent is one -progress-json line.
+type pageEvent struct {
+	Symbol    string `json:"symbol"`
+	FromId    int64  `json:"fromId"`
+	Trades    int    `json:"trades"`
+	Date      string `json:"date"`
+	ElapsedMs int64  `json:"elapsed_ms"` // since the symbol started
+}
+
+// openProgressJSON starts -progress-json output: "stderr" or a file path,
+// which may be a named pipe (opening it waits for a reader).
+func openProgressJSON() error {
+	var w io.Writer
+	switch cfg.ProgressJSON {
+	case "":
+		return nil
+	case "stderr", "-":
+		w = os.Stderr
+	default:
+		f, err := os.OpenFile(cfg.ProgressJSON, os.O_WRONLY|os.O_APPEND|os.O_CREATE, cfg.FileMode.Perm())
+		if err != nil {
+			return fmt.Errorf("opening -progress-json: %w", err)
+		}
+		w = f // 프로세스 종료까지 열어 둠
+	}
+	progress.json = json.NewEncoder(w)
+	return nil
+}
+
+type symbolProgress struct {
+	started  time.Time
+	fromId   int64 // 마지막으로 요청한 fromId
+	pages    int64
+	fetched  int64
+	written  int64 // after 콜백까지 끝난 거래 수
+	filtered int64 // -min-date/-max-date 밖이라 버린 거래 수
+	anomaly  int64 // checkAnomalies가 보고한 이상 수 (페이지별, 종류별)
+	finished bool
+	ended    time.Time
+
+	firstDate, lastDate string // 기록한 페이지의 날짜 범위 (-stats-file)
+
+	activity      string // -heartbeat: activity* 상수
+	activitySince time.Time
+}
+
+var progress = &progressTracker{symbols: make(map[string]*symbolProgress)}
+
+func (p *progressTracker) symbol(symbol string) *symbolProgress {
+	sp, ok := p.symbols[symbol]
+	if !ok {
+		sp = &symbolProgress{started: time.Now()}
+		p.symbols[symbol] = sp
+	}
+	return sp
+}
+
+func (p *progressTracker) start(symbol string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.symbol(symbol)
+}
+
+func (p *progressTracker) fetched(symbol string, fromId int64, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sp := p.symbol(symbol)
+	sp.fromId = fromId
+	sp.pages++
+	sp.activity, sp.activitySince = activityWriting, time.Now()
+	sp.fetched += int64(n)
+}
+
+// written records a stored page: n trades (or klines) requested at fromId,
+// the last of them dated date. With -progress-json it also emits the page.
+func (p *progressTracker) written(symbol string, fromId int64, date string, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sp := p.symbol(symbol)
+	sp.written += int64(n)
+	if date != "" && (sp.firstDate == "" || date < sp.firstDate) {
+		sp.firstDate = date
+	}
+	sp.lastDate = max(sp.lastDate, date)
+	throughput.add(0, 0, int64(n))
+	if p.json != nil {
+		p.json.Encode(pageEvent{
+			Symbol:    symbol,
+			FromId:    fromId,
+			Trades:    n,
+			Date:      date,
+			ElapsedMs: time.Since(sp.started).Milliseconds(),
+		})
+	}
+}
+
+func (p *progressTracker) anomalies(symbol string, n int) {
+	if n == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.symbol(symbol).anomaly += int64(n)
+}
+
+func (p *progressTracker) dateFiltered(symbol string, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.symbol(symbol).filtered += int64(n)
+}
+
+// reportDateFiltered prints how many trades -min-date/-max-date dropped per
+// symbol.
+func (p *progressTracker) reportDateFiltered() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.symbols))
+	for name := range p.symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("Dropped outside -min-date/-max-date:")
+	for _, name := range names {
+		fmt.Printf("  %-12s %d trades\n", name, p.symbols[name].filtered)
+	}
+}
+
+func (p *progressTracker) finish(symbol string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sp := p.symbol(symbol)
+	sp.finished, sp.ended = true, time.Now()
+}
+
+func (p *progressTracker) dump() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.symbols))
+	for name := range p.symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("Progress (%d symbols):\n", len(names))
+	for _, name := range names {
+		sp := p.symbols[name]
+		elapsed := time.Since(sp.started)
+		state := "running"
+		if sp.finished {
+			state = "finished"
+		}
+		fmt.Printf("  %-12s %-8s fromId(%d) pages=%d fetched=%d written=%d filtered=%d anomalies=%d rate=%.0f trades/s elapsed=%v\n",
+			name, state, sp.fromId, sp.pages, sp.fetched, sp.written, sp.filtered, sp.anomaly,
+			float64(sp.written)/max(elapsed.Seconds(), 1e-9), elapsed.Round(time.Second))
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+// watchProgressSignal is a no-op on platforms without SIGUSR1.
+func watchProgressSignal() {}
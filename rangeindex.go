@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+type idRange struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+// rangeIndex is the per-symbol record of tradeId ranges already written,
+// kept as sorted, non-overlapping, non-adjacent intervals.
+// Its methods are safe for concurrent use, since with -write-concurrency
+// ranges are added by the symbol's writer while the fetch loop reads them.
+type rangeIndex struct {
+	mu     sync.Mutex
+	path   string
+	Ranges []idRange `json:"ranges"`
+}
+
+func rangeIndexPath(symbol string) string {
+	return symbolPath(symbol, "ranges.json")
+}
+
+func loadRangeIndex(symbol string) (*rangeIndex, error) {
+	ix := &rangeIndex{path: rangeIndexPath(symbol)}
+	data, err := os.ReadFile(ix.path)
+	if os.IsNotExist(err) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, ix); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", ix.path, err)
+	}
+	ix.Ranges = mergeRanges(ix.Ranges)
+	return ix, nil
+}
+
+func mergeRanges(ranges []idRange) []idRange {
+	if len(ranges) == 0 {
+		return ranges
+	}
+	sorted := append([]idRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Min < sorted[j].Min })
+	merged := sorted[:1]
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.Min <= last.Max+1 {
+			last.Max = max(last.Max, r.Max)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func (ix *rangeIndex) add(min, max int64) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.Ranges = mergeRanges(append(ix.Ranges, idRange{Min: min, Max: max}))
+}
+
+func (ix *rangeIndex) find(id int64) (idRange, bool) {
+	i := sort.Search(len(ix.Ranges), func(i int) bool { return ix.Ranges[i].Max >= id })
+	if i < len(ix.Ranges) && ix.Ranges[i].Min <= id {
+		return ix.Ranges[i], true
+	}
+	return idRange{}, false
+}
+
+// skipForward returns the first id at or after fromId that is not covered.
+func (ix *rangeIndex) skipForward(fromId int64) int64 {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if r, ok := ix.find(fromId); ok {
+		return r.Max + 1
+	}
+	return fromId
+}
+
+// skipBackward is skipForward for -newest-first: it returns the lowest
+// covered id directly below before, or before itself.
+func (ix *rangeIndex) skipBackward(before int64) int64 {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if r, ok := ix.find(before - 1); ok {
+		return r.Min
+	}
+	return before
+}
+
+// uncovered drops trades whose ids are already recorded, for pages that run
+// into a range written by an earlier run.
+func (ix *rangeIndex) uncovered(trades []AggTrade) []AggTrade {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return filterTrades(trades, func(trade AggTrade) bool {
+		_, ok := ix.find(trade.TradeId)
+		return !ok
+	})
+}
+
+func (ix *rangeIndex) save() error {
+	ix.mu.Lock()
+	data, err := json.Marshal(ix)
+	ix.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := ix.path + ".tmp"
+	if err := os.WriteFile(tmp, data, cfg.FileMode.Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ix.path)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []idRange
+		want []idRange
+	}{
+		{"empty", nil, nil},
+		{"one", []idRange{{5, 9}}, []idRange{{5, 9}}},
+		{"disjoint stay apart", []idRange{{0, 9}, {20, 29}}, []idRange{{0, 9}, {20, 29}}},
+		{"unsorted", []idRange{{20, 29}, {0, 9}}, []idRange{{0, 9}, {20, 29}}},
+		{"adjacent merge", []idRange{{0, 9}, {10, 19}}, []idRange{{0, 19}}},
+		{"overlapping merge", []idRange{{0, 15}, {10, 19}}, []idRange{{0, 19}}},
+		{"contained", []idRange{{0, 100}, {10, 19}}, []idRange{{0, 100}}},
+		{"gap of one stays", []idRange{{0, 9}, {11, 19}}, []idRange{{0, 9}, {11, 19}}},
+		{"chain", []idRange{{30, 39}, {0, 9}, {10, 29}, {50, 50}}, []idRange{{0, 39}, {50, 50}}},
+		{"single ids", []idRange{{3, 3}, {1, 1}, {2, 2}}, []idRange{{1, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := slices.Clone(tt.in)
+			if got := mergeRanges(tt.in); !slices.Equal(got, tt.want) {
+				t.Errorf("mergeRanges(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+			if !slices.Equal(tt.in, in) {
+				t.Errorf("mergeRanges changed its input to %v", tt.in)
+			}
+		})
+	}
+}
+
+func TestRangeIndexSkip(t *testing.T) {
+	ix := &rangeIndex{}
+	ix.add(100, 199)
+	ix.add(300, 399)
+	ix.add(200, 249) // 100-249로 합쳐짐
+	if want := []idRange{{100, 249}, {300, 399}}; !slices.Equal(ix.Ranges, want) {
+		t.Fatalf("ranges %v, want %v", ix.Ranges, want)
+	}
+	forward := []struct{ from, want int64 }{
+		{0, 0}, {99, 99}, {100, 250}, {249, 250}, {250, 250}, {300, 400}, {400, 400},
+	}
+	for _, tt := range forward {
+		if got := ix.skipForward(tt.from); got != tt.want {
+			t.Errorf("skipForward(%d) = %d, want %d", tt.from, got, tt.want)
+		}
+	}
+	backward := []struct{ before, want int64 }{
+		{100, 100}, {101, 100}, {250, 100}, {251, 251}, {400, 300}, {401, 401},
+	}
+	for _, tt := range backward {
+		if got := ix.skipBackward(tt.before); got != tt.want {
+			t.Errorf("skipBackward(%d) = %d, want %d", tt.before, got, tt.want)
+		}
+	}
+	page := []AggTrade{{TradeId: 98}, {TradeId: 99}, {TradeId: 100}, {TradeId: 250}, {TradeId: 300}}
+	var ids []int64
+	for _, trade := range ix.uncovered(page) {
+		ids = append(ids, trade.TradeId)
+	}
+	if want := []int64{98, 99, 250}; !slices.Equal(ids, want) {
+		t.Errorf("uncovered kept %v, want %v", ids, want)
+	}
+}
+
+func TestRangeIndexSaveLoad(t *testing.T) {
+	writeDateFiles(t, nil)
+	ix, err := loadRangeIndex("BTCUSDT")
+	if err != nil || len(ix.Ranges) != 0 {
+		t.Fatalf("new index: %v, %v", ix.Ranges, err)
+	}
+	ix.add(10, 19)
+	ix.add(0, 9)
+	if err := ix.save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadRangeIndex("BTCUSDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []idRange{{0, 19}}; !slices.Equal(loaded.Ranges, want) {
+		t.Errorf("loaded %v, want %v", loaded.Ranges, want)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock only moves when it is slept on or advanced, so a limiter's
+// windows can be stepped through deterministically and without waiting.
+// Sleep returns at once after moving the clock forward by d, and records d.
+type manualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newManualClock(start time.Time) *manualClock {
+	return &manualClock{now: start}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	c.sleeps = append(c.sleeps, d)
+	c.mu.Unlock()
+	c.advance(d)
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var limiterStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestRateLimiterWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int
+		weights    []int
+		advance    time.Duration // before the last Wait
+		wantSleeps []time.Duration
+		wantCount  int
+	}{
+		{"under the limit", 10, []int{2, 3, 5}, 0, nil, 10},
+		{"over the limit sleeps to the reset", 10, []int{6, 5}, 0, []time.Duration{61 * time.Second}, 5},
+		{"sleeps only for the rest of the window", 10, []int{6, 5}, 20 * time.Second, []time.Duration{41 * time.Second}, 5},
+		{"a window that has passed refills", 10, []int{6, 5}, 61 * time.Second, nil, 5},
+		{"a weight above the limit fits an empty window", 10, []int{25}, 0, nil, 25},
+		{"an oversized weight waits for an empty window", 10, []int{1, 25}, 0, []time.Duration{61 * time.Second}, 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newManualClock(limiterStart)
+			rl := NewRateLimiter(tt.limit, clock)
+			for i, w := range tt.weights {
+				if i == len(tt.weights)-1 {
+					clock.advance(tt.advance)
+				}
+				rl.Wait(w)
+			}
+			if !slices.Equal(clock.sleeps, tt.wantSleeps) {
+				t.Errorf("slept %v, want %v", clock.sleeps, tt.wantSleeps)
+			}
+			if rl.count != tt.wantCount {
+				t.Errorf("window weight %d, want %d", rl.count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWindows(t *testing.T) {
+	clock := newManualClock(limiterStart)
+	rl := NewRateLimiter(100, clock)
+	for range 50 {
+		rl.Wait(10) // 창마다 10번
+	}
+	if got, want := len(clock.sleeps), 4; got != want {
+		t.Errorf("%d sleeps for 5 windows of weight, want %d", got, want)
+	}
+	if got, want := clock.Now().Sub(limiterStart), 4*61*time.Second; got != want {
+		t.Errorf("took %v of clock time, want %v", got, want)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// redownloadSuffix marks a date file moved aside by redownload until the
+// date has been downloaded again.
+const redownloadSuffix = ".redownload"
+
+// runRedownload implements the redownload subcommand: it replaces the given
+// dates of the symbols with a fresh download of each day (midnight to
+// midnight in -tz), leaving every other date alone. The old files are kept
+// as <name>.redownload until the new one is complete.
+func runRedownload(args []string) int {
+	fs := flag.NewFlagSet("redownload", flag.ExitOnError)
+	registerFlags(fs)
+	var dateList string
+	fs.StringVar(&dateList, "date", "", "comma-separated dates (YYYY-MM-DD, in -tz) to download again")
+	if err := parseArgs(fs, args); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		fmt.Printf("Error: invalid -tz %q: %v\n", cfg.Timezone, err)
+		return 2
+	}
+	cfg.Location = loc
+	var days []time.Time
+	for _, d := range strings.Split(dateList, ",") {
+		if d = strings.TrimSpace(d); d == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			fmt.Printf("Error: invalid -date %q (want YYYY-MM-DD)\n", d)
+			return 2
+		}
+		days = append(days, midnight(day.Date()))
+	}
+	if len(days) == 0 {
+		fmt.Println("Error: redownload requires -date")
+		return 2
+	}
+	if !flagWasSet(fs, "symbols") && cfg.SymbolsFile == "" {
+		fmt.Println("Error: redownload requires -symbols or -symbols-file")
+		return 2
+	}
+	if cfg.TradesPerFile > 0 || cfg.Archive != "" || cfg.Interval != "" {
+		fmt.Println("Error: redownload rewrites aggTrades date files and cannot be combined with -trades-per-file, -archive or -interval")
+		return 2
+	}
+	if err := configureHTTPClient(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if retryStatuses, err = parseRetryStatus(cfg.RetryStatus); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if weights, err = parseWeights(cfg.Weights); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if cfg.WeightLimit == 0 && exchange.weightLimit > 0 && !flagWasSet(fs, "rate") {
+		cfg.WeightLimit = exchange.weightLimit
+	}
+	sink, err := newSink(cfg.Format)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	symbolSinks, err := newSymbolSinks()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	limiter, err := newLimiter()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	symbols, err := explicitSymbols()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	if cfg.FixedPrecision {
+		if err := loadPrecisions(symbols); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+
+	release, err := acquireOutLock(cfg.OutDir, cfg.LockWait)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer release()
+
+	ctx, stop := runContext()
+	defer stop()
+	c := NewCollector(limiter)
+	c.RegisterSink(sink)
+	for symbol, s := range symbolSinks {
+		c.RegisterSymbolSink(symbol, s)
+	}
+
+	failed := false
+	var replaced []string // 새 파일이 완성된 날짜의 이전 파일
+	for _, symbol := range symbols {
+		old, err := c.redownloadSymbol(ctx, symbol, days)
+		replaced = append(replaced, old...)
+		if err != nil {
+			fmt.Printf("Error downloading %s again: %v\n", symbol, err)
+			failed = true
+		}
+	}
+	if err := c.Close(); err != nil {
+		fmt.Printf("Error closing sinks: %v\n", err)
+		failed = true
+	}
+	background.Wait()
+	for _, path := range replaced {
+		if err := os.Remove(path); err != nil {
+			fmt.Printf("Error removing %s: %v\n", path, err)
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// redownloadSymbol moves the symbol's files of days aside, drops them from
+// the manifest and collects each day again. It returns the moved-aside files
+// of the days that were collected completely; those of a failed day stay
+// next to the partial new file, so running redownload again still starts
+// from the original.
+func (c *Collector) redownloadSymbol(ctx context.Context, symbol string, days []time.Time) ([]string, error) {
+	ext := "." + formatFor(symbol)
+	if err := os.MkdirAll(symbolDir(symbol), cfg.DirMode.Perm()); err != nil {
+		return nil, err
+	}
+	m, err := loadManifestIn(cfg.OutDir, symbol)
+	if err != nil {
+		return nil, err
+	}
+	moved := make(map[string][]string)
+	for _, day := range days {
+		date := day.Format("2006-01-02")
+		for _, path := range dateFileVariants(symbol, date, ext) {
+			backup := path + redownloadSuffix
+			if _, err := os.Stat(backup); err == nil {
+				// 이전 redownload가 남긴 미완성 파일: 원본은 이미 옮겨 둠
+				if err := os.Remove(path); err != nil {
+					return nil, err
+				}
+			} else if err := os.Rename(path, backup); err != nil {
+				return nil, err
+			}
+			delete(m.Files, strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".gz"), ".zst"))
+		}
+		moved[date], _ = filepath.Glob(symbolPath(symbol, date+"*"+ext+"*"+redownloadSuffix))
+		delete(m.Complete, date)
+		m.dirty = true
+	}
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Downloading %d date(s) of %s again...\n", len(days), symbol)
+	progress.start(symbol)
+	defer progress.finish(symbol)
+	latest, err := fetchLatestTrade(symbol, c.limiter)
+	if err != nil {
+		return nil, fmt.Errorf("finding the latest trade: %w", err)
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no trades")
+	}
+
+	var replaced []string
+	var errs []error
+	for i, day := range days {
+		date := day.Format("2006-01-02")
+		err := runIsolated(symbol+" "+date, func() error {
+			return c.collectDay(ctx, symbol, days, i, latest, nil)
+		})
+		if err == nil && ctx.Err() != nil {
+			err = errAborted
+		}
+		if err == nil && len(dateFileVariants(symbol, date, ext)) == 0 {
+			err = errors.New("no trades were downloaded")
+		}
+		if err != nil {
+			fmt.Printf("%s %s was not downloaded again, the previous files are kept as *%s: %v\n", symbol, date, redownloadSuffix, err)
+			errs = append(errs, fmt.Errorf("%s: %w", date, err))
+			continue
+		}
+		replaced = append(replaced, moved[date]...)
+	}
+	return replaced, errors.Join(errs...)
+}
+
+// dateFileVariants lists the existing files of a date in the given format:
+// every part, compressed or not.
+func dateFileVariants(symbol, date, ext string) []string {
+	var paths []string
+	for part := 1; ; part++ {
+		found := false
+		for _, suffix := range compressedSuffixes {
+			path := symbolPath(symbol, dateFileName(date, part, ext)+suffix)
+			if _, err := os.Stat(path); err == nil {
+				paths, found = append(paths, path), true
+			}
+		}
+		if !found {
+			return paths
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// noLimiter lets every request through; -replay makes none.
+type noLimiter struct{}
+
+func (noLimiter) Wait(int) {}
+
+func responsePath(dir, symbol string, fromId int64) string {
+	return filepath.Join(dir, symbol, strconv.FormatInt(fromId, 10)+".json")
+}
+
+// recordResponse saves one page's raw body for -replay. A page that cannot
+// be saved is only logged; the collection itself does not depend on it.
+func recordResponse(symbol string, fromId int64, raw []byte) {
+	path := responsePath(cfg.RecordResponses, symbol, fromId)
+	err := os.MkdirAll(filepath.Dir(path), cfg.DirMode.Perm())
+	if err == nil {
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, raw, cfg.FileMode.Perm()); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error recording response for %s at fromId(%d): %v\n", symbol, fromId, err)
+	}
+}
+
+// replayTrades returns the page recorded for fromId. A page that was never
+// recorded ends the symbol like an empty response would.
+func replayTrades(symbol string, fromId int64) ([]AggTrade, error) {
+	path := responsePath(cfg.Replay, symbol, fromId)
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("No recorded response %s\n", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeAggTrades(bytes.NewReader(raw))
+}
+
+// firstRecordedId is the lowest fromId recorded for symbol, where a replay
+// starts unless -update continues from the data on disk.
+func firstRecordedId(symbol string) (int64, error) {
+	entries, err := os.ReadDir(filepath.Join(cfg.Replay, symbol))
+	if err != nil {
+		return 0, err
+	}
+	first := int64(-1)
+	for _, e := range entries {
+		id, err := strconv.ParseInt(strings.TrimSuffix(e.Name(), ".json"), 10, 64)
+		if err != nil || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		if first < 0 || id < first {
+			first = id
+		}
+	}
+	if first < 0 {
+		return 0, fmt.Errorf("no recorded pages in %s", filepath.Join(cfg.Replay, symbol))
+	}
+	return first, nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// failedRange is one line of <symbol>/failed_ranges.log. line is kept as
+// read so entries that are not retried are written back unchanged.
+type failedRange struct {
+	from, to int64
+	line     string
+}
+
+// runRetryFailed implements the retry-failed subcommand: it fetches the id
+// ranges -skip-bad-pages logged again, adds the trades missing from the CSV
+// date files, and drops the recovered ranges from the log.
+func runRetryFailed(args []string) int {
+	fs := flag.NewFlagSet("retry-failed", flag.ExitOnError)
+	registerFlags(fs)
+	if err := parseArgs(fs, args); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		fmt.Printf("Error: invalid -tz %q: %v\n", cfg.Timezone, err)
+		return 2
+	}
+	cfg.Location = loc
+	if cfg.Format != "csv" || cfg.TradesPerFile > 0 {
+		fmt.Println("Error: retry-failed reads existing CSV date files and requires -format=csv without -trades-per-file")
+		return 2
+	}
+	if discardFields, err = parseDiscardFields(cfg.DiscardFields); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if discardFields["tradeId"] {
+		fmt.Println("Error: retry-failed reads the tradeId column of the date files; it cannot be in -discard-fields")
+		return 2
+	}
+	if err := configureHTTPClient(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if retryStatuses, err = parseRetryStatus(cfg.RetryStatus); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if weights, err = parseWeights(cfg.Weights); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if cfg.WeightLimit == 0 && exchange.weightLimit > 0 && !flagWasSet(fs, "rate") {
+		cfg.WeightLimit = exchange.weightLimit
+	}
+	limiter, err := newLimiter()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	symbols, err := explicitSymbols()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if !flagWasSet(fs, "symbols") && cfg.SymbolsFile == "" {
+		if symbols, err = listSymbolDirs(cfg.OutDir); err != nil {
+			fmt.Printf("Error listing %s: %v\n", cfg.OutDir, err)
+			return 1
+		}
+	}
+
+	if cfg.FixedPrecision {
+		if err := loadPrecisions(symbols); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+
+	release, err := acquireOutLock(cfg.OutDir, cfg.LockWait)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer release()
+
+	failed := false
+	for _, symbol := range symbols {
+		if err := retryFailedRanges(symbol, limiter); err != nil {
+			fmt.Printf("Error retrying failed ranges of %s: %v\n", symbol, err)
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func retryFailedRanges(symbol string, rl Limiter) error {
+	logPath := symbolPath(symbol, "failed_ranges.log")
+	ranges, err := readFailedRanges(logPath)
+	if err != nil || len(ranges) == 0 {
+		return err
+	}
+
+	sink := newCSVSink()
+	var kept []failedRange
+	var errs int
+	for _, r := range ranges {
+		if r.to < r.from {
+			kept = append(kept, r) // 읽을 수 없는 줄은 그대로 둠
+			continue
+		}
+		added, err := recoverRange(sink, symbol, r, rl)
+		if err != nil {
+			fmt.Printf("%s: ids %d-%d not recovered, keeping them in %s: %v\n", symbol, r.from, r.to, logPath, err)
+			kept = append(kept, r)
+			errs++
+			continue
+		}
+		fmt.Printf("%s: recovered ids %d-%d (%d trades added)\n", symbol, r.from, r.to, added)
+	}
+	if err := sink.Close(); err != nil {
+		return err
+	}
+	if err := writeFailedRanges(logPath, kept); err != nil {
+		return err
+	}
+	if errs > 0 {
+		return fmt.Errorf("%d of %d ranges still failing", errs, len(ranges))
+	}
+	return nil
+}
+
+// recoverRange fetches the ids of r and adds the ones the date files do not
+// hold yet. It fails unless every id of r comes back, so that a range is only
+// dropped from the log once all of it is on disk. Each touched file is then
+// sorted again in the order it was written in, since the recovered rows are
+// appended after later ones.
+func recoverRange(sink *fileSink, symbol string, r failedRange, rl Limiter) (int, error) {
+	var trades []AggTrade
+	for fromId := r.from; fromId <= r.to; {
+		limit := int(min(int64(limitPerReq), r.to-fromId+1))
+		rl.Wait(aggTradesWeight(limit))
+		page, err := fetchAggTrades(symbol, url.Values{
+			"fromId": {strconv.FormatInt(fromId, 10)},
+			"limit":  {strconv.Itoa(limit)},
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(page) == 0 {
+			return 0, fmt.Errorf("fromId(%d) returned no trades", fromId)
+		}
+		for _, t := range page {
+			if t.TradeId >= r.from && t.TradeId <= r.to {
+				trades = append(trades, t)
+			}
+		}
+		last := page[len(page)-1].TradeId
+		if last < fromId {
+			return 0, fmt.Errorf("fromId(%d) returned trades up to %d", fromId, last)
+		}
+		fromId = last + 1
+	}
+	if got, want := countIds(trades), r.to-r.from+1; got != want {
+		return 0, fmt.Errorf("%d of the %d ids returned", got, want)
+	}
+
+	grouped := groupTradesByDate(trades)
+	applyPrecision(symbol, grouped)
+	added := 0
+	for date, dayTrades := range grouped {
+		missing, err := tradesNotOnDisk(symbol, date, dayTrades)
+		if err != nil {
+			return 0, err
+		}
+		if len(missing) == 0 {
+			delete(grouped, date)
+			continue
+		}
+		grouped[date] = missing
+		added += len(missing)
+	}
+	if len(grouped) == 0 {
+		return 0, nil
+	}
+	descending := make(map[string]bool, len(grouped))
+	for date := range grouped {
+		desc, err := descendingDateFile(symbol, date)
+		if err != nil {
+			return 0, err
+		}
+		descending[date] = desc
+	}
+	if _, err := sink.writePage(symbol, grouped); err != nil {
+		return 0, err
+	}
+	m := sink.manifest(symbol)
+	for date := range grouped {
+		for _, path := range datePartPaths(cfg.OutDir, symbol, date, ".csv") {
+			if err := sortDateFile(path, ".csv", descending[date]); err != nil {
+				return added, fmt.Errorf("sorting %s: %w", path, err)
+			}
+		}
+		if cfg.DailySummary && m.Complete[date] {
+			sink.writeDailySummary(symbol, date)
+		}
+	}
+	return added, nil
+}
+
+// countIds returns how many distinct tradeIds trades holds.
+func countIds(trades []AggTrade) int64 {
+	seen := make(map[int64]bool, len(trades))
+	for _, t := range trades {
+		seen[t.TradeId] = true
+	}
+	return int64(len(seen))
+}
+
+// descendingDateFile reports whether a date's CSV file was written
+// newest-first, from its first and last rows. A date without rows on disk
+// follows -newest-first.
+func descendingDateFile(symbol, date string) (bool, error) {
+	path := symbolPath(symbol, date+".csv")
+	first, err := firstRecord(path)
+	if os.IsNotExist(err) {
+		return cfg.NewestFirst, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	last, err := lastRecord(path)
+	if err != nil || first == nil || last == nil {
+		return cfg.NewestFirst, err
+	}
+	firstId, ferr := strconv.ParseInt(first[0], 10, 64)
+	lastId, lerr := strconv.ParseInt(last[0], 10, 64)
+	if ferr != nil || lerr != nil || firstId == lastId {
+		return cfg.NewestFirst, nil
+	}
+	return firstId > lastId, nil
+}
+
+// tradesNotOnDisk returns the trades whose tradeId is not in any part of
+// the date's CSV file yet.
+func tradesNotOnDisk(symbol, date string, trades []AggTrade) ([]AggTrade, error) {
+	if _, err := os.Stat(symbolPath(symbol, date+".csv.gz")); err == nil {
+		return nil, fmt.Errorf("%s is compressed and cannot be appended to", date)
+	}
+	if _, err := os.Stat(symbolPath(symbol, date+".csv.zst")); err == nil {
+		return nil, fmt.Errorf("%s is compressed and cannot be appended to", date)
+	}
+	minId, maxId := trades[0].TradeId, trades[0].TradeId
+	for _, t := range trades {
+		minId, maxId = min(minId, t.TradeId), max(maxId, t.TradeId)
+	}
+	seen := newIdSet(minId, maxId)
+	for _, path := range datePartPaths(cfg.OutDir, symbol, date, ".csv") {
+		_, err := eachCSVRow(path, func(id int64, _ []string) error {
+			if id >= minId && id <= maxId {
+				seen.add(id)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return filterTrades(trades, func(t AggTrade) bool { return !seen.has(t.TradeId) }), nil
+}
+
+func readFailedRanges(path string) ([]failedRange, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ranges []failedRange
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		r := failedRange{to: -1, line: line}
+		ids, _, _ := strings.Cut(line, "\t")
+		fromStr, toStr, ok := strings.Cut(ids, "-")
+		from, ferr := strconv.ParseInt(fromStr, 10, 64)
+		to, terr := strconv.ParseInt(toStr, 10, 64)
+		if ok && ferr == nil && terr == nil && from >= 0 {
+			r.from, r.to = from, to
+		} else {
+			fmt.Printf("%s: cannot read %q, leaving it in the log\n", path, line)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, scanner.Err()
+}
+
+// writeFailedRanges replaces the log with the ranges still failing, or
+// removes it when none are left.
+func writeFailedRanges(path string, ranges []failedRange) error {
+	if len(ranges) == 0 {
+		return os.Remove(path)
+	}
+	var b strings.Builder
+	for _, r := range ranges {
+		b.WriteString(r.line + "\n")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), cfg.FileMode.Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type noLimit struct{}
+
+func (noLimit) Wait(int) {}
+
+// serveTrades points apiURL at a server that answers fromId with the trades
+// of ids, 60 s apart from 2023-11-14 00:00 UTC, and records the queries.
+func serveTrades(t *testing.T, ids []int64) *[]string {
+	t.Helper()
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		from, _ := strconv.ParseInt(r.URL.Query().Get("fromId"), 10, 64)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		var page []AggTrade
+		for _, id := range ids {
+			if id >= from && len(page) < limit {
+				page = append(page, testTrade(id))
+			}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(srv.Close)
+	old := apiURL
+	apiURL = srv.URL + "/api/v3/aggTrades"
+	t.Cleanup(func() { apiURL = old })
+	return &queries
+}
+
+func testTrade(id int64) AggTrade {
+	return AggTrade{TradeId: id, Price: "1.0", Quantity: "2", FirstId: id, LastId: id,
+		Timestamp: time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC).UnixMilli() + id*60000}
+}
+
+// writeTrades saves trades to a date file as a run would, in the given order.
+func writeTrades(t *testing.T, date string, ids ...int64) string {
+	t.Helper()
+	path := symbolPath("BTCUSDT", date+".csv")
+	var trades []AggTrade
+	for _, id := range ids {
+		trades = append(trades, testTrade(id))
+	}
+	if err := saveToCSV(path, csvRecords(trades)); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func fileIds(t *testing.T, path string) []int64 {
+	t.Helper()
+	var ids []int64
+	if _, err := eachCSVRow(path, func(id int64, _ []string) error {
+		ids = append(ids, id)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestRecoverRange(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.Location, cfg.Format = time.UTC, "csv"
+	tests := []struct {
+		name    string
+		served  []int64
+		onDisk  []int64
+		from    int64
+		to      int64
+		wantErr bool
+		want    []int64
+	}{
+		{"fills the gap", []int64{0, 1, 2, 3, 4, 5}, []int64{0, 1, 4, 5}, 2, 3, false, []int64{0, 1, 2, 3, 4, 5}},
+		{"newest first", []int64{0, 1, 2, 3, 4, 5}, []int64{5, 4, 1, 0}, 2, 3, false, []int64{5, 4, 3, 2, 1, 0}},
+		{"already on disk", []int64{0, 1, 2, 3}, []int64{0, 1, 2, 3}, 1, 2, false, []int64{0, 1, 2, 3}},
+		{"empty answer", nil, []int64{0, 1, 4, 5}, 2, 3, true, []int64{0, 1, 4, 5}},
+		{"short answer", []int64{0, 1, 2, 4, 5}, []int64{0, 1, 4, 5}, 2, 3, true, []int64{0, 1, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeDateFiles(t, nil)
+			queries := serveTrades(t, tt.served)
+			path := writeTrades(t, "2023-11-14", tt.onDisk...)
+			sink := newCSVSink()
+			_, err := recoverRange(sink, "BTCUSDT", failedRange{from: tt.from, to: tt.to}, noLimit{})
+			if cerr := sink.Close(); cerr != nil {
+				t.Fatal(cerr)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got := fileIds(t, path); !slices.Equal(got, tt.want) {
+				t.Errorf("file holds %v, want %v", got, tt.want)
+			}
+			for _, q := range *queries {
+				if n := len(mustParseQuery(t, q)["symbol"]); n != 1 {
+					t.Errorf("query %q has %d symbol parameters", q, n)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryFailedRangesKeepsUnrecovered(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.Location, cfg.Format = time.UTC, "csv"
+	writeDateFiles(t, nil)
+	serveTrades(t, []int64{0, 1, 2, 3})
+	writeTrades(t, "2023-11-14", 0, 3)
+	logPath := symbolPath("BTCUSDT", "failed_ranges.log")
+	if err := os.WriteFile(logPath, []byte("1-2\tboom\n7-9\tboom\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := retryFailedRanges("BTCUSDT", noLimit{}); err == nil {
+		t.Error("want an error for the range that was not served")
+	}
+	got, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "7-9\tboom\n" {
+		t.Errorf("log holds %q, want only the unrecovered range", got)
+	}
+	if ids := fileIds(t, filepath.Join(cfg.OutDir, "BTCUSDT", "2023-11-14.csv")); !slices.Equal(ids, []int64{0, 1, 2, 3}) {
+		t.Errorf("file holds %v", ids)
+	}
+}
+
+func mustParseQuery(t *testing.T, q string) map[string][]string {
+	t.Helper()
+	values, err := url.ParseQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
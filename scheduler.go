@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// roundRobin hands out fetch turns (-scheduler=round-robin) to the running
+// jobs one page at a time, in the order they were started. A job that is not
+// asking for a turn (writing, retrying, paused) is passed over for that
+// round, so it cannot hold up the others. Only one job waits on the limiter
+// at a time, which keeps the weight spent per symbol even.
+type roundRobin struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ring    []string       // 실행 중인 작업, 시작 순서
+	waiting map[string]int // -full-history 창은 같은 이름을 공유
+	next    int            // ring에서 다음 차례의 위치
+	busy    bool
+}
+
+func newRoundRobin() *roundRobin {
+	r := &roundRobin{waiting: make(map[string]int)}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+func (r *roundRobin) join(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !slices.Contains(r.ring, name) {
+		r.ring = append(r.ring, name)
+	}
+}
+
+func (r *roundRobin) leave(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.waiting[name] > 0 {
+		return // 같은 이름의 다른 창이 아직 차례를 기다림
+	}
+	if i := slices.Index(r.ring, name); i >= 0 {
+		r.ring = slices.Delete(r.ring, i, i+1)
+		if i < r.next {
+			r.next--
+		}
+	}
+	r.cond.Broadcast()
+}
+
+// turn blocks until it is name's turn and returns the function that passes
+// the turn on.
+func (r *roundRobin) turn(name string) (done func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !slices.Contains(r.ring, name) {
+		r.ring = append(r.ring, name)
+	}
+	r.waiting[name]++
+	for r.busy || r.nextWaiting() != name {
+		r.cond.Wait()
+	}
+	r.waiting[name]--
+	r.busy = true
+	r.next = slices.Index(r.ring, name) + 1
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.busy = false
+		r.cond.Broadcast()
+	}
+}
+
+// nextWaiting is the first job from next on, wrapping around, that is
+// waiting for a turn.
+func (r *roundRobin) nextWaiting() string {
+	for i := range r.ring {
+		name := r.ring[(r.next+i)%len(r.ring)]
+		if r.waiting[name] > 0 {
+			return name
+		}
+	}
+	return ""
+}
+
+func parseScheduler(s string) error {
+	switch s {
+	case "per-symbol", "round-robin":
+		return nil
+	}
+	return fmt.Errorf("invalid -scheduler %q: want per-symbol or round-robin", s)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond under r.mu until it holds.
+func waitFor(t *testing.T, r *roundRobin, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		ok := cond()
+		r.mu.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting on the scheduler")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitingJobs(r *roundRobin) int {
+	n := 0
+	for _, w := range r.waiting {
+		n += w
+	}
+	return n
+}
+
+func TestRoundRobinBalancedProgress(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages map[string]int // 작업별 페이지 수
+		want  string         // 차례를 받은 순서
+	}{
+		{"even", map[string]int{"A": 3, "B": 3, "C": 3}, "ABCABCABC"},
+		{"one job", map[string]int{"A": 3}, "AAA"},
+		{"jobs that finish early leave the ring", map[string]int{"A": 1, "B": 3, "C": 2}, "ABCBCB"},
+		{"the last job started finishes first", map[string]int{"A": 4, "B": 2, "C": 1}, "ABCABAA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRoundRobin()
+			names := []string{"A", "B", "C"}[:len(tt.pages)]
+			for _, name := range names {
+				r.join(name)
+			}
+			// 모든 작업이 차례를 기다릴 때까지 첫 차례를 막아 둠
+			r.mu.Lock()
+			r.busy = true
+			r.mu.Unlock()
+
+			var mu sync.Mutex
+			var order strings.Builder
+			var wg sync.WaitGroup
+			for _, name := range names {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer r.leave(name)
+					for range tt.pages[name] {
+						done := r.turn(name)
+						mu.Lock()
+						order.WriteString(name)
+						mu.Unlock()
+						// 느린 페이지: 남은 작업이 모두 줄을 설 때까지 차례를 쥠
+						waitFor(t, r, func() bool { return waitingJobs(r) == len(r.ring)-1 })
+						done()
+					}
+				}()
+			}
+			waitFor(t, r, func() bool { return waitingJobs(r) == len(names) })
+			r.mu.Lock()
+			r.busy = false
+			r.cond.Broadcast()
+			r.mu.Unlock()
+			wg.Wait()
+
+			if got := order.String(); got != tt.want {
+				t.Errorf("turns went %s, want %s", got, tt.want)
+			}
+			if len(r.ring) != 0 {
+				t.Errorf("ring still holds %v", r.ring)
+			}
+		})
+	}
+}
+
+func TestRoundRobinSkipsIdleJobs(t *testing.T) {
+	r := newRoundRobin()
+	r.join("A")
+	r.join("B") // 쓰는 중: 차례를 청하지 않음
+	for range 3 {
+		done := make(chan struct{})
+		go func() {
+			r.turn("A")()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("A waited on B, which never asked for a turn")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+)
+
+// jsonSchema is the subset of JSON Schema the schema subcommand prints.
+type jsonSchema struct {
+	Schema               string        `json:"$schema,omitempty"`
+	Title                string        `json:"title,omitempty"`
+	Description          string        `json:"description,omitempty"`
+	Type                 string        `json:"type"`
+	Format               string        `json:"format,omitempty"`
+	Pattern              string        `json:"pattern,omitempty"`
+	Enum                 []string      `json:"enum,omitempty"`
+	Items                *jsonSchema   `json:"items,omitempty"`
+	Properties           schemaColumns `json:"properties,omitempty"`
+	Required             []string      `json:"required,omitempty"`
+	AdditionalProperties *bool         `json:"additionalProperties,omitempty"`
+}
+
+type schemaColumn struct {
+	name   string
+	schema jsonSchema
+}
+
+// schemaColumns encodes as an object whose keys keep the output's column
+// order.
+type schemaColumns []schemaColumn
+
+func (cols schemaColumns) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, col := range cols {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(col.name)
+		value, err := json.Marshal(col.schema)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+const decimalPattern = `^-?[0-9]+(\.[0-9]+)?$`
+
+// runSchema implements the schema subcommand: it prints the JSON Schema of
+// one output row (a CSV row read as column name to string, or a JSONL line)
+// or, for -format=json, of a whole file, for the given flags.
+func runSchema(args []string) int {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	registerFlags(fs)
+	if err := parseArgs(fs, args); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if cfg.Format == "avro" {
+		fmt.Println("Error: Avro files carry their own schema; schema describes -format=csv, jsonl and json")
+		return 2
+	}
+	if _, err := newSink(cfg.Format); err != nil { // -json-fields 등 검증, jsonKeys 설정
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	row := tradeSchema(cfg.Format == "csv")
+	out := row
+	if cfg.Format == "json" {
+		out = jsonSchema{Title: row.Title, Description: "A date file: a JSON array of trades.", Type: "array", Items: &row}
+		row.Title = ""
+	}
+	out.Schema = "https://json-schema.org/draft/2020-12/schema"
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
+
+// tradeSchema describes one trade as the writers produce it. CSV fields are
+// all strings, so there each column gets a pattern instead of a type.
+func tradeSchema(csv bool) jsonSchema {
+	closed := false
+	s := jsonSchema{
+		Title:                "binance-data aggTrades (" + cfg.Format + ")",
+		Type:                 "object",
+		AdditionalProperties: &closed,
+	}
+	names := csvHeader()
+	if csv {
+		s.Description = "One row of a CSV date file, read as column name to value. The first line of every file is the header, in this column order."
+	} else {
+		s.Description = "One trade of a " + cfg.Format + " date file."
+		names = nil
+		for _, field := range jsonFields {
+			if field != "quoteQty" || cfg.QuoteQty {
+				names = append(names, field)
+			}
+		}
+	}
+	for _, field := range names {
+		col := fieldSchema(field, csv)
+		name := field
+		if !csv {
+			name = jsonKey(jsonKeys, field)
+		}
+		s.Properties = append(s.Properties, schemaColumn{name, col})
+		s.Required = append(s.Required, name)
+	}
+	return s
+}
+
+func fieldSchema(field string, csv bool) jsonSchema {
+	switch field {
+	case "tradeId":
+		if csv {
+			return jsonSchema{Type: "string", Pattern: `^[0-9]+$`, Description: "Aggregate trade id (a)."}
+		}
+		return jsonSchema{Type: "integer", Description: "Aggregate trade id (a)."}
+	case "price":
+		return jsonSchema{Type: "string", Pattern: decimalPattern, Description: "Price as the exact decimal string returned by the API (p)."}
+	case "quantity":
+		return jsonSchema{Type: "string", Pattern: decimalPattern, Description: "Quantity as the exact decimal string returned by the API (q)."}
+	case "timestamp":
+		return timestampSchema(csv)
+	case "isBuyerMaker":
+		if csv {
+			return jsonSchema{Type: "string", Enum: []string{"true", "false"}, Description: "Whether the buyer was the maker (m)."}
+		}
+		return jsonSchema{Type: "boolean", Description: "Whether the buyer was the maker (m)."}
+	case "quoteQty":
+		return jsonSchema{Type: "string", Pattern: decimalPattern, Description: "price * quantity, computed exactly by the collector (-quote-qty); not returned by the API."}
+	case checksumColumn:
+		return jsonSchema{Type: "string", Pattern: `^[0-9a-f]{8}$`, Description: "CRC-32 (IEEE) of the row's other fields joined by commas, as 8 hex digits (-row-checksum)."}
+	}
+	return jsonSchema{Type: "string"}
+}
+
+func timestampSchema(csv bool) jsonSchema {
+	switch cfg.TimestampFormat {
+	case "seconds":
+		desc := "Trade time (T) in Unix seconds with millisecond fraction."
+		if csv {
+			return jsonSchema{Type: "string", Pattern: `^[0-9]+\.[0-9]{3}$`, Description: desc}
+		}
+		return jsonSchema{Type: "number", Description: desc}
+	case "iso8601":
+		return jsonSchema{Type: "string", Format: "date-time", Description: "Trade time (T) as RFC 3339 with milliseconds, in " + cfg.Timezone + "."}
+	case "unix-nanos":
+		desc := "Trade time (T) in Unix nanoseconds (millisecond precision)."
+		if csv {
+			return jsonSchema{Type: "string", Pattern: `^[0-9]+$`, Description: desc}
+		}
+		return jsonSchema{Type: "integer", Description: desc}
+	}
+	desc := "Trade time (T) in Unix milliseconds."
+	if csv {
+		return jsonSchema{Type: "string", Pattern: `^[0-9]+$`, Description: desc}
+	}
+	return jsonSchema{Type: "integer", Description: desc}
+}
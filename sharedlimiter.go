@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newLimiter returns the limiter for -rate: private to this process, or,
+// with -shared-limiter, a budget shared by every process pointed at the same
+// file or Redis key. Shared budgets count requests per wall-clock minute.
+func newLimiter() (Limiter, error) {
+	if cfg.Replay != "" {
+		return noLimiter{}, nil // 재생은 API를 호출하지 않음
+	}
+	if cfg.SharedLimiter == "" {
+		rl := NewRateLimiter(weightBudget(), realClock{})
+		if cfg.AlignLimiter {
+			if err := rl.alignToServer(); err != nil {
+				fmt.Printf("Warning: could not align the limiter to the server minute, starting a fresh window: %v\n", err)
+			}
+		}
+		return rl, nil
+	}
+	u, err := url.Parse(cfg.SharedLimiter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -shared-limiter: %w", err)
+	}
+	switch u.Scheme {
+	case "file":
+		path := u.Path
+		if u.Opaque != "" {
+			path = u.Opaque // file:relative/path
+		}
+		return newFileLimiter(path, weightBudget())
+	case "redis":
+		return newRedisLimiter(u, weightBudget())
+	default:
+		return nil, fmt.Errorf("invalid -shared-limiter %q (want file:///path or redis://host:port/key)", cfg.SharedLimiter)
+	}
+}
+
+// waitSharedSlot takes weight from a shared budget. take adds weight to the
+// count for the given minute and returns the new count.
+func waitSharedSlot(name string, limit, weight int, take func(minute int64, weight int) (int, error)) {
+	for {
+		now := time.Now()
+		minute := now.Unix() / 60
+		count, err := take(minute, weight)
+		if err != nil {
+			fmt.Printf("Error using shared limiter %s, retrying: %v\n", name, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if count <= limit || count == weight {
+			fmt.Printf("Request permitted. Current minute's shared weight: %d/%d\n", count, limit)
+			return
+		}
+		sleepDuration := time.Unix((minute+1)*60, 0).Sub(now)
+		fmt.Printf("Shared rate limit reached. Waiting for %v...\n", sleepDuration)
+		time.Sleep(sleepDuration)
+	}
+}
+
+// fileLimiter keeps "<minute> <count>" in a small file, updated under flock.
+type fileLimiter struct {
+	mu    sync.Mutex
+	f     *os.File
+	limit int
+}
+
+func newFileLimiter(path string, limit int) (*fileLimiter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, cfg.FileMode.Perm())
+	if err != nil {
+		return nil, fmt.Errorf("opening -shared-limiter file: %w", err)
+	}
+	if err := withFileLock(f, func() error { return nil }); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking -shared-limiter file: %w", err)
+	}
+	return &fileLimiter{f: f, limit: limit}, nil
+}
+
+func (l *fileLimiter) Wait(weight int) {
+	waitSharedSlot(l.f.Name(), l.limit, weight, l.take)
+}
+
+func (l *fileLimiter) take(minute int64, weight int) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var count int
+	err := withFileLock(l.f, func() error {
+		buf := make([]byte, 64)
+		n, err := l.f.ReadAt(buf, 0)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		var stored int64
+		if fields := strings.Fields(string(buf[:n])); len(fields) == 2 {
+			stored, _ = strconv.ParseInt(fields[0], 10, 64)
+			count, _ = strconv.Atoi(fields[1])
+		}
+		if stored != minute {
+			count = 0
+		}
+		if count > 0 && count+weight > l.limit {
+			count += weight // 기록하지 않고 초과만 알림
+			return nil
+		}
+		count += weight
+		if err := l.f.Truncate(0); err != nil {
+			return err
+		}
+		_, err = l.f.WriteAt([]byte(fmt.Sprintf("%d %d\n", minute, count)), 0)
+		return err
+	})
+	return count, err
+}
+
+// redisLimiter counts request weight with INCRBY on <key>:<minute>, which
+// expires after two minutes. It speaks just enough RESP for INCRBY, EXPIRE
+// and AUTH.
+type redisLimiter struct {
+	mu    sync.Mutex
+	addr  string
+	user  string
+	pass  string
+	key   string
+	limit int
+	conn  net.Conn
+	r     *bufio.Reader
+}
+
+func newRedisLimiter(u *url.URL, limit int) (*redisLimiter, error) {
+	l := &redisLimiter{addr: u.Host, key: strings.Trim(u.Path, "/"), limit: limit}
+	if u.Port() == "" {
+		l.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if l.key == "" {
+		l.key = "binance-data:limiter"
+	}
+	if u.User != nil {
+		l.user = u.User.Username()
+		l.pass, _ = u.User.Password()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.connect(); err != nil {
+		return nil, fmt.Errorf("connecting to -shared-limiter %s: %w", l.addr, err)
+	}
+	return l, nil
+}
+
+func (l *redisLimiter) Wait(weight int) {
+	waitSharedSlot(l.addr+"/"+l.key, l.limit, weight, l.take)
+}
+
+func (l *redisLimiter) connect() error {
+	conn, err := net.DialTimeout("tcp", l.addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	l.conn, l.r = conn, bufio.NewReader(conn)
+	if l.pass != "" {
+		args := []string{"AUTH", l.pass}
+		if l.user != "" {
+			args = []string{"AUTH", l.user, l.pass}
+		}
+		if _, err := l.command(args...); err != nil {
+			l.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *redisLimiter) close() {
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+}
+
+func (l *redisLimiter) take(minute int64, weight int) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		if err := l.connect(); err != nil {
+			return 0, err
+		}
+	}
+	key := fmt.Sprintf("%s:%d", l.key, minute)
+	count, err := l.command("INCRBY", key, strconv.Itoa(weight))
+	if err == nil && count == int64(weight) {
+		_, err = l.command("EXPIRE", key, "120")
+	}
+	if err != nil {
+		l.close() // 다음 호출에서 다시 연결
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// command sends one command and returns its integer reply (0 for "+OK").
+func (l *redisLimiter) command(args ...string) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	l.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(l.conn, b.String()); err != nil {
+		return 0, err
+	}
+	line, err := l.r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return 0, fmt.Errorf("empty reply from redis")
+	}
+	switch line[0] {
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '+':
+		return 0, nil
+	case '-':
+		return 0, fmt.Errorf("redis: %s", line[1:])
+	default:
+		return 0, fmt.Errorf("unexpected reply from redis: %q", line)
+	}
+}
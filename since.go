@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sinceTradeIds is the parsed -since-trade-id: a fromId for every symbol
+// and per-symbol overrides.
+type sinceTradeIds struct {
+	all      int64 // -1: 없음
+	bySymbol map[string]int64
+}
+
+var sinceIds = sinceTradeIds{all: -1}
+
+// parseSinceTradeIds reads "N", "SYMBOL=N" or a comma-separated mix such as
+// "1000000,ETHUSDT=2500000".
+func parseSinceTradeIds(s string) (sinceTradeIds, error) {
+	ids := sinceTradeIds{all: -1, bySymbol: make(map[string]int64)}
+	for item := range strings.SplitSeq(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		symbol, value, ok := strings.Cut(item, "=")
+		if !ok {
+			symbol, value = "", item
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || id < 0 {
+			return sinceTradeIds{}, fmt.Errorf("invalid -since-trade-id entry %q (want a non-negative tradeId, or SYMBOL=tradeId)", item)
+		}
+		if symbol = strings.ToUpper(strings.TrimSpace(symbol)); symbol == "" {
+			ids.all = id
+		} else {
+			ids.bySymbol[symbol] = id
+		}
+	}
+	return ids, nil
+}
+
+func (ids sinceTradeIds) set() bool {
+	return ids.all >= 0 || len(ids.bySymbol) > 0
+}
+
+// fromId returns the symbol's -since-trade-id, if it has one.
+func (ids sinceTradeIds) fromId(symbol string) (int64, bool) {
+	if id, ok := ids.bySymbol[symbol]; ok {
+		return id, true
+	}
+	return ids.all, ids.all >= 0
+}
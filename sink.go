@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Sink receives collected trades. The collector calls Write from the
+// goroutine that owns the symbol, so calls for one symbol never overlap and
+// arrive in collection order: pages in fetch order and, within a page, one
+// call per date in ascending order. Calls for different symbols run
+// concurrently, so a Sink shared across symbols must synchronize its own
+// state. A Write error makes the collector retry the whole page; a sink must
+// not keep a partial write of a failed call. Close is called once, after
+// every symbol has finished.
+type Sink interface {
+	Write(symbol, date string, trades []AggTrade) error
+	Close() error
+}
+
+// pageWriter is implemented by sinks that can write a page atomically and
+// undo it when a later sink fails the same page.
+type pageWriter interface {
+	writePage(symbol string, grouped map[string][]AggTrade) (undo func(), err error)
+}
+
+// dayFinisher is implemented by sinks that act once a date can no longer
+// receive trades.
+type dayFinisher interface {
+	finishDay(symbol, date string)
+}
+
+func sortedDates(grouped map[string][]AggTrade) []string {
+	dates := make([]string, 0, len(grouped))
+	for date := range grouped {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// fileSink appends each date's trades to one file per date,
+// <symbol>/<date><ext>, using appendTrades for the encoding. A symbol's
+// files, manifest and chunk state are only touched by that symbol's goroutine
+// (or its writer), and symbols never share a file, so the per-symbol state
+// sits in a sync.Map written once per symbol and pages take no lock.
+type fileSink struct {
+	ext          string
+	appendTrades func(path string, trades []AggTrade) error
+
+	symbols sync.Map // symbol -> *symbolFiles
+}
+
+// symbolFiles is one symbol's sink state, used only by the symbol's owner.
+type symbolFiles struct {
+	manifest *manifest
+	chunk    *chunkState              // -trades-per-file; nil until first used
+	archive  *tarArchive              // -archive; nil until a day finishes
+	days     map[string]*dayAggregate // -daily-summary; 아직 끝나지 않은 날짜
+}
+
+func newCSVSink() *fileSink {
+	return &fileSink{ext: ".csv", appendTrades: func(path string, trades []AggTrade) error {
+		return saveToCSV(path, csvRecords(trades))
+	}}
+}
+
+func newJSONLSink() *fileSink {
+	return &fileSink{ext: ".jsonl", appendTrades: saveToJSONL}
+}
+
+func newJSONSink() *fileSink {
+	return &fileSink{ext: ".json", appendTrades: saveToJSON}
+}
+
+func newAvroSink() *fileSink {
+	return &fileSink{ext: ".avro", appendTrades: saveToAvro}
+}
+
+var sinkFormats = map[string]func() Sink{
+	"csv":   func() Sink { return newCSVSink() },
+	"jsonl": func() Sink { return newJSONLSink() },
+	"json":  func() Sink { return newJSONSink() },
+	"avro":  func() Sink { return newAvroSink() },
+}
+
+func newSink(format string) (Sink, error) {
+	newFn, ok := sinkFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown -format %q (want csv, jsonl, json or avro)", format)
+	}
+	if cfg.Pretty && format != "json" {
+		return nil, fmt.Errorf("-pretty output is not valid %s; it requires -format=json", format)
+	}
+	keys, err := parseJSONFields(cfg.JSONFields)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil && (format == "csv" || format == "avro") {
+		return nil, fmt.Errorf("-json-fields applies to -format=jsonl or json, not %s", format)
+	}
+	if format == "avro" && cfg.TimestampFormat != "millis" {
+		return nil, fmt.Errorf("-format=avro stores timestamps as timestamp-millis; -timestamp-format does not apply")
+	}
+	if (format == "avro" || format == "json") && cfg.TradesPerFile > 0 {
+		return nil, fmt.Errorf("-trades-per-file counts lines on resume and does not support -format=%s", format)
+	}
+	if cfg.RowChecksum && format != "csv" {
+		return nil, fmt.Errorf("-row-checksum adds a CSV column; it requires -format=csv")
+	}
+	discard, err := parseDiscardFields(cfg.DiscardFields)
+	if err != nil {
+		return nil, err
+	}
+	if discard != nil && format != "csv" {
+		return nil, fmt.Errorf("-discard-fields removes CSV columns; it requires -format=csv")
+	}
+	jsonKeys, discardFields = keys, discard
+	return newFn(), nil
+}
+
+// path returns the file the next trades for date go to: the last existing
+// part, or a new part once that one has reached -max-file-size.
+func (s *fileSink) path(symbol, date string) string {
+	if cfg.MaxFileSize <= 0 {
+		return symbolPath(symbol, date+s.ext)
+	}
+	parts := datePartPaths(cfg.OutDir, symbol, date, s.ext)
+	if len(parts) == 0 {
+		return symbolPath(symbol, dateFileName(date, 1, s.ext))
+	}
+	last := parts[len(parts)-1]
+	if info, err := os.Stat(last); err == nil && info.Size() >= int64(cfg.MaxFileSize) {
+		return symbolPath(symbol, dateFileName(date, len(parts)+1, s.ext))
+	}
+	return last
+}
+
+func (s *fileSink) files(symbol string) *symbolFiles {
+	if f, ok := s.symbols.Load(symbol); ok {
+		return f.(*symbolFiles)
+	}
+	m, err := loadManifestIn(cfg.OutDir, symbol)
+	if err != nil {
+		fmt.Printf("Error loading manifest for %s, starting a new one: %v\n", symbol, err)
+		m = newManifest(manifestPathIn(cfg.OutDir, symbol))
+	}
+	f, _ := s.symbols.LoadOrStore(symbol, &symbolFiles{manifest: m})
+	return f.(*symbolFiles)
+}
+
+func (s *fileSink) manifest(symbol string) *manifest {
+	return s.files(symbol).manifest
+}
+
+func (s *fileSink) Write(symbol, date string, trades []AggTrade) error {
+	if cfg.TradesPerFile > 0 {
+		_, err := s.writeChunks(symbol, map[string][]AggTrade{date: trades})
+		return err
+	}
+	path := s.path(symbol, date)
+	if err := s.appendTrades(path, trades); err != nil {
+		return err
+	}
+	m := s.manifest(symbol)
+	m.record(path, date, trades)
+	if err := m.saveIfDue(); err != nil {
+		fmt.Printf("Error saving manifest for %s: %v\n", symbol, err)
+	}
+	if cfg.DailySummary {
+		if _, err := s.files(symbol).addDaily(map[string][]AggTrade{date: trades}); err != nil {
+			fmt.Printf("Error adding %s %s to the daily summary: %v\n", symbol, date, err)
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	var errs []error
+	s.symbols.Range(func(key, value any) bool {
+		symbol, f := key.(string), value.(*symbolFiles)
+		if st := f.chunk; st != nil {
+			last := st.part - 1 // 마지막 청크는 가득 찼을 때만 끝난 것
+			if st.rows >= int64(cfg.TradesPerFile) {
+				last = st.part
+			}
+			for ; st.finished < last; st.finished++ {
+				compressFinishedDay(symbolPath(symbol, chunkFileName(st.finished+1, s.ext)))
+			}
+		}
+		if f.archive != nil {
+			errs = append(errs, f.archive.close())
+		}
+		errs = append(errs, f.manifest.save())
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+func csvRecords(trades []AggTrade) [][]string {
+	records := make([][]string, len(trades))
+	for i, trade := range trades {
+		records[i] = tradeRecord(trade)
+	}
+	return records
+}
+
+// fileMark remembers a file's size and last bytes before a page is appended
+// to it, so the page can be undone even by a writer that rewrites the end
+// of the file (the JSON array's closing bracket). size is -1 when the page
+// creates the file.
+type fileMark struct {
+	path string
+	size int64
+	tail []byte
+}
+
+const markTailSize = 8
+
+func markFile(path string) fileMark {
+	mark := fileMark{path: path, size: -1}
+	if info, err := os.Stat(path); err == nil {
+		mark.size = info.Size()
+		mark.tail, _ = readTail(path, mark.size, markTailSize)
+	}
+	return mark
+}
+
+// rollbackFiles truncates each marked file back to its previous size and
+// restores its last bytes, or removes it if the page created it.
+func rollbackFiles(marks []fileMark) {
+	for _, mark := range marks {
+		var err error
+		if mark.size < 0 {
+			err = os.Remove(mark.path)
+		} else if err = os.Truncate(mark.path, mark.size); err == nil && len(mark.tail) > 0 {
+			err = restoreTail(mark)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error rolling back %s: %v\n", mark.path, err)
+		}
+	}
+}
+
+func restoreTail(mark fileMark) error {
+	f, err := os.OpenFile(mark.path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(mark.tail, mark.size-int64(len(mark.tail))); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writePage writes every date group of one page, or none of them: if any
+// group fails, files already touched by this page are truncated back to
+// their previous size (or removed if the page created them).
+func (s *fileSink) writePage(symbol string, grouped map[string][]AggTrade) (func(), error) {
+	if cfg.TradesPerFile > 0 {
+		return s.writeChunks(symbol, grouped)
+	}
+
+	var marks []fileMark
+	dates := sortedDates(grouped)
+	paths := make([]string, len(dates))
+	for i, date := range dates {
+		filePath := s.path(symbol, date)
+		paths[i] = filePath
+		marks = append(marks, markFile(filePath))
+		if err := s.appendTrades(filePath, grouped[date]); err != nil {
+			rollbackFiles(marks[:i]) // 실패한 파일은 appendFile이 이미 되돌림
+			return nil, fmt.Errorf("saving %s: %w", filePath, err)
+		}
+	}
+
+	m := s.manifest(symbol)
+	saved := m.snapshot(paths)
+	for i, date := range dates {
+		m.record(paths[i], date, grouped[date])
+	}
+	if err := m.saveIfDue(); err != nil {
+		fmt.Printf("Error saving manifest for %s: %v\n", symbol, err)
+	}
+	undoDaily := func() {}
+	if cfg.DailySummary {
+		var err error
+		if undoDaily, err = s.files(symbol).addDaily(grouped); err != nil {
+			rollbackFiles(marks)
+			m.restore(saved)
+			return nil, fmt.Errorf("adding to the daily summary: %w", err)
+		}
+	}
+	return func() {
+		rollbackFiles(marks)
+		m.restore(saved)
+		undoDaily()
+	}, nil
+}
+
+func (s *fileSink) finishDay(symbol, date string) {
+	m := s.manifest(symbol)
+	m.markComplete(date)
+	if err := m.save(); err != nil {
+		fmt.Printf("Error saving manifest for %s: %v\n", symbol, err)
+	}
+	if cfg.DailySummary {
+		s.writeDailySummary(symbol, date)
+	}
+	if cfg.Sort {
+		for _, path := range datePartPaths(cfg.OutDir, symbol, date, s.ext) {
+			if err := sortDateFile(path, s.ext, false); err != nil {
+				fmt.Printf("Error sorting %s, leaving it as written: %v\n", path, err)
+			}
+		}
+	}
+	if cfg.Archive != "" {
+		s.archiveDay(symbol, date)
+		return
+	}
+	for _, path := range datePartPaths(cfg.OutDir, symbol, date, s.ext) {
+		compressFinishedDay(path)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// failingSink is a CSV sink whose appends fail on the given calls, counted
+// from 1, after writing part of a row as a failed write can.
+func failingSink(failOn ...int) *fileSink {
+	calls := 0
+	return &fileSink{ext: ".csv", appendTrades: func(path string, trades []AggTrade) error {
+		calls++
+		if slices.Contains(failOn, calls) {
+			return appendFile(path, func(file *os.File, _ bool) error {
+				file.WriteString("1440,1.0,")
+				return errors.New("disk full")
+			})
+		}
+		return saveToCSV(path, csvRecords(trades))
+	}}
+}
+
+func TestWritePageAllOrNothing(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.Location, cfg.Format = time.UTC, "csv"
+	// 0-2는 11-14, 1440부터는 11-15 (1분 간격)
+	page := []AggTrade{testTrade(0), testTrade(1), testTrade(2), testTrade(1440), testTrade(1441)}
+	tests := []struct {
+		name    string
+		before  []int64 // 11-14 파일에 이미 있는 id
+		failOn  []int
+		wantErr bool
+		want14  []int64
+		want15  []int64
+	}{
+		{"both dates saved", nil, nil, false, []int64{0, 1, 2}, []int64{1440, 1441}},
+		{"second date fails", nil, []int{2}, true, nil, nil},
+		{"second date fails after earlier pages", []int64{-2, -1}, []int{2}, true, []int64{-2, -1}, nil},
+		{"first date fails", []int64{-1}, []int{1}, true, []int64{-1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeDateFiles(t, nil)
+			var before []byte
+			if tt.before != nil {
+				before, _ = os.ReadFile(writeTrades(t, "2023-11-14", tt.before...))
+			}
+			sink := failingSink(tt.failOn...)
+			_, err := sink.writePage("BTCUSDT", groupTradesByDate(page))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.before != nil {
+				if after, _ := os.ReadFile(symbolPath("BTCUSDT", "2023-11-14.csv")); tt.wantErr && string(after) != string(before) {
+					t.Errorf("11-14 was not restored byte for byte:\n%s\nwant\n%s", after, before)
+				}
+			}
+			for date, want := range map[string][]int64{"2023-11-14": tt.want14, "2023-11-15": tt.want15} {
+				path := symbolPath("BTCUSDT", date+".csv")
+				if want == nil {
+					if _, err := os.Stat(path); !os.IsNotExist(err) {
+						t.Errorf("%s exists after a failed page", path)
+					}
+					continue
+				}
+				if got := fileIds(t, path); !slices.Equal(got, want) {
+					t.Errorf("%s holds %v, want %v", date, got, want)
+				}
+			}
+			if m := sink.manifest("BTCUSDT"); tt.wantErr && len(m.Files) > 0 && tt.before == nil {
+				t.Errorf("manifest records %v after a failed page", m.Files)
+			}
+		})
+	}
+}
+
+func TestWritePageRetryAfterFailure(t *testing.T) {
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg.Location, cfg.Format = time.UTC, "csv"
+	writeDateFiles(t, nil)
+	page := []AggTrade{testTrade(0), testTrade(1), testTrade(1440), testTrade(1441)}
+	sink := failingSink(2)
+	if _, err := sink.writePage("BTCUSDT", groupTradesByDate(page)); err == nil {
+		t.Fatal("want the first attempt to fail")
+	}
+	if _, err := sink.writePage("BTCUSDT", groupTradesByDate(page)); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileIds(t, symbolPath("BTCUSDT", "2023-11-14.csv")); !slices.Equal(got, []int64{0, 1}) {
+		t.Errorf("11-14 holds %v after the retry, want [0 1]", got)
+	}
+	if got := fileIds(t, symbolPath("BTCUSDT", "2023-11-15.csv")); !slices.Equal(got, []int64{1440, 1441}) {
+		t.Errorf("11-15 holds %v after the retry, want [1440 1441]", got)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snapshotKind is one -snapshots endpoint: its name on the command line and
+// as the output directory, its request weight endpoint and the fields of its
+// rows, after captureTime.
+type snapshotKind struct {
+	name     string
+	endpoint string
+	columns  []string
+}
+
+var snapshotKinds = []snapshotKind{
+	{"bookTicker", "ticker/bookTicker", []string{"symbol", "bidPrice", "bidQty", "askPrice", "askQty"}},
+	{"24hr", "ticker/24hr", []string{"symbol", "priceChange", "priceChangePercent", "weightedAvgPrice", "prevClosePrice",
+		"lastPrice", "lastQty", "bidPrice", "bidQty", "askPrice", "askQty", "openPrice", "highPrice", "lowPrice",
+		"volume", "quoteVolume", "openTime", "closeTime", "firstId", "lastId", "count"}},
+}
+
+// snapshotMaxSymbols is the longest symbols list a snapshot sends. Beyond it
+// the tickers of every symbol are requested and filtered, which costs the
+// same weight and keeps the URL short.
+const snapshotMaxSymbols = 100
+
+func (k snapshotKind) url() string {
+	if k.name == "24hr" {
+		return ticker24hrURL
+	}
+	return bookTickerURL
+}
+
+func (k snapshotKind) header() []string {
+	return append([]string{"captureTime"}, k.columns...)
+}
+
+func parseSnapshots(list string) ([]snapshotKind, error) {
+	var kinds []snapshotKind
+	var names []string
+	for _, name := range splitList(list) {
+		found := false
+		for _, kind := range snapshotKinds {
+			if kind.name == name {
+				kinds, found = append(kinds, kind), true
+			}
+		}
+		if !found {
+			for _, kind := range snapshotKinds {
+				names = append(names, kind.name)
+			}
+			return nil, fmt.Errorf("invalid -snapshots %q (want %s)", name, strings.Join(names, ", "))
+		}
+	}
+	return kinds, nil
+}
+
+// snapshotDir is where one kind's date files go: <symbol>/<kind>.
+func snapshotDir(symbol string, kind snapshotKind) string {
+	return symbolPath(symbol, kind.name)
+}
+
+// runSnapshots takes a snapshot of every kind for the symbols now and then
+// every interval until ctx is done, so the snapshots cover the run.
+func (c *Collector) runSnapshots(ctx context.Context, symbols []string, kinds []snapshotKind, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for _, kind := range kinds {
+			if err := c.snapshot(kind, symbols); err != nil {
+				fmt.Printf("Error taking %s snapshot: %v\n", kind.name, err)
+			}
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// snapshot fetches one kind for the symbols and appends a row per symbol to
+// <symbol>/<kind>/<date>.csv, by the date of the capture time.
+func (c *Collector) snapshot(kind snapshotKind, symbols []string) error {
+	c.limiter.Wait(requestWeight(kind.endpoint, len(symbols)))
+	tickers, err := fetchSnapshot(kind, symbols)
+	if err != nil {
+		return err
+	}
+	captured := time.Now()
+	date := captured.In(cfg.Location).Format("2006-01-02")
+	captureTime := strconv.FormatInt(captured.UnixMilli(), 10)
+
+	rows := make(map[string][]string, len(tickers))
+	for _, ticker := range tickers {
+		record := []string{captureTime}
+		for _, column := range kind.columns {
+			record = append(record, snapshotField(ticker[column]))
+		}
+		rows[record[1]] = record
+	}
+	var errs []error
+	for _, symbol := range symbols {
+		record, ok := rows[symbol]
+		if !ok {
+			continue // 전체 목록에서 걸러짐, 또는 응답에 없음
+		}
+		dir := snapshotDir(symbol, kind)
+		if err := os.MkdirAll(dir, cfg.DirMode.Perm()); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		path := filepath.Join(dir, date+".csv")
+		if err := appendCSV(path, kind.header(), [][]string{record}); err != nil {
+			errs = append(errs, fmt.Errorf("saving %s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// snapshotField is a ticker field as written: strings unquoted, numbers as
+// returned.
+func snapshotField(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// fetchSnapshot requests one kind's tickers: by symbol for one symbol, by a
+// symbols list up to snapshotMaxSymbols, and every symbol's beyond that.
+func fetchSnapshot(kind snapshotKind, symbols []string) ([]map[string]json.RawMessage, error) {
+	req, err := http.NewRequest("GET", kind.url(), nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	switch {
+	case len(symbols) == 1:
+		q.Add("symbol", symbols[0])
+	case len(symbols) <= snapshotMaxSymbols:
+		list, _ := json.Marshal(symbols)
+		q.Add("symbols", string(list))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	start := time.Now()
+	defer func() { observeFetch(kind.name, req.URL.RawQuery, time.Since(start)) }()
+
+	resp, body, done, err := doGzip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	defer done()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(body)
+		return nil, parseAPIError(resp.StatusCode, bodyBytes)
+	}
+
+	var tickers []map[string]json.RawMessage
+	if len(symbols) == 1 {
+		var ticker map[string]json.RawMessage // symbol 하나면 배열이 아닌 객체
+		if err := json.NewDecoder(body).Decode(&ticker); err != nil {
+			return nil, err
+		}
+		return append(tickers, ticker), nil
+	}
+	if err := json.NewDecoder(body).Decode(&tickers); err != nil {
+		return nil, err
+	}
+	return tickers, nil
+}
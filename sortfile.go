@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// sortDateFile rewrites a finished date file in tradeId order (-sort), or
+// in descending order for a -newest-first file. The whole file is held in
+// memory; files already in order are left untouched.
+func sortDateFile(path, ext string, descending bool) error {
+	switch ext {
+	case ".csv":
+		return sortCSVFile(path, descending)
+	case ".jsonl":
+		return sortJSONLFile(path, descending)
+	}
+	return fmt.Errorf("-sort does not support %s files", ext)
+}
+
+type sortedRow struct {
+	id   int64
+	data []byte
+}
+
+func sortCSVFile(path string, descending bool) error {
+	var rows []sortedRow
+	var buf bytes.Buffer
+	w := newCSVWriter(&buf)
+	header, err := eachCSVRow(path, func(id int64, record []string) error {
+		buf.Reset()
+		w.Write(record)
+		w.Flush()
+		rows = append(rows, sortedRow{id, bytes.Clone(buf.Bytes())})
+		return w.Error()
+	})
+	if err != nil {
+		return err
+	}
+	buf.Reset()
+	if len(header) > 0 && strings.HasPrefix(header[0], utf8BOM) {
+		// -bom 파일: BOM은 헤더 앞에 따옴표 없이 다시 씀
+		header[0] = strings.TrimPrefix(header[0], utf8BOM)
+		buf.WriteString(utf8BOM)
+	}
+	w.Write(header)
+	w.Flush()
+	return writeSortedRows(path, buf.Bytes(), rows, descending)
+}
+
+func sortJSONLFile(path string, descending bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	idKey := jsonKey(jsonKeys, "tradeId")
+	var rows []sortedRow
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		var id int64
+		if err := json.Unmarshal(fields[idKey], &id); err != nil {
+			return fmt.Errorf("line %d: bad %s: %w", line, idKey, err)
+		}
+		rows = append(rows, sortedRow{id, append(bytes.Clone(scanner.Bytes()), '\n')})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return writeSortedRows(path, nil, rows, descending)
+}
+
+// writeSortedRows replaces path with header followed by rows in tradeId
+// order, unless they are in order already.
+func writeSortedRows(path string, header []byte, rows []sortedRow, descending bool) error {
+	byId := func(a, b sortedRow) int { return cmp.Compare(a.id, b.id) }
+	if descending {
+		byId = func(a, b sortedRow) int { return cmp.Compare(b.id, a.id) }
+	}
+	if slices.IsSortedFunc(rows, byId) {
+		return nil
+	}
+	slices.SortStableFunc(rows, byId)
+
+	tmp := path + ".sort.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, cfg.FileMode.Perm())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // rename에 성공하면 이미 없음
+
+	bw := bufio.NewWriter(out)
+	bw.Write(header)
+	for _, row := range rows {
+		bw.Write(row.data)
+	}
+	err = bw.Flush()
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	fmt.Printf("Sorted %s (%d rows)\n", path, len(rows))
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSortCSVFile(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.FileMode = 0o644
+	tests := []struct {
+		name       string
+		bom        bool
+		quote      string
+		ids        []int64
+		descending bool
+		want       []int64
+		wantHeader string
+	}{
+		{"ascending", false, "minimal", []int64{3, 1, 2}, false, []int64{1, 2, 3}, "tradeId,price"},
+		{"descending", false, "minimal", []int64{1, 3, 2}, true, []int64{3, 2, 1}, "tradeId,price"},
+		{"BOM", true, "minimal", []int64{3, 1, 2}, false, []int64{1, 2, 3}, utf8BOM + "tradeId,price"},
+		{"BOM descending", true, "minimal", []int64{1, 3, 2}, true, []int64{3, 2, 1}, utf8BOM + "tradeId,price"},
+		{"BOM outside quotes", true, "all", []int64{2, 1}, false, []int64{1, 2}, utf8BOM + `"tradeId","price"`},
+		{"already sorted", true, "all", []int64{1, 2}, false, []int64{1, 2}, utf8BOM + "tradeId,price"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.CSVQuote, cfg.CSVCRLF = tt.quote, false
+			var b strings.Builder
+			if tt.bom {
+				b.WriteString(utf8BOM)
+			}
+			b.WriteString("tradeId,price\n")
+			for _, id := range tt.ids {
+				b.WriteString(strconv.FormatInt(id, 10) + ",1.0\n")
+			}
+			path := filepath.Join(t.TempDir(), "2023-11-14.csv")
+			if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := sortDateFile(path, ".csv", tt.descending); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header, _, _ := strings.Cut(string(data), "\n"); header != tt.wantHeader {
+				t.Errorf("header %q, want %q", header, tt.wantHeader)
+			}
+			// encoding/csv는 BOM 뒤의 따옴표를 읽지 못하므로 떼고 읽음
+			records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), utf8BOM))).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, record := range records[1:] {
+				id, _ := strconv.ParseInt(record[0], 10, 64)
+				got = append(got, id)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
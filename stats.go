@@ -0,0 +1,120 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// runStats is the -stats-file report.
+type runStats struct {
+	Started       time.Time     `json:"started"`
+	Finished      time.Time     `json:"finished"`
+	DurationMs    int64         `json:"duration_ms"`
+	ExitCode      int           `json:"exit_code"`
+	Status        string        `json:"status"`
+	AbortReason   string        `json:"abort_reason,omitempty"`
+	WireBytes     int64         `json:"wire_bytes"`
+	DecodedBytes  int64         `json:"decoded_bytes"`
+	Connections   int64         `json:"connections"`
+	TradesWritten int64         `json:"trades_written"`
+	Symbols       []symbolStats `json:"symbols"`
+}
+
+type symbolStats struct {
+	Symbol     string `json:"symbol"`
+	Status     string `json:"status"` // complete, empty, halted, failed or aborted
+	Error      string `json:"error,omitempty"`
+	Pages      int64  `json:"pages"`
+	Fetched    int64  `json:"fetched"`
+	Written    int64  `json:"written"`
+	Filtered   int64  `json:"filtered,omitempty"`
+	Anomalies  int64  `json:"anomalies,omitempty"`
+	LastFromId int64  `json:"last_from_id"`
+	FirstDate  string `json:"first_date,omitempty"`
+	LastDate   string `json:"last_date,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+var exitStatusNames = map[int]string{
+	exitComplete:  "complete",
+	exitPartial:   "partial",
+	exitAllFailed: "failed",
+	exitAborted:   "aborted",
+}
+
+// writeStatsFile writes the -stats-file report for a finished (or stopped)
+// run, replacing the file atomically so a reader never sees half of it.
+func writeStatsFile(ctx context.Context, path string, started time.Time, results []SymbolResult, code int) error {
+	now := time.Now()
+	stats := runStats{
+		Started:      started,
+		Finished:     now,
+		DurationMs:   now.Sub(started).Milliseconds(),
+		ExitCode:     code,
+		Status:       exitStatusNames[code],
+		WireBytes:    transferStats.wire.Load(),
+		DecodedBytes: transferStats.decoded.Load(),
+		Connections:  transferStats.conns.Load(),
+		Symbols:      []symbolStats{},
+	}
+	if code == exitAborted {
+		stats.AbortReason = context.Cause(ctx).Error()
+	}
+
+	progress.mu.Lock()
+	for _, r := range results {
+		s := symbolStats{Symbol: r.Symbol, Status: "complete"}
+		var h *haltedError
+		switch {
+		case r.Err == nil:
+		case errors.Is(r.Err, errNoTrades):
+			s.Status = "empty"
+		case errors.As(r.Err, &h):
+			s.Status, s.Error = "halted", h.Error()
+		case errors.Is(r.Err, errAborted):
+			s.Status = "aborted"
+		default:
+			s.Status, s.Error = "failed", r.Err.Error()
+		}
+		if sp, ok := progress.symbols[r.Symbol]; ok {
+			s.Pages, s.Fetched, s.Written, s.Filtered, s.Anomalies = sp.pages, sp.fetched, sp.written, sp.filtered, sp.anomaly
+			s.LastFromId, s.FirstDate, s.LastDate = sp.fromId, sp.firstDate, sp.lastDate
+			end := sp.ended
+			if end.IsZero() {
+				end = now
+			}
+			s.DurationMs = end.Sub(sp.started).Milliseconds()
+		}
+		stats.TradesWritten += s.Written
+		stats.Symbols = append(stats.Symbols, s)
+	}
+	progress.mu.Unlock()
+	slices.SortFunc(stats.Symbols, func(a, b symbolStats) int { return cmp.Compare(a.Symbol, b.Symbol) })
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // rename에 성공하면 이미 없음
+	_, err = tmp.Write(append(data, '\n'))
+	if err == nil {
+		err = tmp.Chmod(cfg.FileMode.Perm())
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
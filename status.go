@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// statusNotListed stands for a symbol exchangeInfo no longer lists.
+const statusNotListed = "NOT_LISTED"
+
+// haltedError is the result of a symbol that caught up to its last trade
+// while exchangeInfo no longer reported it as TRADING (-status-check): it
+// was delisted or its trading is halted, rather than merely up to date.
+type haltedError struct {
+	status string
+}
+
+func (e *haltedError) Error() string {
+	return fmt.Sprintf("no longer trading (status %s)", e.status)
+}
+
+// statusWatcher polls exchangeInfo every -status-check for the trading
+// status of the running symbols and logs every change, so a symbol halted or
+// delisted during a long run shows up while it is still being collected.
+type statusWatcher struct {
+	limiter Limiter
+
+	mu     sync.Mutex
+	status map[string]string // 마지막으로 확인한 상태
+}
+
+func newStatusWatcher(limiter Limiter) *statusWatcher {
+	return &statusWatcher{limiter: limiter, status: make(map[string]string)}
+}
+
+// run checks the symbols now and then every interval until ctx is done.
+func (w *statusWatcher) run(ctx context.Context, symbols []string, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := w.check(symbols); err != nil {
+			fmt.Printf("Error checking symbol status: %v\n", err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check fetches exchangeInfo once and returns the status of each symbol,
+// logging the ones that changed since the last check.
+func (w *statusWatcher) check(symbols []string) (map[string]string, error) {
+	w.limiter.Wait(requestWeight("exchangeInfo", 0))
+	infos, err := fetchExchangeInfo()
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]string, len(infos))
+	for _, info := range infos {
+		listed[info.Symbol] = info.Status
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	statuses := make(map[string]string, len(symbols))
+	for _, symbol := range symbols {
+		status, ok := listed[symbol]
+		if !ok {
+			status = statusNotListed
+		}
+		statuses[symbol] = status
+		prev := w.status[symbol]
+		w.status[symbol] = status
+		switch {
+		case status == prev:
+		case status != "TRADING":
+			fmt.Printf("Symbol %s is delisted or halted: exchangeInfo status %s\n", symbol, status)
+		case prev != "":
+			fmt.Printf("Symbol %s is trading again\n", symbol)
+		}
+	}
+	return statuses, nil
+}
+
+// caughtUp is called when a symbol has no more trades. It checks the
+// symbol's status once more and returns a haltedError unless it is still
+// TRADING, so "up to date" and "no longer trades" end differently. A failed
+// check is logged and the symbol ends normally.
+func (w *statusWatcher) caughtUp(symbol string) error {
+	statuses, err := w.check([]string{symbol})
+	if err != nil {
+		fmt.Printf("Error checking the status of %s: %v\n", symbol, err)
+		return nil
+	}
+	if status := statuses[symbol]; status != "TRADING" {
+		return &haltedError{status}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// dailySummaryHeader is the header of <symbol>/index.csv (-daily-summary).
+var dailySummaryHeader = []string{"date", "trades", "firstPrice", "lastPrice", "minPrice", "maxPrice", "volume", "quoteVolume"}
+
+// dayAggregate accumulates one date's -daily-summary row as pages are
+// written. First and last are by tradeId, so -newest-first pages, which
+// arrive newest first, give the same row.
+type dayAggregate struct {
+	trades           int64
+	firstId, lastId  int64
+	first, last      string
+	minPrice         string
+	maxPrice         string
+	volume, quoteVol decimalSum
+}
+
+// decimalSum adds decimal strings exactly.
+type decimalSum struct {
+	n     big.Int
+	scale int
+}
+
+func (s *decimalSum) add(d string) error {
+	x, scale, err := parseDecimal(d)
+	if err != nil {
+		return err
+	}
+	ten := big.NewInt(10)
+	for ; s.scale < scale; s.scale++ {
+		s.n.Mul(&s.n, ten)
+	}
+	for ; scale < s.scale; scale++ {
+		x.Mul(x, ten)
+	}
+	s.n.Add(&s.n, x)
+	return nil
+}
+
+func (s *decimalSum) String() string {
+	return formatDecimal(&s.n, s.scale)
+}
+
+// cmpDecimal compares two decimal strings.
+func cmpDecimal(a, b string) int {
+	x, _ := new(big.Rat).SetString(a)
+	y, _ := new(big.Rat).SetString(b)
+	if x == nil || y == nil {
+		return 0
+	}
+	return x.Cmp(y)
+}
+
+func (a *dayAggregate) add(trades []AggTrade) error {
+	for _, t := range trades {
+		if a.trades == 0 || t.TradeId < a.firstId {
+			a.firstId, a.first = t.TradeId, t.Price
+		}
+		if a.trades == 0 || t.TradeId > a.lastId {
+			a.lastId, a.last = t.TradeId, t.Price
+		}
+		if a.trades == 0 || cmpDecimal(t.Price, a.minPrice) < 0 {
+			a.minPrice = t.Price
+		}
+		if a.trades == 0 || cmpDecimal(t.Price, a.maxPrice) > 0 {
+			a.maxPrice = t.Price
+		}
+		quote, err := mulDecimal(t.Price, t.Quantity)
+		if err != nil {
+			return err
+		}
+		if err := a.volume.add(t.Quantity); err != nil {
+			return err
+		}
+		if err := a.quoteVol.add(quote); err != nil {
+			return err
+		}
+		a.trades++
+	}
+	return nil
+}
+
+func (a *dayAggregate) clone() *dayAggregate {
+	c := *a
+	c.volume.n.Set(&a.volume.n)
+	c.quoteVol.n.Set(&a.quoteVol.n)
+	return &c
+}
+
+func (a *dayAggregate) record(date string) []string {
+	return []string{date, strconv.FormatInt(a.trades, 10), a.first, a.last, a.minPrice, a.maxPrice, a.volume.String(), a.quoteVol.String()}
+}
+
+// addDaily adds a written page to the symbol's -daily-summary aggregates and
+// returns an undo that puts back the previous ones.
+func (f *symbolFiles) addDaily(grouped map[string][]AggTrade) (func(), error) {
+	if f.days == nil {
+		f.days = make(map[string]*dayAggregate)
+	}
+	saved := make(map[string]*dayAggregate, len(grouped))
+	undo := func() {
+		for date, a := range saved {
+			if a == nil {
+				delete(f.days, date)
+			} else {
+				f.days[date] = a
+			}
+		}
+	}
+	for date, trades := range grouped {
+		a, ok := f.days[date]
+		if ok {
+			saved[date] = a.clone()
+		} else {
+			saved[date] = nil
+			a = &dayAggregate{}
+			f.days[date] = a
+		}
+		if err := a.add(trades); err != nil {
+			undo()
+			return nil, err
+		}
+	}
+	return undo, nil
+}
+
+// writeDailySummary puts the finished date's row into <symbol>/index.csv.
+// A date this run only saw part of (it was started by an earlier run) is
+// computed again from its CSV files; other formats cannot be read back, so
+// such a date is left out of the index. The index is small and rewritten
+// whole, replacing an earlier row for the same date.
+func (s *fileSink) writeDailySummary(symbol, date string) {
+	f := s.files(symbol)
+	a := f.days[date]
+	delete(f.days, date)
+	var rows int64
+	for _, path := range datePartPaths(cfg.OutDir, symbol, date, s.ext) {
+		if r, ok := f.manifest.Files[filepath.Base(path)]; ok {
+			rows += r.Rows
+		}
+	}
+	if rows == 0 {
+		return
+	}
+	if a == nil || a.trades != rows {
+		if s.ext != ".csv" {
+			fmt.Printf("Skipping the daily summary of %s %s: part of it was written by an earlier run and %s files are not read back\n", symbol, date, s.ext)
+			return
+		}
+		a = &dayAggregate{}
+		for _, path := range datePartPaths(cfg.OutDir, symbol, date, s.ext) {
+			if _, err := readTradesCSV(path, a.add); err != nil {
+				fmt.Printf("Error reading %s for the daily summary, leaving %s out of the index: %v\n", path, date, err)
+				return
+			}
+		}
+	}
+	if err := putDailySummary(symbolPath(symbol, "index.csv"), a.record(date)); err != nil {
+		fmt.Printf("Error writing the daily summary of %s %s: %v\n", symbol, date, err)
+	}
+}
+
+// putDailySummary replaces or adds row (keyed by its date) in the index at
+// path, keeping the rows in date order.
+func putDailySummary(path string, row []string) error {
+	var rows [][]string
+	if in, err := os.Open(path); err == nil {
+		r := csv.NewReader(in)
+		r.FieldsPerRecord = -1
+		rows, err = r.ReadAll()
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if len(rows) > 0 {
+			rows = rows[1:] // 헤더
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	rows = slices.DeleteFunc(rows, func(r []string) bool { return len(r) > 0 && r[0] == row[0] })
+	rows = append(rows, row)
+	slices.SortFunc(rows, func(a, b []string) int { return cmp.Compare(a[0], b[0]) })
+
+	tmp := path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, cfg.FileMode.Perm())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // rename에 성공하면 이미 없음
+	w := newCSVWriter(out)
+	err = w.Write(dailySummaryHeader)
+	if err == nil {
+		err = writeAll(w, rows)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// symbolConfig is one entry of the -config file's per-symbol map, overriding
+// flags for that symbol only.
+type symbolConfig struct {
+	Format string `yaml:"format"`
+}
+
+// symbolFormats is the per-symbol format of the -config file, by symbol;
+// every other symbol is written in -format.
+var symbolFormats = map[string]string{}
+
+// setSymbolConfigs records the formats of the -config file's per-symbol
+// entries, once the flags they depend on (-normalize-symbols) are set.
+func setSymbolConfigs(entries map[string]symbolConfig) error {
+	for key, entry := range entries {
+		symbols, err := parseSymbols(key)
+		if err != nil {
+			return fmt.Errorf("per-symbol: %w", err)
+		}
+		for _, symbol := range symbols {
+			if entry.Format != "" {
+				symbolFormats[symbol] = entry.Format
+			}
+		}
+	}
+	return nil
+}
+
+// formatFor returns the format symbol is written in.
+func formatFor(symbol string) string {
+	if format, ok := symbolFormats[symbol]; ok {
+		return format
+	}
+	return cfg.Format
+}
+
+// usesFormat reports whether -format or any per-symbol format is format.
+func usesFormat(format string) bool {
+	if cfg.Format == format {
+		return true
+	}
+	for _, f := range symbolFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// overriddenFormat returns a symbol whose per-symbol format differs from
+// -format, for the errors of options that need one format throughout. ok is
+// false when there is none.
+func overriddenFormat() (symbol, format string, ok bool) {
+	symbols := make([]string, 0, len(symbolFormats))
+	for s, f := range symbolFormats {
+		if f != cfg.Format {
+			symbols = append(symbols, s)
+		}
+	}
+	if len(symbols) == 0 {
+		return "", "", false
+	}
+	sort.Strings(symbols)
+	return symbols[0], symbolFormats[symbols[0]], true
+}
+
+// newSymbolSinks creates the sinks of the per-symbol formats that differ from
+// -format, one per format shared by its symbols, and returns them by symbol.
+// Each format is validated against the other flags like -format is.
+func newSymbolSinks() (map[string]Sink, error) {
+	byFormat := make(map[string]Sink)
+	sinks := make(map[string]Sink)
+	symbols := make([]string, 0, len(symbolFormats))
+	for s := range symbolFormats {
+		symbols = append(symbols, s)
+	}
+	slices.Sort(symbols)
+	for _, symbol := range symbols {
+		format := symbolFormats[symbol]
+		if format == cfg.Format {
+			continue
+		}
+		sink, ok := byFormat[format]
+		if !ok {
+			var err error
+			if sink, err = newSink(format); err != nil {
+				return nil, fmt.Errorf("per-symbol format of %s: %w", symbol, err)
+			}
+			byFormat[format] = sink
+		}
+		sinks[symbol] = sink
+	}
+	return sinks, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type SymbolInfo struct {
+	Symbol     string         `json:"symbol"`
+	Status     string         `json:"status"`
+	BaseAsset  string         `json:"baseAsset"`
+	QuoteAsset string         `json:"quoteAsset"`
+	Filters    []symbolFilter `json:"filters"`
+}
+
+type exchangeInfo struct {
+	Symbols []SymbolInfo `json:"symbols"`
+}
+
+func fetchExchangeInfo() ([]SymbolInfo, error) {
+	req, err := http.NewRequest("GET", exchangeInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, body, done, err := doGzip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	defer done()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(body)
+		return nil, parseAPIError(resp.StatusCode, bodyBytes)
+	}
+
+	var info exchangeInfo
+	if err := json.NewDecoder(body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return info.Symbols, nil
+}
+
+// collectedSymbols returns the symbol directories of root that hold CSV
+// date files (or -trades-per-file chunks), plain or compressed, for
+// -resume-all. Other directories, such as empty ones or names that are not
+// symbols, are skipped.
+func collectedSymbols(root string) ([]string, error) {
+	dirs, err := listSymbolDirs(root)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []string
+	for _, dir := range dirs {
+		if !symbolPattern.MatchString(dir) {
+			continue
+		}
+		for _, suffix := range compressedSuffixes {
+			var files []string
+			if cfg.TradesPerFile > 0 {
+				files, err = listChunkPaths(root, dir, ".csv"+suffix)
+			} else {
+				files, err = listDateFilesIn(root, dir, ".csv"+suffix)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(files) > 0 {
+				symbols = append(symbols, dir)
+				break
+			}
+		}
+	}
+	return symbols, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9_.-]{1,20}$`)
+
+// parseSymbols splits a comma-separated symbol list. With -normalize-symbols
+// each symbol is trimmed and uppercased, since the API rejects lowercase
+// names; every symbol is then checked against the characters Binance allows.
+func parseSymbols(list string) ([]string, error) {
+	symbols := splitList(list)
+	for i, sym := range symbols {
+		if cfg.NormalizeSymbols {
+			if upper := strings.ToUpper(sym); upper != sym {
+				fmt.Printf("Normalized symbol %q to %s\n", sym, upper)
+				symbols[i] = upper
+			}
+		}
+		if !symbolPattern.MatchString(symbols[i]) {
+			return nil, fmt.Errorf("invalid symbol %q (want 1-20 of A-Z, 0-9, '-', '_', '.')", symbols[i])
+		}
+	}
+	return symbols, nil
+}
+
+// explicitSymbols returns the symbols named by -symbols-file, or by -symbols
+// when no file is given. The file lists symbols one per line or separated
+// by commas; text after '#' is a comment.
+func explicitSymbols() ([]string, error) {
+	if cfg.SymbolsFile == "" {
+		return parseSymbols(cfg.Symbols)
+	}
+	data, err := os.ReadFile(cfg.SymbolsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading -symbols-file: %w", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		lines = append(lines, line)
+	}
+	symbols, err := parseSymbols(strings.Join(lines, ","))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.SymbolsFile, err)
+	}
+	return symbols, nil
+}
+
+// resolveSymbols returns the explicit -symbols (or -symbols-file) list, or, when -quote or
+// -symbols-regex is given, the TRADING symbols from exchangeInfo that match
+// them, or with -resume-all the symbols already collected in -out. -exclude
+// is applied last in every case.
+func resolveSymbols() ([]string, error) {
+	var re *regexp.Regexp
+	if cfg.SymbolsRegex != "" {
+		var err error
+		if re, err = regexp.Compile(cfg.SymbolsRegex); err != nil {
+			return nil, fmt.Errorf("invalid -symbols-regex: %w", err)
+		}
+	}
+
+	symbols, err := explicitSymbols()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ResumeAll {
+		if symbols, err = collectedSymbols(cfg.OutDir); err != nil {
+			return nil, fmt.Errorf("-resume-all: %w", err)
+		}
+		fmt.Printf("Resuming %d symbol(s) found in %s\n", len(symbols), cfg.OutDir)
+	} else if re != nil || cfg.Quote != "" {
+		infos, err := fetchExchangeInfo()
+		if err != nil {
+			return nil, fmt.Errorf("fetching exchangeInfo: %w", err)
+		}
+		symbols = nil
+		for _, info := range infos {
+			if info.Status != "TRADING" {
+				continue
+			}
+			if cfg.Quote != "" && !strings.EqualFold(info.QuoteAsset, cfg.Quote) {
+				continue
+			}
+			if re != nil && !re.MatchString(info.Symbol) {
+				continue
+			}
+			symbols = append(symbols, info.Symbol)
+		}
+	}
+
+	excludeList, err := parseSymbols(cfg.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("-exclude: %w", err)
+	}
+	excluded := make(map[string]bool)
+	for _, sym := range excludeList {
+		excluded[sym] = true
+	}
+	selected := symbols[:0]
+	for _, sym := range symbols {
+		if !excluded[sym] {
+			selected = append(selected, sym)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no symbols selected")
+	}
+	return selected, nil
+}
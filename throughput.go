@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// throughputTracker counts API requests, bytes received and rows written per
+// minute of the run for -throughput-report.
+type throughputTracker struct {
+	mu      sync.Mutex
+	start   time.Time
+	minutes []throughputMinute
+}
+
+type throughputMinute struct {
+	requests, bytes, rows int64
+}
+
+var throughput = &throughputTracker{start: time.Now()}
+
+func (t *throughputTracker) add(requests, bytes, rows int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := int(time.Since(t.start) / time.Minute)
+	for len(t.minutes) <= i {
+		t.minutes = append(t.minutes, throughputMinute{})
+	}
+	m := &t.minutes[i]
+	m.requests += requests
+	m.bytes += bytes
+	m.rows += rows
+}
+
+// report prints totals, per-minute averages over the whole run and the
+// busiest minute of each counter.
+func (t *throughputTracker) report() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var total, peak throughputMinute
+	for _, m := range t.minutes {
+		total.requests += m.requests
+		total.bytes += m.bytes
+		total.rows += m.rows
+		peak.requests = max(peak.requests, m.requests)
+		peak.bytes = max(peak.bytes, m.bytes)
+		peak.rows = max(peak.rows, m.rows)
+	}
+	elapsed := time.Since(t.start)
+	minutes := max(elapsed.Minutes(), 1) // 1분 미만 실행은 1분으로
+	fmt.Printf("Throughput over %s:\n", elapsed.Round(time.Second))
+	fmt.Printf("  %-9s %12s %14s %14s\n", "", "total", "avg/minute", "peak minute")
+	fmt.Printf("  %-9s %12d %14.1f %14d\n", "requests", total.requests, float64(total.requests)/minutes, peak.requests)
+	fmt.Printf("  %-9s %12s %14s %14s\n", "MB", mb(total.bytes), mb(int64(float64(total.bytes)/minutes)), mb(peak.bytes))
+	fmt.Printf("  %-9s %12d %14.1f %14d\n", "rows", total.rows, float64(total.rows)/minutes, peak.rows)
+}
+
+func mb(n int64) string {
+	return fmt.Sprintf("%.2f", float64(n)/(1<<20))
+}
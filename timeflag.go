@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFlag is a flag.Value accepting RFC3339, "2006-01-02T15:04",
+// "2006-01-02" (all UTC unless an offset is given) or unix milliseconds.
+type timeFlag struct {
+	time.Time
+}
+
+var timeFlagLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+func (t *timeFlag) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (t *timeFlag) Set(s string) error {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		t.Time = time.UnixMilli(ms).UTC()
+		return nil
+	}
+	for _, layout := range timeFlagLayouts {
+		if v, err := time.Parse(layout, s); err == nil {
+			t.Time = v.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time %q (want RFC3339, YYYY-MM-DD or unix millis)", s)
+}
+
+// timestampFormats are the -timestamp-format values for the timestamp column.
+var timestampFormats = []string{"millis", "seconds", "iso8601", "unix-nanos"}
+
+const isoMillis = "2006-01-02T15:04:05.000Z07:00"
+
+// formatTimestamp renders a trade's millisecond timestamp as
+// -timestamp-format asks: seconds keep the milliseconds as a fraction and
+// iso8601 is RFC3339 with milliseconds in -tz.
+func formatTimestamp(ms int64) string {
+	switch cfg.TimestampFormat {
+	case "seconds":
+		return fmt.Sprintf("%d.%03d", ms/1000, ms%1000)
+	case "iso8601":
+		return time.UnixMilli(ms).In(cfg.Location).Format(isoMillis)
+	case "unix-nanos":
+		return strconv.FormatInt(ms*int64(time.Millisecond), 10)
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+// parseTimestamp reads a timestamp column written in any
+// -timestamp-format, telling them apart by shape: RFC3339, a decimal point
+// (seconds), 19 digits (nanoseconds) or otherwise milliseconds.
+func parseTimestamp(s string) (int64, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UnixMilli(), nil
+	}
+	if sec, frac, ok := strings.Cut(s, "."); ok {
+		whole, err1 := strconv.ParseInt(sec, 10, 64)
+		ms, err2 := strconv.ParseInt((frac + "000")[:3], 10, 64)
+		if err1 != nil || err2 != nil {
+			return 0, fmt.Errorf("bad timestamp %q", s)
+		}
+		return whole*1000 + ms, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad timestamp %q", s)
+	}
+	if len(s) >= 19 {
+		return n / int64(time.Millisecond), nil
+	}
+	return n, nil
+}
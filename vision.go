@@ -0,0 +1,320 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultVisionURL is where Binance publishes its daily and monthly dumps.
+const defaultVisionURL = "https://data.binance.vision"
+
+// visionClient downloads the dump ZIPs, which can take far longer than
+// httpClient's timeout for a single API page.
+var visionClient = &http.Client{Transport: httpTransport}
+
+// errNotPublished means the dump of a day or month is not (yet) available.
+var errNotPublished = errors.New("not published")
+
+// collectVision is the -source=vision fast path of a forward collection. It
+// reads the symbol's trades from fromId on out of the daily and monthly
+// aggTrades dumps, writing them like API pages, and returns the fromId the
+// API continues from: after the last published day, before the day of end,
+// or wherever a dump is missing, fails its CHECKSUM or has a gap in the ids.
+func (c *Collector) collectVision(ctx context.Context, symbol string, fromId int64, end time.Time, index *rangeIndex, done *manifest) (int64, error) {
+	c.limiter.Wait(aggTradesWeight(1))
+	first, err := fetchAggTrades(symbol, url.Values{"fromId": {strconv.FormatInt(fromId, 10)}, "limit": {"1"}})
+	if err != nil {
+		return fromId, fmt.Errorf("finding the first trade to read from the dumps: %w", err)
+	}
+	if len(first) == 0 {
+		return fromId, nil
+	}
+	day := time.UnixMilli(first[0].Timestamp).UTC().Truncate(24 * time.Hour) // 덤프는 UTC 날짜별
+	stop := time.Now().UTC().Truncate(24 * time.Hour)                        // 오늘 것은 아직 없음
+	if endDay := end.UTC().Truncate(24 * time.Hour); !end.IsZero() && endDay.Before(stop) {
+		stop = endDay // 끝나는 날은 API로
+	}
+
+	v := visionRun{c: c, symbol: symbol, fromId: fromId, index: index, done: done}
+	for day.Before(stop) {
+		if ctx.Err() != nil {
+			return v.fromId, errAborted
+		}
+		waitWhilePaused(ctx, symbol)
+		if err := checkDiskSpace(); err != nil {
+			return v.fromId, err
+		}
+		monthEnd := day.AddDate(0, 1, 0)
+		monthly := day.Day() == 1 && !monthEnd.After(stop) // 한 달 전체가 필요하면 월별 덤프
+		name, next := visionDayName(symbol, day), day.AddDate(0, 0, 1)
+		if monthly {
+			name, next = visionMonthName(symbol, day), monthEnd
+		}
+		err := v.readDump(ctx, name)
+		if errors.Is(err, errNotPublished) && monthly {
+			fmt.Printf("%s %s is not published, reading its days\n", symbol, name)
+			name, next = visionDayName(symbol, day), day.AddDate(0, 0, 1)
+			err = v.readDump(ctx, name)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return v.fromId, errAborted
+			}
+			fmt.Printf("Stopped reading %s from %s at fromId(%d): %v\n", symbol, name, v.fromId, err)
+			break
+		}
+		day = next
+	}
+
+	// 덤프가 끝난 시각(day) 전에 끝나는 마지막 날짜는 API 구간이 이어 쓰지 않으므로 여기서 완료
+	if last := v.days.current; last != "" {
+		lastDay, _ := time.ParseInLocation("2006-01-02", last, time.UTC)
+		if !nextDay(midnight(lastDay.Date())).After(day) {
+			c.persist(symbol, nil, func() { c.finishDay(symbol, last) })
+		}
+	}
+	if v.read > 0 {
+		fmt.Printf("Read %d trades of %s from %s, continuing from the API at fromId(%d)\n", v.read, symbol, cfg.VisionURL, v.fromId)
+	}
+	return v.fromId, nil
+}
+
+func visionDayName(symbol string, day time.Time) string {
+	return fmt.Sprintf("daily/aggTrades/%s/%s-aggTrades-%s.zip", symbol, symbol, day.Format("2006-01-02"))
+}
+
+func visionMonthName(symbol string, month time.Time) string {
+	return fmt.Sprintf("monthly/aggTrades/%s/%s-aggTrades-%s.zip", symbol, symbol, month.Format("2006-01"))
+}
+
+// visionRun is the state of one symbol's pass over the dumps.
+type visionRun struct {
+	c      *Collector
+	symbol string
+	fromId int64
+	index  *rangeIndex
+	done   *manifest
+	days   dayTracker
+	read   int64
+}
+
+// readDump downloads one dump, checks it against its CHECKSUM file and
+// writes its trades from fromId on, in pages of limitPerReq.
+func (v *visionRun) readDump(ctx context.Context, name string) error {
+	path, err := downloadVision(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	if len(zr.File) != 1 {
+		return fmt.Errorf("%s has %d files, want one CSV", name, len(zr.File))
+	}
+	f, err := zr.File[0].Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	debugf("%s: reading %s\n", v.symbol, name)
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	page := make([]AggTrade, 0, limitPerReq)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		line, _ := r.FieldPos(0)
+		trade, ok, err := parseVisionRecord(record, line)
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+		if !ok || trade.TradeId < v.fromId {
+			continue // 헤더, 이미 있는 거래
+		}
+		want := v.fromId
+		if len(page) > 0 {
+			want = page[len(page)-1].TradeId + 1
+		}
+		if trade.TradeId != want && (want > 0 || v.read > 0) {
+			if err := v.write(page); err != nil {
+				return err
+			}
+			return fmt.Errorf("ids jump from %d to %d", want-1, trade.TradeId)
+		}
+		page = append(page, trade)
+		if len(page) == limitPerReq {
+			if err := v.write(page); err != nil {
+				return err
+			}
+			page = page[:0]
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+	}
+	return v.write(page)
+}
+
+// write stores one page read from a dump the way collectFrom stores an API
+// page, advancing fromId.
+func (v *visionRun) write(page []AggTrade) error {
+	if len(page) == 0 {
+		return nil
+	}
+	page = append([]AggTrade(nil), page...)
+	progress.fetched(v.symbol, v.fromId, len(page))
+	trades := page
+	if v.index != nil {
+		trades = v.index.uncovered(trades)
+	}
+	if v.done != nil {
+		trades = filterTrades(trades, func(t AggTrade) bool { return !v.done.Complete[tradeDate(t)] })
+	}
+	pageFrom, lastTrade := v.fromId, page[len(page)-1]
+	err := v.c.persist(v.symbol, trades, func() {
+		progress.written(v.symbol, pageFrom, tradeDate(lastTrade), len(trades))
+		for _, date := range v.days.observe(tradeDates(trades)) {
+			v.c.finishDay(v.symbol, date)
+		}
+		if v.index != nil {
+			v.index.add(page[0].TradeId, lastTrade.TradeId)
+			if err := v.index.save(); err != nil {
+				fmt.Printf("Error saving range index for %s: %v\n", v.symbol, err)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	v.fromId = lastTrade.TradeId + 1
+	v.read += int64(len(page))
+	return nil
+}
+
+// parseVisionRecord reads one row of an aggTrades dump: id, price,
+// quantity, first and last trade id, time, buyer-maker and best-match. The
+// time is in milliseconds, or microseconds in dumps from 2025 on; older
+// dumps leave out best-match. ok is false for the header some dumps start
+// with, which is only accepted on line 1.
+func parseVisionRecord(record []string, line int) (trade AggTrade, ok bool, err error) {
+	id, err := strconv.ParseInt(record[0], 10, 64)
+	if err != nil && line == 1 {
+		return trade, false, nil
+	}
+	if len(record) < 7 {
+		return trade, false, fmt.Errorf("%d fields, want 7 or 8", len(record))
+	}
+	if err != nil {
+		return trade, false, fmt.Errorf("bad tradeId %q", record[0])
+	}
+	trade = AggTrade{TradeId: id, Price: record[1], Quantity: record[2]}
+	if trade.FirstId, err = strconv.ParseInt(record[3], 10, 64); err == nil {
+		trade.LastId, err = strconv.ParseInt(record[4], 10, 64)
+	}
+	if err == nil {
+		trade.Timestamp, err = strconv.ParseInt(record[5], 10, 64)
+	}
+	if err != nil {
+		return trade, false, fmt.Errorf("bad row %q", strings.Join(record, ","))
+	}
+	if trade.Timestamp > 1e14 {
+		trade.Timestamp /= 1000 // 마이크로초
+	}
+	trade.IsMaker = strings.EqualFold(record[6], "true")
+	trade.IsBest = len(record) > 7 && strings.EqualFold(record[7], "true")
+	return trade, true, nil
+}
+
+// downloadVision saves data/spot/<name> to a temporary file in -out and
+// checks its SHA-256 against <name>.CHECKSUM. errNotPublished is returned
+// for a 404.
+func downloadVision(ctx context.Context, name string) (string, error) {
+	base := strings.TrimRight(cfg.VisionURL, "/") + "/data/spot/" + name
+	sum, err := fetchVisionChecksum(ctx, base+".CHECKSUM")
+	if err != nil {
+		return "", err
+	}
+	body, err := getVision(ctx, base)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	tmp, err := os.CreateTemp(cfg.OutDir, ".vision-*.zip")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != sum {
+		err = fmt.Errorf("%s does not match its CHECKSUM", name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	transferStats.wire.Add(n)
+	transferStats.decoded.Add(n)
+	return tmp.Name(), nil
+}
+
+func fetchVisionChecksum(ctx context.Context, u string) (string, error) {
+	body, err := getVision(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, 1024))
+	if err != nil {
+		return "", err
+	}
+	sum, _, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	if len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("unexpected CHECKSUM file %q", data)
+	}
+	return strings.ToLower(sum), nil
+}
+
+func getVision(ctx context.Context, u string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := visionClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound, http.StatusForbidden: // S3는 없는 키에 403을 주기도 함
+		resp.Body.Close()
+		return nil, errNotPublished
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVisionRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     string
+		line    int
+		want    AggTrade
+		ok      bool
+		wantErr string
+	}{
+		{"2025 microseconds", "3000000000,42000.01,0.5,4000000000,4000000002,1735689600123456,true,true", 5,
+			AggTrade{TradeId: 3000000000, Price: "42000.01", Quantity: "0.5", FirstId: 4000000000, LastId: 4000000002, Timestamp: 1735689600123, IsMaker: true, IsBest: true}, true, ""},
+		{"milliseconds", "7,1.5,2,10,11,1699920000000,False,True", 2,
+			AggTrade{TradeId: 7, Price: "1.5", Quantity: "2", FirstId: 10, LastId: 11, Timestamp: 1699920000000, IsBest: true}, true, ""},
+		{"no best-match", "7,1.5,2,10,11,1699920000000,True", 2,
+			AggTrade{TradeId: 7, Price: "1.5", Quantity: "2", FirstId: 10, LastId: 11, Timestamp: 1699920000000, IsMaker: true}, true, ""},
+		{"header on line 1", "agg_trade_id,price,quantity,first_trade_id,last_trade_id,transact_time,is_buyer_maker,is_best_match", 1, AggTrade{}, false, ""},
+		{"short header on line 1", "agg_trade_id,price", 1, AggTrade{}, false, ""},
+		{"header past line 1", "agg_trade_id,price,quantity,first_trade_id,last_trade_id,transact_time,is_buyer_maker,is_best_match", 2, AggTrade{}, false, `bad tradeId "agg_trade_id"`},
+		{"garbage id", "x7,1.5,2,10,11,1699920000000,true", 3, AggTrade{}, false, `bad tradeId "x7"`},
+		{"too few fields", "7,1.5,2,10,11,1699920000000", 3, AggTrade{}, false, "6 fields, want 7 or 8"},
+		{"too few fields on line 1", "7,1.5", 1, AggTrade{}, false, "2 fields, want 7 or 8"},
+		{"bad first id", "7,1.5,2,x,11,1699920000000,true", 3, AggTrade{}, false, "bad row"},
+		{"bad time", "7,1.5,2,10,11,yesterday,true", 1, AggTrade{}, false, "bad row"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := parseVisionRecord(strings.Split(tt.row, ","), tt.line)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("got %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
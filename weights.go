@@ -0,0 +1,96 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// weightRule is the request weight of an endpoint for limit values up to
+// maxLimit, or for any limit when maxLimit is 0.
+type weightRule struct {
+	endpoint string
+	maxLimit int
+	weight   int
+}
+
+// defaultWeights are the REQUEST_WEIGHT costs documented for the spot
+// endpoints the collector calls. For the tickers of -snapshots, limit is the
+// number of symbols requested.
+var defaultWeights = []weightRule{
+	{"aggTrades", 0, 4},
+	{"klines", 0, 2},
+	{"exchangeInfo", 0, 20},
+	{"ticker/bookTicker", 1, 2},
+	{"ticker/bookTicker", 0, 4},
+	{"ticker/24hr", 20, 2},
+	{"ticker/24hr", 100, 40},
+	{"ticker/24hr", 0, 80},
+	{"ping", 0, 1},
+	{"time", 0, 1},
+}
+
+// weights is the -exchange weights (defaultWeights, normally) with -weights
+// overrides in front.
+var weights = defaultWeights
+
+// requestWeight returns the weight of one request to endpoint with this
+// limit. Unknown endpoints cost 1.
+func requestWeight(endpoint string, limit int) int {
+	for _, r := range weights {
+		if r.endpoint == endpoint && (r.maxLimit == 0 || limit <= r.maxLimit) {
+			return r.weight
+		}
+	}
+	return 1
+}
+
+// parseWeights parses -weights, "endpoint=weight" or
+// "endpoint:maxLimit=weight" separated by commas, into rules that take
+// precedence over the -exchange weights. Narrower limit bands are matched first.
+func parseWeights(s string) ([]weightRule, error) {
+	var rules []weightRule
+	for item := range strings.SplitSeq(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		weight, err := strconv.Atoi(value)
+		if !ok || err != nil || weight < 1 {
+			return nil, fmt.Errorf("invalid -weights entry %q (want endpoint=weight or endpoint:maxLimit=weight)", item)
+		}
+		r := weightRule{endpoint: key, weight: weight}
+		if endpoint, limit, ok := strings.Cut(key, ":"); ok {
+			r.endpoint = endpoint
+			if r.maxLimit, err = strconv.Atoi(limit); err != nil || r.maxLimit < 1 {
+				return nil, fmt.Errorf("invalid limit in -weights entry %q", item)
+			}
+		}
+		rules = append(rules, r)
+	}
+	slices.SortStableFunc(rules, func(a, b weightRule) int {
+		if (a.maxLimit == 0) != (b.maxLimit == 0) {
+			return cmp.Compare(b.maxLimit, a.maxLimit) // 0(모든 limit)은 마지막
+		}
+		return cmp.Compare(a.maxLimit, b.maxLimit)
+	})
+	return append(rules, exchange.weights...), nil
+}
+
+// aggTradesWeight is the weight of one aggTrades request with this limit.
+func aggTradesWeight(limit int) int {
+	return requestWeight("aggTrades", limit)
+}
+
+// weightBudget is the request weight allowed per minute: -weight-limit (or
+// the -exchange budget when -rate is not set either), or else -rate aggTrades
+// pages worth of weight.
+func weightBudget() int {
+	if cfg.WeightLimit > 0 {
+		return cfg.WeightLimit
+	}
+	return cfg.Rate * aggTradesWeight(limitPerReq)
+}
@@ -0,0 +1,59 @@
+package main
+
+import "time"
+
+// collectWindow returns the [start, end) range that -start-time and
+// -end-time limit collection to; a zero time leaves that side open. With
+// -align-days both edges are widened to midnight in -tz, so the first and
+// last date files of the window hold whole days.
+func collectWindow() (start, end time.Time) {
+	start, end = cfg.StartTime.Time, cfg.EndTime.Time
+	if !cfg.AlignDays {
+		return start, end
+	}
+	if !start.IsZero() {
+		start = startOfDay(start)
+	}
+	if !end.IsZero() {
+		if day := startOfDay(end); !day.Equal(end) {
+			end = nextDay(day)
+		}
+	}
+	return start, end
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.In(cfg.Location).Date()
+	return midnight(y, m, d)
+}
+
+// nextDay is the start of the date after day's in -tz. Days are 23 or 25
+// hours long across a DST change, so it is not day plus 24 hours.
+func nextDay(day time.Time) time.Time {
+	y, m, d := day.In(cfg.Location).Date()
+	return midnight(y, m, d+1)
+}
+
+// midnight is the first instant of the date in -tz. Where DST starts at
+// midnight (America/Santiago, America/Havana, ...) 00:00 does not exist and
+// time.Date lands on 23:00 of the day before; the date then begins at the
+// transition instead.
+func midnight(y int, m time.Month, d int) time.Time {
+	y, m, d = time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Date() // d+1 정규화
+	t := time.Date(y, m, d, 0, 0, 0, 0, cfg.Location)
+	if t.Day() != d {
+		_, t = t.ZoneBounds()
+	}
+	return t
+}
+
+// tradesBeforeTime keeps the trades with a timestamp before endMs; pages are
+// in timestamp order.
+func tradesBeforeTime(trades []AggTrade, endMs int64) []AggTrade {
+	for i, trade := range trades {
+		if trade.Timestamp >= endMs {
+			return trades[:i]
+		}
+	}
+	return trades
+}
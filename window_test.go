@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// mustLocation loads a -tz zone, skipping the test where tzdata is missing.
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip(err)
+	}
+	return loc
+}
+
+func TestCollectWindowAlignDays(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	utc := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+	tests := []struct {
+		name       string
+		tz         string
+		align      bool
+		start, end string
+		wantStart  string
+		wantEnd    string
+	}{
+		{"unaligned", "UTC", false, "2024-03-10T13:45:00Z", "2024-03-12T02:00:00Z", "2024-03-10T13:45:00Z", "2024-03-12T02:00:00Z"},
+		{"widened to midnight", "UTC", true, "2024-03-10T13:45:00Z", "2024-03-12T02:00:00Z", "2024-03-10T00:00:00Z", "2024-03-13T00:00:00Z"},
+		{"already at midnight", "UTC", true, "2024-03-10T00:00:00Z", "2024-03-12T00:00:00Z", "2024-03-10T00:00:00Z", "2024-03-12T00:00:00Z"},
+		{"a millisecond before midnight", "UTC", true, "2024-03-10T23:59:59.999Z", "2024-03-11T23:59:59.999Z", "2024-03-10T00:00:00Z", "2024-03-12T00:00:00Z"},
+		{"a millisecond after midnight", "UTC", true, "2024-03-10T00:00:00.001Z", "2024-03-11T00:00:00.001Z", "2024-03-10T00:00:00Z", "2024-03-12T00:00:00Z"},
+		{"midnight in -tz", "Asia/Seoul", true, "2024-03-10T13:45:00Z", "2024-03-11T14:00:00Z", "2024-03-09T15:00:00Z", "2024-03-11T15:00:00Z"},
+		{"UTC midnight is not -tz midnight", "Asia/Seoul", true, "2024-03-10T00:00:00Z", "2024-03-11T00:00:00Z", "2024-03-09T15:00:00Z", "2024-03-11T15:00:00Z"},
+		{"open end", "UTC", true, "2024-03-10T13:45:00Z", "", "2024-03-10T00:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Location, cfg.AlignDays = mustLocation(t, tt.tz), tt.align
+			cfg.StartTime.Time, cfg.EndTime.Time = utc(tt.start), utc(tt.end)
+			start, end := collectWindow()
+			if !start.Equal(utc(tt.wantStart)) || !end.Equal(utc(tt.wantEnd)) {
+				t.Errorf("window [%s, %s), want [%s, %s)", start.UTC().Format(time.RFC3339Nano), end.UTC().Format(time.RFC3339Nano), tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestTradesBeforeMidnight(t *testing.T) {
+	midnight := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC).UnixMilli()
+	page := []AggTrade{
+		{TradeId: 1, Timestamp: midnight - 1000},
+		{TradeId: 2, Timestamp: midnight - 1},
+		{TradeId: 3, Timestamp: midnight},
+		{TradeId: 4, Timestamp: midnight + 1},
+	}
+	tests := []struct {
+		endMs int64
+		want  int
+	}{
+		{midnight - 1000, 0},
+		{midnight, 2}, // 자정 거래는 다음 날짜
+		{midnight + 1, 3},
+		{midnight + 2, 4},
+	}
+	for _, tt := range tests {
+		if got := tradesBeforeTime(page, tt.endMs); len(got) != tt.want {
+			t.Errorf("tradesBeforeTime(end %+d ms from midnight) kept %d trades, want %d", tt.endMs-midnight, len(got), tt.want)
+		}
+	}
+}
+
+func TestAlignedDaysHoldWholeDates(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Location, cfg.AlignDays = time.UTC, true
+	cfg.StartTime.Time = time.Date(2024, 3, 10, 13, 45, 0, 0, time.UTC)
+	cfg.EndTime.Time = time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC)
+	start, end := collectWindow()
+	var trades []AggTrade
+	for ms := start.UnixMilli() - 60000; ms < end.UnixMilli()+60000; ms += 60000 {
+		trades = append(trades, AggTrade{TradeId: int64(len(trades)), Timestamp: ms})
+	}
+	var kept []AggTrade
+	for _, trade := range tradesBeforeTime(trades, end.UnixMilli()) {
+		if trade.Timestamp >= start.UnixMilli() {
+			kept = append(kept, trade)
+		}
+	}
+	grouped := groupTradesByDate(kept)
+	for date, want := range map[string]int{"2024-03-10": 1440, "2024-03-11": 1440} {
+		if got := len(grouped[date]); got != want {
+			t.Errorf("%s holds %d one-minute trades, want %d", date, got, want)
+		}
+	}
+	if len(grouped) != 2 {
+		t.Errorf("trades fall on %d dates, want 2", len(grouped))
+	}
+}
+
+func TestDSTDayBounds(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	tests := []struct {
+		tz, date  string
+		wantStart string // RFC3339, 그 날의 첫 순간
+		hours     int
+	}{
+		{"America/New_York", "2024-03-09", "2024-03-09T00:00:00-05:00", 24},
+		{"America/New_York", "2024-03-10", "2024-03-10T00:00:00-05:00", 23}, // 02:00 EST -> 03:00 EDT
+		{"America/New_York", "2024-03-11", "2024-03-11T00:00:00-04:00", 24},
+		{"America/New_York", "2024-11-03", "2024-11-03T00:00:00-04:00", 25}, // 02:00 EDT -> 01:00 EST
+		{"America/New_York", "2024-11-04", "2024-11-04T00:00:00-05:00", 24},
+		{"America/Santiago", "2024-09-08", "2024-09-08T01:00:00-03:00", 23}, // 00:00 없음
+		{"America/Santiago", "2024-04-06", "2024-04-06T00:00:00-03:00", 25}, // 자정이 23:00으로 되돌아감
+	}
+	for _, tt := range tests {
+		t.Run(tt.tz+"/"+tt.date, func(t *testing.T) {
+			cfg.Location = mustLocation(t, tt.tz)
+			day, _ := time.Parse("2006-01-02", tt.date)
+			start := midnight(day.Date())
+			want, _ := time.Parse(time.RFC3339, tt.wantStart)
+			if !start.Equal(want) {
+				t.Errorf("midnight = %s, want %s", start.Format(time.RFC3339), tt.wantStart)
+			}
+			if got := startOfDay(start.Add(12 * time.Hour)); !got.Equal(start) {
+				t.Errorf("startOfDay(noon) = %s, want %s", got.Format(time.RFC3339), tt.wantStart)
+			}
+			end := nextDay(start)
+			if got := end.Sub(start); got != time.Duration(tt.hours)*time.Hour {
+				t.Errorf("day lasts %v, want %dh", got, tt.hours)
+			}
+			if got := tradeDate(AggTrade{Timestamp: end.UnixMilli() - 1}); got != tt.date {
+				t.Errorf("last millisecond of the day is dated %s", got)
+			}
+			if got := tradeDate(AggTrade{Timestamp: end.UnixMilli()}); got == tt.date {
+				t.Errorf("next day's first millisecond is dated %s", got)
+			}
+		})
+	}
+}
+
+func TestGroupTradesByDateDST(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Location, cfg.MinDate, cfg.MaxDate = mustLocation(t, "America/New_York"), "", ""
+	tests := []struct {
+		name  string
+		dates []string // 거래가 있는 지역 날짜, 모두 온전한 하루
+		want  map[string]int
+		local map[string]string // 지역 시각 -> 날짜 (DST 전환 직전/직후)
+	}{
+		{"spring forward", []string{"2024-03-09", "2024-03-10", "2024-03-11"},
+			map[string]int{"2024-03-09": 24 * 4, "2024-03-10": 23 * 4, "2024-03-11": 24 * 4},
+			map[string]string{"2024-03-10T01:45:00-05:00": "2024-03-10", "2024-03-10T03:00:00-04:00": "2024-03-10", "2024-03-10T23:45:00-04:00": "2024-03-10"}},
+		{"fall back", []string{"2024-11-02", "2024-11-03", "2024-11-04"},
+			map[string]int{"2024-11-02": 24 * 4, "2024-11-03": 25 * 4, "2024-11-04": 24 * 4},
+			map[string]string{"2024-11-03T01:30:00-04:00": "2024-11-03", "2024-11-03T01:30:00-05:00": "2024-11-03", "2024-11-03T23:45:00-05:00": "2024-11-03"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, _ := time.Parse("2006-01-02", tt.dates[0])
+			last, _ := time.Parse("2006-01-02", tt.dates[len(tt.dates)-1])
+			start, end := midnight(first.Date()), nextDay(midnight(last.Date()))
+			// 15분마다 거래 하나, 중복이나 빈 시간 없이
+			var trades []AggTrade
+			for ts := start; ts.Before(end); ts = ts.Add(15 * time.Minute) {
+				trades = append(trades, AggTrade{TradeId: int64(len(trades)), Timestamp: ts.UnixMilli()})
+			}
+			grouped := groupTradesByDate(trades)
+			if len(grouped) != len(tt.want) {
+				t.Errorf("trades fall on %d dates, want %d", len(grouped), len(tt.want))
+			}
+			for date, want := range tt.want {
+				if got := len(grouped[date]); got != want {
+					t.Errorf("%s holds %d quarter-hour trades, want %d", date, got, want)
+				}
+			}
+			for local, date := range tt.local {
+				ts, _ := time.Parse(time.RFC3339, local)
+				if got := tradeDate(AggTrade{Timestamp: ts.UnixMilli()}); got != date {
+					t.Errorf("a trade at %s is dated %s, want %s", local, got, date)
+				}
+			}
+		})
+	}
+}
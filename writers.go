@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const writeQueueDepth = 8
+
+// errPageLost is wrapped by the error a symbol stops with when its writer
+// gave up on one of its pages (-write-concurrency).
+var errPageLost = errors.New("queued page not written")
+
+type writeJob struct {
+	symbol string
+	trades []AggTrade
+	after  func()
+}
+
+// writerPool persists pages off the fetch goroutines. Every symbol is bound
+// to one writer, so its pages are written, and its checkpoints advanced, in
+// fetch order; different symbols are written in parallel.
+type writerPool struct {
+	ctx    context.Context
+	c      *Collector
+	queues []chan writeJob
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	symbols map[string]*symbolWrites
+}
+
+// symbolWrites tracks one symbol's queued pages and the error its writer
+// gave up with. Once a page is lost the symbol's later pages are dropped
+// too, so its checkpoints never advance past the missing page.
+type symbolWrites struct {
+	queued sync.WaitGroup
+	err    error
+}
+
+func newWriterPool(ctx context.Context, c *Collector, n int) *writerPool {
+	p := &writerPool{ctx: ctx, c: c, queues: make([]chan writeJob, n), symbols: make(map[string]*symbolWrites)}
+	for i := range p.queues {
+		p.queues[i] = make(chan writeJob, writeQueueDepth)
+		p.wg.Add(1)
+		go p.run(p.queues[i])
+	}
+	return p
+}
+
+func (p *writerPool) symbol(name string) *symbolWrites {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sw, ok := p.symbols[name]
+	if !ok {
+		sw = &symbolWrites{}
+		p.symbols[name] = sw
+	}
+	return sw
+}
+
+// enqueue queues a page for the symbol's writer, or returns the error the
+// writer gave up on an earlier page with.
+func (p *writerPool) enqueue(job writeJob) error {
+	sw := p.symbol(job.symbol)
+	if err := p.failed(sw); err != nil {
+		return err
+	}
+	sw.queued.Add(1)
+	h := fnv.New32a()
+	h.Write([]byte(job.symbol))
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- job
+	return nil
+}
+
+func (p *writerPool) failed(sw *symbolWrites) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return sw.err
+}
+
+// wait blocks until the symbol's queued pages are written and returns the
+// error its writer gave up with, if any.
+func (p *writerPool) wait(symbol string) error {
+	sw := p.symbol(symbol)
+	sw.queued.Wait()
+	return p.failed(sw)
+}
+
+func (p *writerPool) run(queue chan writeJob) {
+	defer p.wg.Done()
+	for job := range queue {
+		sw := p.symbol(job.symbol)
+		if err := p.write(sw, job); err != nil {
+			fmt.Printf("Dropping the queued pages of %s: %v\n", job.symbol, err)
+			p.mu.Lock()
+			sw.err = err
+			p.mu.Unlock()
+		}
+		sw.queued.Done()
+	}
+}
+
+// write saves one job the way persist does inline: a failed page is retried
+// every 5 seconds until saveFailed gives up on it or ctx is canceled, and a
+// panic fails just this symbol. after runs only once the page is stored.
+func (p *writerPool) write(sw *symbolWrites, job writeJob) error {
+	if err := p.failed(sw); err != nil {
+		return nil // 앞 페이지를 잃음: 이미 기록됨
+	}
+	for fails := 0; ; {
+		err := runIsolated(job.symbol, func() error { return p.c.savePage(job.symbol, job.trades) })
+		if err == nil {
+			job.after()
+			return nil
+		}
+		var perr *panicError
+		if errors.As(err, &perr) {
+			return fmt.Errorf("%w: %w", errPageLost, err)
+		}
+		if serr := saveFailed(&fails, err); serr != nil {
+			return fmt.Errorf("%w: %w", errPageLost, serr)
+		}
+		if p.ctx.Err() != nil {
+			return fmt.Errorf("%w: stopped retrying: %w", errPageLost, err)
+		}
+		fmt.Printf("Error saving page for %s, retrying: %v\n", job.symbol, err)
+		retryDelay(p.ctx, job.symbol, 5*time.Second)
+	}
+}
+
+// close waits for every queued page to be written or given up on.
+func (p *writerPool) close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// funcSink is a Sink that hands every date group to write.
+type funcSink func(symbol, date string, trades []AggTrade) error
+
+func (s funcSink) Write(symbol, date string, trades []AggTrade) error { return s(symbol, date, trades) }
+func (s funcSink) Close() error                                       { return nil }
+
+func TestWriterPoolGivesUp(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	cfg.Location, cfg.MaxStuck = time.UTC, 1
+	tests := []struct {
+		name    string
+		err     func() error // nil: panic
+		cancel  bool
+		wantErr bool
+	}{
+		{"stored", func() error { return nil }, false, false},
+		{"permanent error", func() error { return fmt.Errorf("open: %w", os.ErrPermission) }, false, true},
+		{"panic", nil, false, true},
+		{"transient error after cancel", func() error { return syscall.EIO }, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			c := NewCollector(noLimit{})
+			c.RegisterSink(funcSink(func(string, string, []AggTrade) error {
+				if tt.err == nil {
+					panic("sink bug")
+				}
+				return tt.err()
+			}))
+			p := newWriterPool(ctx, c, 1)
+			var mu sync.Mutex
+			var afters []int64
+			enqueued := 0
+			for _, id := range []int64{0, 1, 2} {
+				err := p.enqueue(writeJob{symbol: "BTCUSDT", trades: []AggTrade{testTrade(id)}, after: func() {
+					mu.Lock()
+					afters = append(afters, id)
+					mu.Unlock()
+				}})
+				if err != nil {
+					break
+				}
+				enqueued++
+				if tt.wantErr {
+					p.wait("BTCUSDT") // 다음 enqueue가 에러를 받음
+				}
+			}
+
+			closed := make(chan error, 1)
+			go func() {
+				err := p.wait("BTCUSDT")
+				p.close()
+				closed <- err
+			}()
+			var err error
+			select {
+			case err = <-closed:
+			case <-time.After(10 * time.Second):
+				t.Fatal("the writer pool did not finish")
+			}
+			if tt.wantErr != (err != nil) || err != nil && !errors.Is(err, errPageLost) {
+				t.Fatalf("wait = %v, want errPageLost %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if enqueued != 1 || len(afters) != 0 {
+					t.Errorf("%d pages queued and %v checkpointed after a lost page, want 1 and none", enqueued, afters)
+				}
+				if serr := saveFailed(new(int), err); serr == nil {
+					t.Error("saveFailed retries a lost page")
+				}
+			} else if !slices.Equal(afters, []int64{0, 1, 2}) {
+				t.Errorf("checkpoints ran for %v, want [0 1 2]", afters)
+			}
+		})
+	}
+}
+
+// TestWriteConcurrencyFailsSymbol runs a symbol whose writer cannot store
+// its first page: the symbol stops with errPageLost instead of fetching on.
+func TestWriteConcurrencyFailsSymbol(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	writeDateFiles(t, nil)
+	cfg.Location, cfg.Format, cfg.MaxStuck, cfg.WriteConcurrency = time.UTC, "csv", 1, 1
+	requests := servePages(t, func(from int64) []int64 {
+		if from >= 1_000_000 {
+			return nil
+		}
+		return []int64{from, from + 1, from + 2}
+	})
+	c := NewCollector(noLimit{})
+	c.RegisterSink(funcSink(func(string, string, []AggTrade) error {
+		return fmt.Errorf("open: %w", os.ErrPermission)
+	}))
+	done := make(chan []SymbolResult, 1)
+	go func() { done <- c.Run(context.Background(), []string{"BTCUSDT"}) }()
+	var results []SymbolResult
+	select {
+	case results = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not finish")
+	}
+	if len(results) != 1 || !errors.Is(results[0].Err, errPageLost) {
+		t.Fatalf("results %+v, want errPageLost", results)
+	}
+	if code := exitCode(context.Background(), results); code != exitAllFailed {
+		t.Errorf("exit code %d, want %d", code, exitAllFailed)
+	}
+	if *requests > 1+writeQueueDepth+2 {
+		t.Errorf("%d pages fetched after the first one was lost", *requests)
+	}
+}